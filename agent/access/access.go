@@ -0,0 +1,328 @@
+// Package access holds the vendor's requests for shell access until a customer operator decides on
+// them, and runs the SSH server only for as long as an approved grant lasts.
+package access
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxDuration = 4 * time.Hour
+	defaultRequestTTL  = time.Hour
+
+	// checkInterval is how often grants and requests are checked for expiry.
+	checkInterval = time.Second
+)
+
+// Shell is the server that gives access, started when a request is approved and closed when its
+// grant ends.
+type Shell interface {
+	Start(ctx context.Context) error
+	Close() error
+}
+
+type Request struct {
+	// ID is the id of the action the backend requested access with.
+	ID        string
+	Requester string
+	Reason    string
+
+	// Duration is how long access is requested for. The operator may grant less.
+	Duration time.Duration
+
+	RequestedAt time.Time
+
+	// ExpiresAt is when the request lapses if it hasn't been decided on.
+	ExpiresAt time.Time
+}
+
+type Grant struct {
+	Request Request
+
+	ApprovedBy string
+	ApprovedAt time.Time
+	ExpiresAt  time.Time
+}
+
+// Decision is the outcome of a request.
+type Decision struct {
+	Request  Request
+	Approved bool
+
+	// Grant is set if the request was approved.
+	Grant *Grant
+
+	// Reason explains why the request wasn't approved.
+	Reason string
+}
+
+type Config struct {
+	Shell Shell
+
+	// MaxDuration bounds every grant.
+	MaxDuration time.Duration
+
+	// RequestTTL is how long a request waits for an operator before it lapses.
+	RequestTTL time.Duration
+
+	// Event, if set, is called with every request, decision and end of a grant, eg: to record
+	// Kubernetes Events.
+	Event func(reason, message string)
+
+	// Decided, if set, is called once a request is approved, denied or lapses.
+	Decided func(Decision)
+}
+
+var (
+	ErrNotFound    = errors.New("no pending access request with that id")
+	ErrGrantActive = errors.New("access is already granted, revoke it first")
+	ErrNoGrant     = errors.New("access is not granted")
+	ErrApproving   = errors.New("a request is being approved")
+)
+
+// Manager is safe for concurrent use.
+type Manager struct {
+	cfg Config
+	now func() time.Time
+
+	mu      sync.Mutex
+	pending []Request // oldest first
+	grant   *Grant
+
+	// approving is the id of the request whose shell is being started, which stays pending until it
+	// has. It can't be denied or lapse meanwhile, and no other request can be approved.
+	approving string
+}
+
+func New(cfg Config) *Manager {
+	if cfg.MaxDuration <= 0 {
+		cfg.MaxDuration = defaultMaxDuration
+	}
+	if cfg.RequestTTL <= 0 {
+		cfg.RequestTTL = defaultRequestTTL
+	}
+
+	return &Manager{
+		cfg: cfg,
+		now: time.Now,
+	}
+}
+
+// MaxDuration is the longest access may be granted for.
+func (m *Manager) MaxDuration() time.Duration {
+	return m.cfg.MaxDuration
+}
+
+// Request adds a request for an operator to decide on. It returns false, leaving the request as it
+// is, if it is already pending.
+func (m *Manager) Request(r Request) bool {
+	m.mu.Lock()
+	if slices.ContainsFunc(m.pending, func(p Request) bool { return p.ID == r.ID }) {
+		m.mu.Unlock()
+		return false
+	}
+
+	r.RequestedAt = m.now()
+	r.ExpiresAt = r.RequestedAt.Add(m.cfg.RequestTTL)
+	m.pending = append(m.pending, r)
+	m.mu.Unlock()
+
+	m.record("AccessRequested", fmt.Sprintf("%s requests shell access for %s: %q. Approve or deny request %s on the agent's control server before %s",
+		r.Requester, m.bound(r.Duration), r.Reason, r.ID, r.ExpiresAt.Format(time.RFC3339)))
+
+	return true
+}
+
+// Pending returns the requests waiting for an operator, oldest first.
+func (m *Manager) Pending() []Request {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.Clone(m.pending)
+}
+
+// Grant returns the current grant, or nil if access isn't granted.
+func (m *Manager) Grant() *Grant {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.grant == nil {
+		return nil
+	}
+	g := *m.grant
+	return &g
+}
+
+// Approve grants the request for d, starting the shell. d is bounded by the requested duration and
+// MaxDuration, and defaults to the requested duration if 0.
+func (m *Manager) Approve(ctx context.Context, id, by string, d time.Duration) (Grant, error) {
+	m.mu.Lock()
+
+	i := slices.IndexFunc(m.pending, func(p Request) bool { return p.ID == id })
+	if i < 0 {
+		m.mu.Unlock()
+		return Grant{}, ErrNotFound
+	}
+	if m.grant != nil {
+		m.mu.Unlock()
+		return Grant{}, ErrGrantActive
+	}
+	if m.approving != "" {
+		m.mu.Unlock()
+		return Grant{}, ErrApproving
+	}
+
+	r := m.pending[i]
+	if d <= 0 || (r.Duration > 0 && d > r.Duration) {
+		d = r.Duration
+	}
+	d = m.bound(d)
+
+	// Starting the shell can take a while, so it isn't started with the lock held.
+	m.approving = id
+	m.mu.Unlock()
+
+	err := m.cfg.Shell.Start(ctx)
+
+	m.mu.Lock()
+	m.approving = ""
+
+	// The request stays pending if the shell can't be started, so that it can be approved again.
+	if err != nil {
+		m.mu.Unlock()
+		return Grant{}, fmt.Errorf("failed to start the SSH server: %w", err)
+	}
+
+	now := m.now()
+	grant := Grant{Request: r, ApprovedBy: by, ApprovedAt: now, ExpiresAt: now.Add(d)}
+	m.pending = slices.DeleteFunc(m.pending, func(p Request) bool { return p.ID == id })
+	m.grant = &grant
+	m.mu.Unlock()
+
+	m.record("AccessApproved", fmt.Sprintf("%s approved shell access for %s until %s (request %s)",
+		by, r.Requester, grant.ExpiresAt.Format(time.RFC3339), r.ID))
+	m.decided(Decision{Request: r, Approved: true, Grant: &grant})
+
+	return grant, nil
+}
+
+// Deny rejects a pending request.
+func (m *Manager) Deny(id, by string) error {
+	m.mu.Lock()
+	i := slices.IndexFunc(m.pending, func(p Request) bool { return p.ID == id })
+	if i < 0 {
+		m.mu.Unlock()
+		return ErrNotFound
+	}
+	if m.approving == id {
+		m.mu.Unlock()
+		return ErrApproving
+	}
+	r := m.pending[i]
+	m.pending = slices.Delete(m.pending, i, i+1)
+	m.mu.Unlock()
+
+	m.record("AccessDenied", fmt.Sprintf("%s denied shell access for %s (request %s)", by, r.Requester, r.ID))
+	m.decided(Decision{Request: r, Reason: "denied by " + by})
+
+	return nil
+}
+
+// Revoke ends the current grant before it expires, closing the shell.
+func (m *Manager) Revoke(by string) error {
+	m.mu.Lock()
+	grant := m.grant
+	m.grant = nil
+	m.mu.Unlock()
+
+	if grant == nil {
+		return ErrNoGrant
+	}
+
+	m.closeShell()
+	m.record("AccessRevoked", fmt.Sprintf("%s revoked the shell access of %s (request %s)", by, grant.Request.Requester, grant.Request.ID))
+
+	return nil
+}
+
+// Run ends grants and lapses requests as they expire, until ctx is done. Access granted when ctx is
+// done is ended.
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if m.Grant() != nil {
+				m.Revoke("agent shutdown")
+			}
+			return
+		case <-ticker.C:
+			m.expire()
+		}
+	}
+}
+
+func (m *Manager) expire() {
+	now := m.now()
+
+	m.mu.Lock()
+	var expired *Grant
+	if m.grant != nil && !now.Before(m.grant.ExpiresAt) {
+		expired, m.grant = m.grant, nil
+	}
+
+	var lapsed []Request
+	m.pending = slices.DeleteFunc(m.pending, func(r Request) bool {
+		if now.Before(r.ExpiresAt) || r.ID == m.approving {
+			return false
+		}
+		lapsed = append(lapsed, r)
+		return true
+	})
+	m.mu.Unlock()
+
+	if expired != nil {
+		m.closeShell()
+		m.record("AccessExpired", fmt.Sprintf("The shell access of %s expired (request %s)", expired.Request.Requester, expired.Request.ID))
+	}
+
+	for _, r := range lapsed {
+		m.record("AccessRequestExpired", fmt.Sprintf("The request by %s for shell access was not approved in time (request %s)", r.Requester, r.ID))
+		m.decided(Decision{Request: r, Reason: fmt.Sprintf("not approved within %s", m.cfg.RequestTTL)})
+	}
+}
+
+// bound limits d to MaxDuration, defaulting to it if d is 0.
+func (m *Manager) bound(d time.Duration) time.Duration {
+	if d <= 0 || d > m.cfg.MaxDuration {
+		return m.cfg.MaxDuration
+	}
+	return d
+}
+
+func (m *Manager) closeShell() {
+	if err := m.cfg.Shell.Close(); err != nil {
+		log.Printf("Failed to stop the SSH server: %v", err)
+	}
+}
+
+func (m *Manager) record(reason, message string) {
+	log.Printf("%s: %s", reason, message)
+	if m.cfg.Event != nil {
+		m.cfg.Event(reason, message)
+	}
+}
+
+func (m *Manager) decided(d Decision) {
+	if m.cfg.Decided != nil {
+		m.cfg.Decided(d)
+	}
+}
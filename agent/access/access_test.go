@@ -0,0 +1,219 @@
+package access
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeShell struct {
+	running  bool
+	startErr error
+
+	// starting, if set, is closed when Start is called, which then blocks until unblock is closed.
+	starting chan struct{}
+	unblock  chan struct{}
+}
+
+func (s *fakeShell) Start(ctx context.Context) error {
+	if s.starting != nil {
+		close(s.starting)
+		<-s.unblock
+	}
+	if s.startErr != nil {
+		return s.startErr
+	}
+	s.running = true
+	return nil
+}
+
+func (s *fakeShell) Close() error {
+	s.running = false
+	return nil
+}
+
+type recorder struct {
+	events    []string
+	decisions []Decision
+}
+
+func newTestManager(shell *fakeShell, now *time.Time) (*Manager, *recorder) {
+	rec := &recorder{}
+	m := New(Config{
+		Shell:       shell,
+		MaxDuration: 4 * time.Hour,
+		RequestTTL:  time.Hour,
+		Event:       func(reason, message string) { rec.events = append(rec.events, reason) },
+		Decided:     func(d Decision) { rec.decisions = append(rec.decisions, d) },
+	})
+	m.now = func() time.Time { return *now }
+	return m, rec
+}
+
+func TestApprove(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	shell := &fakeShell{}
+	m, rec := newTestManager(shell, &now)
+
+	if !m.Request(Request{ID: "a1", Requester: "vendor@example.com", Reason: "debug", Duration: 2 * time.Hour}) {
+		t.Fatal("Expected the request to be added")
+	}
+	if m.Request(Request{ID: "a1", Requester: "vendor@example.com"}) {
+		t.Error("Expected a pending request not to be added again")
+	}
+	if len(m.Pending()) != 1 {
+		t.Fatalf("Expected 1 pending request, got %v", m.Pending())
+	}
+
+	if _, err := m.Approve(context.Background(), "unknown", "operator", 0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	// The operator can't grant more than was requested.
+	grant, err := m.Approve(context.Background(), "a1", "operator", 10*time.Hour)
+	if err != nil {
+		t.Fatalf("Approve() returned error: %v", err)
+	}
+	if !grant.ExpiresAt.Equal(now.Add(2*time.Hour)) || grant.ApprovedBy != "operator" {
+		t.Errorf("Unexpected grant %+v", grant)
+	}
+	if !shell.running || len(m.Pending()) != 0 || m.Grant() == nil {
+		t.Errorf("Expected the shell to run for the grant")
+	}
+	if len(rec.decisions) != 1 || !rec.decisions[0].Approved {
+		t.Errorf("Expected the approval to be reported, got %+v", rec.decisions)
+	}
+
+	// The grant ends when it expires.
+	now = now.Add(2 * time.Hour)
+	m.expire()
+	if shell.running || m.Grant() != nil {
+		t.Error("Expected the shell to be closed once the grant expired")
+	}
+
+	want := []string{"AccessRequested", "AccessApproved", "AccessExpired"}
+	if len(rec.events) != len(want) {
+		t.Fatalf("Expected events %v, got %v", want, rec.events)
+	}
+	for i := range want {
+		if rec.events[i] != want[i] {
+			t.Errorf("Expected events %v, got %v", want, rec.events)
+		}
+	}
+}
+
+func TestApproveBounded(t *testing.T) {
+	now := time.Now()
+	m, _ := newTestManager(&fakeShell{}, &now)
+
+	// Requests without a duration are granted for at most MaxDuration.
+	m.Request(Request{ID: "a1"})
+	grant, err := m.Approve(context.Background(), "a1", "operator", 0)
+	if err != nil {
+		t.Fatalf("Approve() returned error: %v", err)
+	}
+	if d := grant.ExpiresAt.Sub(grant.ApprovedAt); d != 4*time.Hour {
+		t.Errorf("Expected a grant of 4h, got %s", d)
+	}
+
+	m.Request(Request{ID: "a2"})
+	if _, err := m.Approve(context.Background(), "a2", "operator", time.Hour); !errors.Is(err, ErrGrantActive) {
+		t.Errorf("Expected ErrGrantActive, got %v", err)
+	}
+}
+
+func TestApproveShellFails(t *testing.T) {
+	now := time.Now()
+	shell := &fakeShell{startErr: errors.New("tailnet unreachable")}
+	m, rec := newTestManager(shell, &now)
+
+	m.Request(Request{ID: "a1"})
+	if _, err := m.Approve(context.Background(), "a1", "operator", time.Hour); err == nil {
+		t.Fatal("Expected Approve() to fail")
+	}
+
+	// The request can be approved again once the shell can start.
+	if len(m.Pending()) != 1 || len(rec.decisions) != 0 {
+		t.Errorf("Expected the request to stay pending, got %v and %v", m.Pending(), rec.decisions)
+	}
+}
+
+func TestDenyAndLapse(t *testing.T) {
+	now := time.Now()
+	m, rec := newTestManager(&fakeShell{}, &now)
+
+	m.Request(Request{ID: "a1"})
+	m.Request(Request{ID: "a2"})
+
+	if err := m.Deny("a1", "operator"); err != nil {
+		t.Fatalf("Deny() returned error: %v", err)
+	}
+
+	now = now.Add(time.Hour)
+	m.expire()
+
+	if len(m.Pending()) != 0 {
+		t.Errorf("Expected no pending requests, got %v", m.Pending())
+	}
+	if len(rec.decisions) != 2 || rec.decisions[0].Reason != "denied by operator" || rec.decisions[1].Request.ID != "a2" || rec.decisions[1].Approved {
+		t.Errorf("Expected a denial and a lapse, got %+v", rec.decisions)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	now := time.Now()
+	shell := &fakeShell{}
+	m, _ := newTestManager(shell, &now)
+
+	if err := m.Revoke("operator"); !errors.Is(err, ErrNoGrant) {
+		t.Errorf("Expected ErrNoGrant, got %v", err)
+	}
+
+	m.Request(Request{ID: "a1"})
+	if _, err := m.Approve(context.Background(), "a1", "operator", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Revoke("operator"); err != nil {
+		t.Fatalf("Revoke() returned error: %v", err)
+	}
+	if shell.running || m.Grant() != nil {
+		t.Error("Expected the shell to be closed")
+	}
+}
+
+func TestApproveDoesNotHoldLockWhileStarting(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	shell := &fakeShell{starting: make(chan struct{}), unblock: make(chan struct{})}
+	m, _ := newTestManager(shell, &now)
+	m.Request(Request{ID: "a1", Requester: "vendor@example.com"})
+	m.Request(Request{ID: "a2", Requester: "vendor@example.com"})
+
+	approved := make(chan error, 1)
+	go func() {
+		_, err := m.Approve(context.Background(), "a1", "operator", 0)
+		approved <- err
+	}()
+	<-shell.starting
+
+	// The manager can be used while the shell starts, but not to decide on another request.
+	if len(m.Pending()) != 2 {
+		t.Errorf("Expected the request to stay pending while it is approved, got %v", m.Pending())
+	}
+	if err := m.Deny("a1", "operator"); !errors.Is(err, ErrApproving) {
+		t.Errorf("Expected ErrApproving denying the request being approved, got %v", err)
+	}
+	if _, err := m.Approve(context.Background(), "a2", "operator", 0); !errors.Is(err, ErrApproving) {
+		t.Errorf("Expected ErrApproving approving another request, got %v", err)
+	}
+	now = now.Add(2 * time.Hour)
+	m.expire()
+
+	close(shell.unblock)
+	if err := <-approved; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m.Grant() == nil || len(m.Pending()) != 0 {
+		t.Errorf("Expected the request to be granted and the other to lapse, got %v and %v", m.Grant(), m.Pending())
+	}
+}
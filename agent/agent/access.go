@@ -0,0 +1,167 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"agent/access"
+	"agent/cluster"
+	"agent/generated/service_pb"
+	"agent/ssh"
+
+	gssh "github.com/gliderlabs/ssh"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// eventTimeout bounds recording a Kubernetes Event, so that an unreachable API server doesn't hold
+// up the access flow.
+const eventTimeout = 5 * time.Second
+
+// accessShell runs the SSH server while access is granted. Ending access revokes the keys that
+// were authorized with the grant, so that none outlives it. Keys authorized by authorize_ssh_key
+// actions are left as they are.
+type accessShell struct {
+	srv *ssh.Server
+
+	mu   sync.Mutex
+	keys []gssh.PublicKey
+}
+
+func (s *accessShell) Start(ctx context.Context) error {
+	return s.srv.Start(ctx)
+}
+
+// authorize authorizes a key sent with an access request until its grant expires.
+func (s *accessShell) authorize(key gssh.PublicKey, owner string, expiresAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.srv.AddKey(key, owner, expiresAt)
+	s.keys = append(s.keys, key)
+}
+
+func (s *accessShell) Close() error {
+	s.mu.Lock()
+	for _, key := range s.keys {
+		s.srv.RemoveKey(key)
+	}
+	s.keys = nil
+	s.mu.Unlock()
+
+	return s.srv.Close()
+}
+
+// Access returns the access requests waiting for an operator and the current grant, or nil if SSH
+// is not enabled.
+func (a *Agent) Access() *access.Manager {
+	return a.access
+}
+
+// requestShellAccess holds a request for shell access until an operator decides on it, reporting
+// the action as deferred meanwhile. The action is finished by accessDecided. Called with actionMu
+// held.
+func (a *Agent) requestShellAccess(action *service_pb.Action) {
+	req := action.GetRequestShellAccess()
+
+	fail := func(err error) {
+		log.Printf("Apply error: %v", err)
+		a.finishAction(completeActionResult(nil, action, time.Now(), err))
+	}
+
+	if a.access == nil {
+		fail(errSSHDisabled)
+		return
+	}
+
+	if req.GetRequester() == "" {
+		fail(fmt.Errorf("the access request has no requester"))
+		return
+	}
+
+	var key gssh.PublicKey
+	if req.GetPublicKey() != "" {
+		var err error
+		key, _, _, _, err = gssh.ParseAuthorizedKey([]byte(req.GetPublicKey()))
+		if err != nil {
+			fail(fmt.Errorf("invalid public key: %w", err))
+			return
+		}
+	}
+
+	added := a.access.Request(access.Request{
+		ID:        action.GetId(),
+		Requester: req.GetRequester(),
+		Reason:    req.GetReason(),
+		Duration:  req.GetDuration().AsDuration(),
+	})
+	if !added {
+		// The backend delivered the action again, it is still waiting for an operator.
+		return
+	}
+
+	if key != nil {
+		a.accessKeys[action.GetId()] = key
+	}
+
+	a.reportActionResult(&service_pb.ActionResult{
+		ActionId: action.GetId(),
+		State:    service_pb.ActionState_ACTION_STATE_DEFERRED,
+		Deferral: &service_pb.Deferral{Reason: "waiting for a customer operator to approve shell access"},
+	})
+}
+
+// accessDecided finishes the action that requested access. The requester's key, if they sent one,
+// is authorized until the grant expires.
+func (a *Agent) accessDecided(d access.Decision) {
+	a.actionMu.Lock()
+	defer a.actionMu.Unlock()
+
+	key := a.accessKeys[d.Request.ID]
+	delete(a.accessKeys, d.Request.ID)
+
+	action := &service_pb.Action{Id: d.Request.ID}
+	if !d.Approved {
+		a.finishAction(completeActionResult(nil, action, d.Request.RequestedAt, fmt.Errorf("shell access %s", d.Reason)))
+		return
+	}
+
+	if key != nil {
+		a.accessShell.authorize(key, d.Request.Requester, d.Grant.ExpiresAt)
+	}
+
+	a.finishAction(completeActionResult(&service_pb.ActionResult{
+		ShellAccess: &service_pb.ShellAccessGrant{
+			ApprovedBy: d.Grant.ApprovedBy,
+			ApprovedAt: timestamppb.New(d.Grant.ApprovedAt),
+			ExpiresAt:  timestamppb.New(d.Grant.ExpiresAt),
+		},
+	}, action, d.Request.RequestedAt, nil))
+}
+
+// accessEvent records what happens to access requests as Kubernetes Events on the agent's pod, so
+// that operators see them with kubectl.
+func (a *Agent) accessEvent(reason, message string) {
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+
+	podName, err := os.Hostname()
+	if err != nil {
+		log.Printf("Failed to record event %s: %v", reason, err)
+		return
+	}
+
+	c, err := cluster.Self(ctx)
+	if err != nil {
+		log.Printf("Failed to record event %s: %v", reason, err)
+		return
+	}
+
+	if err := c.RecordEvent(ctx, cluster.CurrentNamespace(), podName, corev1.EventTypeNormal, reason, message); err != nil {
+		log.Printf("Failed to record event %s: %v", reason, err)
+	}
+}
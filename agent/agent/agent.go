@@ -1,16 +1,38 @@
 package agent
 
 import (
+	"agent/access"
 	"agent/backend"
+	"agent/backup"
+	"agent/chartsig"
 	"agent/cluster"
 	"agent/generated/service_pb"
+	"agent/journal"
 	"agent/lifecycleid"
+	"agent/logship"
+	"agent/outbox"
 	"agent/periodic"
+	"agent/policy"
+	"agent/process"
+	"agent/retry"
+	"agent/ssh"
+	"agent/version"
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	gssh "github.com/gliderlabs/ssh"
 	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"k8s.io/client-go/kubernetes"
 )
 
 type Agent struct {
@@ -19,6 +41,41 @@ type Agent struct {
 
 	client *backend.Client // gRPC client which sends heartbeats
 
+	// pods is set once the pod informer has synced; heartbeats carry no health until then.
+	pods atomic.Pointer[cluster.PodWatcher]
+
+	verifier *chartsig.Verifier
+	settings atomic.Pointer[settings]
+	journal  *journal.Journal
+	outbox   *outbox.Outbox
+
+	// streaming is set while actions are being received from WatchActions rather than by polling.
+	streaming atomic.Bool
+
+	// actionMu serialises handling actions from the stream and the apply loop. held are the
+	// ApplyChart actions waiting for the policy to allow them, oldest first.
+	actionMu sync.Mutex
+	held     []heldAction
+
+	// access holds requests for shell access until an operator decides on them, nil if SSH is not
+	// enabled. accessKeys are the keys sent with pending requests, by action id, guarded by actionMu.
+	// accessShell is the shell access starts.
+	access      *access.Manager
+	accessKeys  map[string]gssh.PublicKey
+	accessShell *accessShell
+
+	// statusMu guards what is reported by Status.
+	statusMu      sync.Mutex
+	lastHeartbeat Delivery
+	lastAction    *ActionStatus
+
+	// releasesMu guards the managed releases last reported in a heartbeat, and when they were
+	// listed. They are listed again once they are releaseStatusInterval old, or after
+	// refreshReleases.
+	releasesMu sync.Mutex
+	releases   []*service_pb.ReleaseStatus
+	releasesAt time.Time
+
 	cfg AgentConfig
 }
 
@@ -28,32 +85,164 @@ type AgentConfig struct {
 	BackendAddr string
 	BearerToken string
 
+	// BearerTokenFile, if set, is read for the bearer token instead of BearerToken, and read again
+	// when it changes.
+	BearerTokenFile string
+
+	// Transport configures the proxy, CAs, client certificate and pins used to reach the backend.
+	Transport backend.TransportConfig
+
 	HeartbeatInterval time.Duration
 	PlanInterval      time.Duration
 	VersionID         string
 
+	// LifecycleIDStore persists the lifecycle ID. The ID is stored in LifecycleIDFilePath if it is
+	// nil. Otherwise an ID already in LifecycleIDFilePath is carried over to it.
+	LifecycleIDStore    lifecycleid.LifecycleIDStore
 	LifecycleIDFilePath string
+
+	// ActionJournalFilePath is where received actions and their outcomes are recorded, so that they
+	// survive restarts.
+	ActionJournalFilePath string
+
+	// OutboxDir is where requests for the backend are queued until they have been sent, and
+	// OutboxMaxRecords and OutboxMaxBytes how many and how much may be queued before the oldest
+	// heartbeats, then session recordings, are dropped.
+	OutboxDir        string
+	OutboxMaxRecords int
+	OutboxMaxBytes   int64
+
+	// ReadyTimeout is how long an upgrade has to become ready before it is rolled back.
+	ReadyTimeout time.Duration
+
+	// Backup configures the backups that must succeed before an upgrade is applied.
+	Backup backup.Config
+
+	// ChartSigningKey is the ed25519 public key charts must be signed with. Charts are not verified if empty.
+	ChartSigningKey string
+
+	// MaintenanceWindows restricts when charts are applied, see policy.ParseWindows. Charts may be
+	// applied at any time if empty.
+	MaintenanceWindows string
+
+	// ApprovalPolicy is one of the policy.Approval values.
+	ApprovalPolicy string
+
+	// ManagedReleases are the releases, besides the agent's own, that charts may be applied to, see
+	// policy.ParseReleases.
+	ManagedReleases string
+
+	// Supervisor runs the process the agent wraps, if any. Its state is sent with heartbeats.
+	Supervisor *process.Supervisor
+
+	// Logs, if set, ships the supervised process's output to the backend.
+	Logs *logship.Shipper
+
+	// SSH, if set, is the break-glass SSH server. The backend authorizes keys for it with actions, and
+	// the recordings of its sessions are uploaded. It runs only while a customer operator grants
+	// access.
+	SSH *ssh.Server
+
+	// AccessMaxDuration bounds how long an operator may grant shell access for, and
+	// AccessRequestTTL how long a request for access waits for an operator. See access.Config.
+	AccessMaxDuration time.Duration
+	AccessRequestTTL  time.Duration
+}
+
+// settings are the parts of the config that are reloaded while the agent runs.
+type settings struct {
+	heartbeatInterval time.Duration
+	planInterval      time.Duration
+	policy            policy.Policy
+}
+
+func newSettings(cfg AgentConfig) (*settings, error) {
+	windows, err := policy.ParseWindows(cfg.MaintenanceWindows)
+	if err != nil {
+		return nil, err
+	}
+
+	approval, err := policy.ParseApproval(cfg.ApprovalPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	managed, err := policy.ParseReleases(cfg.ManagedReleases)
+	if err != nil {
+		return nil, err
+	}
+	releases := append([]policy.Release{ownRelease()}, managed...)
+
+	return &settings{
+		heartbeatInterval: cfg.HeartbeatInterval,
+		planInterval:      cfg.PlanInterval,
+		policy:            policy.Policy{Windows: windows, Approval: approval, Releases: releases},
+	}, nil
+}
+
+// Reload applies the intervals, maintenance windows, approval policy and managed releases from cfg. Intervals take
+// effect from the next tick, and the policy from the next action checked against it, so an upgrade
+// in progress is not interrupted. The rest of cfg is ignored until the agent restarts.
+func (a *Agent) Reload(cfg AgentConfig) error {
+	s, err := newSettings(cfg)
+	if err != nil {
+		return err
+	}
+
+	a.settings.Store(s)
+	a.refreshReleases()
+	log.Printf("Reloaded config: heartbeat interval %s, plan interval %s, maintenance windows %q, approval policy %s, managed releases %q",
+		cfg.HeartbeatInterval, cfg.PlanInterval, cfg.MaintenanceWindows, cfg.ApprovalPolicy, cfg.ManagedReleases)
+
+	return nil
 }
 
 func (a *Agent) Start(ctx context.Context) {
+	go a.watchPods(ctx)
+	go a.flushOutbox(ctx)
+
+	if a.access != nil {
+		go a.access.Run(ctx)
+	}
+
+	if a.cfg.Logs != nil {
+		go a.cfg.Logs.Run(ctx, a.uploadLogs)
+	}
+
+	go func() {
+		fn := func() error {
+			a.collectClusterInfo(ctx)
+			return nil
+		}
+
+		if err := periodic.RunWithJitter(ctx, fn, clusterInfoInterval, time.Minute); err != nil {
+			log.Printf("Cluster info error: %v", err)
+		}
+	}()
+
 	go func() {
 		fn := func() error {
 			a.heartbeat(ctx)
 			return nil
 		}
 
-		if err := periodic.RunWithJitter(ctx, fn, a.cfg.HeartbeatInterval, 500*time.Millisecond); err != nil {
+		interval := func() time.Duration { return a.settings.Load().heartbeatInterval }
+		if err := periodic.RunWithJitterFunc(ctx, fn, interval, 500*time.Millisecond); err != nil {
 			log.Printf("Heartbeat error: %v", err)
 		}
 	}()
 
 	go func() {
+		a.reconcile(ctx)
+		go a.watchActions(ctx)
+
 		fn := func() error {
 			a.apply(ctx)
 			return nil
 		}
 
-		if err := periodic.RunWithJitter(ctx, fn, a.cfg.PlanInterval, 20*time.Second); err != nil {
+		interval := func() time.Duration { return a.settings.Load().planInterval }
+		if err := periodic.RunWithJitterFunc(ctx, fn, interval, 20*time.Second); err != nil {
 			log.Printf("Apply error: %v", err)
 		}
 	}()
@@ -67,69 +256,897 @@ func (a *Agent) heartbeat(ctx context.Context) {
 	log.Printf("Lifecycle ID: %s", a.LifecycleID)
 	log.Printf("Session ID: %s", a.SessionID)
 
-	if err := a.client.Heartbeat(ctx); err != nil {
-		// Eat the error, we don't want to crash the agent.
-		log.Printf("Heartbeat error: %v", err)
+	req := a.client.NewHeartbeat(a.healthSnapshot())
+	req.Process = a.processStatus()
+	req.Releases = a.releaseStatuses(ctx)
+	a.enqueue(outbox.Heartbeat, req)
+}
+
+func (a *Agent) processStatus() *service_pb.ProcessStatus {
+	if a.cfg.Supervisor == nil {
+		return nil
+	}
+
+	status := a.cfg.Supervisor.Status()
+
+	ps := &service_pb.ProcessStatus{
+		State:        processStates[status.State],
+		Restarts:     int32(status.Restarts),
+		CrashLooping: status.CrashLooping,
+	}
+	if status.State == process.StateRunning {
+		ps.StartedAt = timestamppb.New(status.StartedAt)
+	}
+	for _, e := range status.Exits {
+		ps.Exits = append(ps.Exits, &service_pb.ProcessExit{
+			StartedAt: timestamppb.New(e.StartedAt),
+			ExitedAt:  timestamppb.New(e.ExitedAt),
+			ExitCode:  int32(e.ExitCode),
+			Signal:    e.Signal,
+			Error:     e.Error,
+			Requested: e.Requested,
+		})
+	}
+
+	return ps
+}
+
+func (a *Agent) uploadLogs(ctx context.Context, lines []logship.Line, dropped int64) error {
+	pbLines := make([]*service_pb.LogLine, 0, len(lines))
+	for _, l := range lines {
+		pbLines = append(pbLines, &service_pb.LogLine{
+			Time:   timestamppb.New(l.Time),
+			Stream: logStreams[l.Stream],
+			Text:   l.Text,
+		})
 	}
+
+	return a.client.UploadLogs(ctx, pbLines, dropped)
+}
+
+var logStreams = map[logship.Stream]service_pb.LogStream{
+	logship.Stdout: service_pb.LogStream_LOG_STREAM_STDOUT,
+	logship.Stderr: service_pb.LogStream_LOG_STREAM_STDERR,
+}
+
+var processStates = map[process.State]service_pb.ProcessState{
+	process.StateStarting: service_pb.ProcessState_PROCESS_STATE_STARTING,
+	process.StateRunning:  service_pb.ProcessState_PROCESS_STATE_RUNNING,
+	process.StateBackoff:  service_pb.ProcessState_PROCESS_STATE_BACKOFF,
+	process.StateExited:   service_pb.ProcessState_PROCESS_STATE_EXITED,
+}
+
+// clusterInfoInterval is how often the cluster facts sent with the agent's identity are refreshed.
+const clusterInfoInterval = 10 * time.Minute
+
+func (a *Agent) collectClusterInfo(ctx context.Context) {
+	c, err := cluster.Self(ctx)
+	if err != nil {
+		log.Printf("Not collecting cluster info: %v", err)
+		return
+	}
+
+	info, err := c.Info(ctx, cluster.CurrentReleaseName(), cluster.CurrentNamespace())
+	if err != nil {
+		log.Printf("Failed to collect cluster info: %v", err)
+		return
+	}
+
+	a.client.SetClusterInfo(&service_pb.ClusterInfo{
+		Uid:                   info.UID,
+		KubernetesVersion:     info.KubernetesVersion,
+		Distribution:          distributions[info.Distribution],
+		NodeCount:             int32(info.NodeCount),
+		CpuCapacityMillicores: info.CPUCapacityMillis,
+		MemoryCapacityBytes:   info.MemoryCapacityBytes,
+		ChartVersion:          info.ChartVersion,
+	})
+}
+
+var distributions = map[cluster.Distribution]service_pb.Distribution{
+	cluster.DistributionEKS:       service_pb.Distribution_DISTRIBUTION_EKS,
+	cluster.DistributionGKE:       service_pb.Distribution_DISTRIBUTION_GKE,
+	cluster.DistributionAKS:       service_pb.Distribution_DISTRIBUTION_AKS,
+	cluster.DistributionK3s:       service_pb.Distribution_DISTRIBUTION_K3S,
+	cluster.DistributionOpenShift: service_pb.Distribution_DISTRIBUTION_OPENSHIFT,
+}
+
+// watchPods starts the informer that collects the health of the release's pods. Pod health is
+// left out of heartbeats if the agent isn't running in a cluster.
+func (a *Agent) watchPods(ctx context.Context) {
+	c, err := cluster.Self(ctx)
+	if err != nil {
+		log.Printf("Not collecting pod health: %v", err)
+		return
+	}
+
+	pods, err := c.WatchPods(cluster.CurrentReleaseName(), cluster.CurrentNamespace())
+	if err != nil {
+		log.Printf("Not collecting pod health: %v", err)
+		return
+	}
+
+	if err := pods.Start(ctx); err != nil {
+		log.Printf("Not collecting pod health: %v", err)
+		return
+	}
+
+	a.pods.Store(pods)
+}
+
+func (a *Agent) healthSnapshot() *service_pb.HealthSnapshot {
+	pods := a.pods.Load()
+	if pods == nil {
+		return nil
+	}
+
+	health, err := pods.Snapshot()
+	if err != nil {
+		log.Printf("Failed to collect pod health: %v", err)
+		return nil
+	}
+
+	snapshot := &service_pb.HealthSnapshot{CollectedAt: timestamppb.Now()}
+	for _, p := range health {
+		pod := &service_pb.PodHealth{Name: p.Name, Phase: p.Phase}
+		for _, c := range p.Containers {
+			pod.Containers = append(pod.Containers, &service_pb.ContainerHealth{
+				Name:                  c.Name,
+				Image:                 c.Image,
+				Ready:                 c.Ready,
+				RestartCount:          c.RestartCount,
+				WaitingReason:         c.WaitingReason,
+				LastTerminationReason: c.LastTerminationReason,
+			})
+		}
+		snapshot.Pods = append(snapshot.Pods, pod)
+	}
+
+	return snapshot
 }
 
 func (a *Agent) apply(ctx context.Context) {
+	if a.streaming.Load() {
+		// Actions arrive on the stream, so only a held action needs checking again.
+		a.handleAction(ctx, nil)
+		return
+	}
+
 	action, err := a.client.Apply(ctx)
 	if err != nil {
 		log.Printf("Apply error: %v", err)
+		return
+	}
+
+	a.handleAction(ctx, action)
+}
+
+// handleAction applies an action received from the backend, or retries the held action if action
+// is nil. Actions are handled one at a time.
+func (a *Agent) handleAction(ctx context.Context, action *service_pb.Action) {
+	a.actionMu.Lock()
+	defer a.actionMu.Unlock()
+
+	if action.GetAction() != nil {
+		a.handle(ctx, action)
+		return
+	}
+
+	if len(a.held) == 0 {
+		log.Printf("No action to take.")
+		return
+	}
+	for _, h := range slices.Clone(a.held) {
+		a.handle(ctx, h.action)
+	}
+}
+
+// handle applies the action. Called with actionMu held.
+func (a *Agent) handle(ctx context.Context, action *service_pb.Action) {
+	entry, seen := a.journal.Get(action.GetId())
+	if entry.State.Done() {
+		// The backend didn't get the outcome, acknowledge it again rather than reapplying the action.
+		log.Printf("Action %s already %s, not applying it again.", action.GetId(), entry.State)
+		a.unhold(action.GetId())
+		a.reportActionResult(journaledResult(entry))
+		return
+	}
+
+	if !seen {
+		payload, err := proto.Marshal(action)
+		if err != nil {
+			log.Printf("Journal error: %v", err)
+			return
+		}
+		if err := a.journal.Record(journal.Entry{ActionID: action.GetId(), State: journal.StateReceived, Action: payload}); err != nil {
+			log.Printf("Journal error: %v", err)
+			return
+		}
+	}
+
+	if action.GetApplyChart() != nil && !a.allowed(ctx, action) {
+		return
+	}
+
+	if action.GetRequestShellAccess() != nil {
+		// Finished once an operator decides on it, see accessDecided.
+		a.requestShellAccess(action)
+		return
 	}
 
-	if err := applyAction(ctx, action); err != nil {
+	// The action must be journaled as started before it is applied, so it is never applied twice.
+	startedAt := time.Now()
+	if err := a.journal.Record(journal.Entry{ActionID: action.GetId(), State: journal.StateStarted, Time: startedAt}); err != nil {
+		log.Printf("Journal error: %v", err)
+		return
+	}
+
+	result, err := a.applyAction(ctx, action)
+	if err != nil {
 		log.Printf("Apply error: %v", err)
 	}
+
+	a.finishAction(completeActionResult(result, action, startedAt, err))
+}
+
+// reconcile finishes the actions that a previous run of the agent started but never finished, and
+// resumes those it received but never started. A managed release left pending by an interrupted
+// upgrade is rolled back first. The agent runs as a
+// single replica and applies one action at a time, so nothing else can be upgrading the releases
+// when it starts.
+func (a *Agent) reconcile(ctx context.Context) {
+	err := errAgentRestarted
+
+	c, clusterErr := cluster.Self(ctx)
+	if clusterErr != nil {
+		log.Printf("Not checking for interrupted upgrades: %v", clusterErr)
+	} else {
+		targets := []policy.Release{ownRelease()}
+		for _, rel := range a.managedReleases(ctx, c) {
+			if pending(rel) && !ownRelease().Matches(rel.Namespace, rel.Name) {
+				targets = append(targets, policy.Release{Namespace: rel.Namespace, Name: rel.Name})
+			}
+		}
+
+		for _, t := range targets {
+			if recoverErr := c.RecoverInterruptedUpgrade(ctx, t.Name, t.Namespace, a.cfg.ReadyTimeout); recoverErr != nil {
+				log.Printf("Recovering interrupted upgrade of %s: %v", t, recoverErr)
+				err = a.withBackups(ctx, c, t.Name, t.Namespace, recoverErr)
+			}
+		}
+	}
+
+	for _, e := range a.journal.Interrupted() {
+		log.Printf("Action %s was interrupted by a restart.", e.ActionID)
+		a.finishAction(completeActionResult(nil, &service_pb.Action{Id: e.ActionID}, e.Time, err))
+	}
+
+	// Actions received but not yet applied, eg: held by policy or waiting for an operator to approve
+	// shell access, are handled again as if they had just been received.
+	for _, e := range a.journal.Pending() {
+		action := &service_pb.Action{}
+		if err := proto.Unmarshal(e.Action, action); err != nil || action.GetAction() == nil {
+			log.Printf("Action %s can't be resumed after a restart: %v", e.ActionID, err)
+			a.finishAction(completeActionResult(nil, &service_pb.Action{Id: e.ActionID}, e.Time, errNotResumed))
+			continue
+		}
+
+		log.Printf("Resuming action %s, received before a restart.", e.ActionID)
+		a.handleAction(ctx, action)
+	}
+}
+
+var (
+	errAgentRestarted = errors.New("agent restarted while applying the action")
+	errNotResumed     = errors.New("agent restarted before applying the action, and could not resume it")
+)
+
+// finishAction journals the outcome of an action and reports it to the backend.
+func (a *Agent) finishAction(result *service_pb.ActionResult) {
+	entry := journal.Entry{
+		ActionID:        result.GetActionId(),
+		State:           journal.StateSucceeded,
+		Time:            result.GetFinishedAt().AsTime(),
+		Error:           result.GetError(),
+		ReleaseRevision: int(result.GetReleaseRevision()),
+	}
+	if result.GetState() == service_pb.ActionState_ACTION_STATE_FAILED {
+		entry.State = journal.StateFailed
+	}
+
+	if err := a.journal.Record(entry); err != nil {
+		log.Printf("Journal error: %v", err)
+	}
+
+	// The action may have changed a release.
+	a.refreshReleases()
+
+	a.reportActionResult(result)
+}
+
+// journaledResult rebuilds the result of a finished action from its journal entry.
+func journaledResult(entry journal.Entry) *service_pb.ActionResult {
+	result := &service_pb.ActionResult{
+		ActionId:        entry.ActionID,
+		State:           service_pb.ActionState_ACTION_STATE_SUCCEEDED,
+		Error:           entry.Error,
+		FinishedAt:      timestamppb.New(entry.Time),
+		ReleaseRevision: int32(entry.ReleaseRevision),
+	}
+	if entry.State == journal.StateFailed {
+		result.State = service_pb.ActionState_ACTION_STATE_FAILED
+	}
+	return result
+}
+
+// heldAction is an action the policy doesn't allow yet, and the deferral last reported for it.
+type heldAction struct {
+	action   *service_pb.Action
+	deferral *service_pb.Deferral
+}
+
+// allowed reports whether the policy allows the action to be applied now. Actions that aren't
+// allowed are held and retried on the next apply tick, and the deferral is reported when it changes.
+func (a *Agent) allowed(ctx context.Context, action *service_pb.Action) bool {
+	pol := a.settings.Load().policy
+
+	var approver policy.Approver
+	if pol.Approval == policy.ApprovalAnnotation {
+		// Approved on the ConfigMap next to the release the action targets.
+		releaseName, namespace, err := a.target(action.GetApplyChart().GetReleaseName(), action.GetApplyChart().GetNamespace())
+		if err != nil {
+			// Not held, applying the action fails with the error.
+			return true
+		}
+
+		client, err := a.approvalClient(ctx)
+		if err != nil {
+			log.Printf("Failed to check approval: %v", err)
+			a.hold(action, &service_pb.Deferral{Reason: fmt.Sprintf("failed to check approval, retrying: %v", err)})
+			return false
+		}
+
+		approver = policy.NewAnnotationApprover(client, releaseName, namespace)
+	}
+
+	decision, err := pol.Check(ctx, time.Now(), approver, action.GetId())
+	if err != nil {
+		// Keep holding the action, the check is retried on the next tick.
+		log.Printf("Policy check error: %v", err)
+		a.hold(action, &service_pb.Deferral{Reason: fmt.Sprintf("failed to check policy, retrying: %v", err)})
+		return false
+	}
+
+	if decision.Allowed {
+		a.unhold(action.GetId())
+		return true
+	}
+
+	deferral := &service_pb.Deferral{Reason: decision.Reason}
+	if !decision.NextWindow.IsZero() {
+		deferral.NextWindow = timestamppb.New(decision.NextWindow)
+	}
+	a.hold(action, deferral)
+	return false
+}
+
+func (a *Agent) approvalClient(ctx context.Context) (kubernetes.Interface, error) {
+	c, err := cluster.Self(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.Clientset()
+}
+
+// hold keeps the action to retry it, reporting the deferral if it changed. An action already held
+// for the same release is superseded and finished as failed, since applying its chart after the
+// newer one would undo it.
+func (a *Agent) hold(action *service_pb.Action, deferral *service_pb.Deferral) {
+	i := slices.IndexFunc(a.held, func(h heldAction) bool { return h.action.GetId() == action.GetId() })
+	if i >= 0 {
+		if proto.Equal(deferral, a.held[i].deferral) {
+			return
+		}
+		a.held[i].deferral = deferral
+	} else {
+		a.supersede(action)
+		a.held = append(a.held, heldAction{action: action, deferral: deferral})
+	}
+
+	log.Printf("Deferring action %s: %s", action.GetId(), deferral.GetReason())
+	a.reportActionResult(&service_pb.ActionResult{
+		ActionId: action.GetId(),
+		State:    service_pb.ActionState_ACTION_STATE_DEFERRED,
+		Deferral: deferral,
+	})
+}
+
+func (a *Agent) supersede(action *service_pb.Action) {
+	release := withDefaults(action.GetApplyChart().GetReleaseName(), action.GetApplyChart().GetNamespace())
+	a.held = slices.DeleteFunc(a.held, func(h heldAction) bool {
+		if withDefaults(h.action.GetApplyChart().GetReleaseName(), h.action.GetApplyChart().GetNamespace()) != release {
+			return false
+		}
+
+		log.Printf("Action %s is superseded by action %s.", h.action.GetId(), action.GetId())
+		a.finishAction(completeActionResult(nil, h.action, time.Now(), fmt.Errorf("superseded by action %s", action.GetId())))
+		return true
+	})
+}
+
+func (a *Agent) unhold(actionID string) {
+	a.held = slices.DeleteFunc(a.held, func(h heldAction) bool { return h.action.GetId() == actionID })
+}
+
+func (a *Agent) reportActionResult(result *service_pb.ActionResult) {
+	log.Printf("Reporting result for action %s: %s", result.GetActionId(), result.GetState())
+	a.recordActionResult(result)
+
+	a.enqueue(outbox.ActionResult, a.client.NewActionResult(result))
+}
+
+// enqueue queues a request in the outbox, from which flushOutbox sends it.
+func (a *Agent) enqueue(kind outbox.Kind, req proto.Message) {
+	data, err := proto.Marshal(req)
+	if err != nil {
+		log.Printf("Failed to encode %s: %v", kind, err)
+		return
+	}
+
+	if err := a.outbox.Push(kind, data); err != nil {
+		// Eat the error, we don't want to crash the agent.
+		log.Printf("Failed to queue %s: %v", kind, err)
+	}
+}
+
+// flushOutbox sends queued requests to the backend in the order they were queued, backing off
+// while the backend is unreachable.
+func (a *Agent) flushOutbox(ctx context.Context) {
+	for {
+		fn := func() error {
+			err := a.outbox.Drain(ctx, a.send)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Backend unreachable, %d requests queued: %v", a.outbox.Len(), err)
+			}
+			return err
+		}
+
+		if err := retry.RetryExponential(ctx, fn, time.Second, outboxMaxBackoff); err != nil && ctx.Err() == nil {
+			log.Printf("Outbox error: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.outbox.Ready():
+		}
+	}
+}
+
+const outboxMaxBackoff = 5 * time.Minute
+
+func (a *Agent) send(ctx context.Context, r outbox.Record) error {
+	var req proto.Message
+	switch r.Kind {
+	case outbox.Heartbeat:
+		req = &service_pb.HeartbeatRequest{}
+	case outbox.ActionResult:
+		req = &service_pb.ReportActionResultRequest{}
+	case outbox.SessionRecording:
+		req = &service_pb.UploadSessionRecordingRequest{}
+	default:
+		log.Printf("Dropping %s record %d: unknown kind", r.Kind, r.Seq)
+		return nil
+	}
+
+	if err := proto.Unmarshal(r.Data, req); err != nil {
+		log.Printf("Dropping %s record %d: %v", r.Kind, r.Seq, err)
+		return nil
+	}
+
+	var err error
+	switch req := req.(type) {
+	case *service_pb.HeartbeatRequest:
+		err = a.client.SendHeartbeat(ctx, req)
+		a.recordHeartbeat(err)
+	case *service_pb.ReportActionResultRequest:
+		err = a.client.SendActionResult(ctx, req)
+	case *service_pb.UploadSessionRecordingRequest:
+		err = a.client.SendSessionRecording(ctx, req)
+	}
+
+	// Don't let requests the backend will never accept block the requests queued behind them.
+	// Recordings can't be collected again, so they are set aside rather than dropped.
+	if code := status.Code(err); code == codes.InvalidArgument || code == codes.Unimplemented {
+		if r.Kind == outbox.SessionRecording {
+			return fmt.Errorf("%w: %w", outbox.ErrRejected, err)
+		}
+		log.Printf("Dropping %s record %d: %v", r.Kind, r.Seq, err)
+		return nil
+	}
+
+	return err
 }
 
 func NewAgent(cfg AgentConfig) (*Agent, error) {
-	lifecycleID := lifecycleid.NewLifecycleIDGenerator(cfg.LifecycleIDFilePath).Generate()
+	verifier, err := chartsig.NewVerifier(cfg.ChartSigningKey)
+	if err != nil {
+		return nil, err
+	}
+	if !verifier.Enabled() {
+		log.Printf("No chart signing key configured, charts will be applied without verification.")
+	}
+
+	if err := cfg.Backup.Validate(); err != nil {
+		return nil, err
+	}
+
+	s, err := newSettings(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	actionJournal, err := journal.Open(cfg.ActionJournalFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	queue, err := outbox.Open(cfg.OutboxDir, cfg.OutboxMaxRecords, cfg.OutboxMaxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	lifecycleID, err := loadLifecycleID(cfg)
+	if err != nil {
+		return nil, err
+	}
 	sessionID := uuid.New().String()
 
-	log.Printf("Creating client with backend address %s, and token: %s", cfg.BackendAddr, cfg.BearerToken)
-	client, err := backend.NewClient(cfg.BackendAddr, cfg.BearerToken, backend.Identity{
-		LifecycleID: lifecycleID,
-		SessionID:   sessionID,
-		Name:        cfg.Name,
-		VersionID:   cfg.VersionID,
-	})
+	if cfg.BearerTokenFile != "" {
+		log.Printf("Creating client with backend address %s, and token from %s", cfg.BackendAddr, cfg.BearerTokenFile)
+	} else {
+		log.Printf("Creating client with backend address %s, and token: %s", cfg.BackendAddr, backend.Redact(cfg.BearerToken))
+	}
+	agentVersion, agentCommit := version.Get()
+	log.Printf("Agent version %s (commit %s)", agentVersion, agentCommit)
+
+	client, err := backend.NewClient(cfg.BackendAddr, backend.Credentials{
+		BootstrapToken:     cfg.BearerToken,
+		BootstrapTokenFile: cfg.BearerTokenFile,
+	}, backend.Identity{
+		LifecycleID:  lifecycleID,
+		SessionID:    sessionID,
+		Name:         cfg.Name,
+		VersionID:    cfg.VersionID,
+		AgentVersion: agentVersion,
+		AgentCommit:  agentCommit,
+	}, cfg.Transport)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Agent{
+	a := &Agent{
 		LifecycleID: lifecycleID,
 		SessionID:   sessionID,
 		client:      client,
+		verifier:    verifier,
+		journal:     actionJournal,
+		outbox:      queue,
 		cfg:         cfg,
-	}, nil
+	}
+	a.settings.Store(s)
+
+	if cfg.SSH != nil {
+		cfg.SSH.OnRecording(a.uploadRecording)
+
+		a.accessShell = &accessShell{srv: cfg.SSH}
+		a.access = access.New(access.Config{
+			Shell:       a.accessShell,
+			MaxDuration: cfg.AccessMaxDuration,
+			RequestTTL:  cfg.AccessRequestTTL,
+			Event:       a.accessEvent,
+			Decided:     a.accessDecided,
+		})
+		a.accessKeys = map[string]gssh.PublicKey{}
+	}
+
+	return a, nil
+}
+
+// lifecycleIDTimeout bounds loading or storing the lifecycle ID when the agent starts.
+const lifecycleIDTimeout = 30 * time.Second
+
+func loadLifecycleID(cfg AgentConfig) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), lifecycleIDTimeout)
+	defer cancel()
+
+	file := &lifecycleid.FileStore{Path: cfg.LifecycleIDFilePath}
+	if cfg.LifecycleIDStore == nil {
+		return lifecycleid.Get(ctx, file)
+	}
+	return lifecycleid.Get(ctx, cfg.LifecycleIDStore, file)
 }
 
-func applyAction(ctx context.Context, action *service_pb.Action) error {
+// applyAction runs the action and returns the action-specific parts of its result.
+func (a *Agent) applyAction(ctx context.Context, action *service_pb.Action) (*service_pb.ActionResult, error) {
 	switch action.GetAction().(type) {
 	case *service_pb.Action_ApplyChart:
-		return applyChart(ctx, action.GetApplyChart())
+		return a.applyChart(ctx, action.GetApplyChart())
+	case *service_pb.Action_PlanChart:
+		return a.planChart(ctx, action.GetPlanChart())
+	case *service_pb.Action_AuthorizeSshKey:
+		return nil, a.authorizeSSHKey(action.GetAuthorizeSshKey())
+	case *service_pb.Action_RollbackRelease:
+		return a.rollbackRelease(ctx, action.GetRollbackRelease())
+	case *service_pb.Action_UninstallRelease:
+		return a.uninstallRelease(ctx, action.GetUninstallRelease())
+	case *service_pb.Action_RestartWorkloads:
+		return a.restartWorkloads(ctx, action.GetRestartWorkloads())
+	case *service_pb.Action_ScaleWorkload:
+		return a.scaleWorkload(ctx, action.GetScaleWorkload())
+	case *service_pb.Action_ReleaseHistory:
+		return a.releaseHistory(ctx, action.GetReleaseHistory())
 	}
 
-	log.Printf("No action to take.")
-
-	return nil
+	return nil, fmt.Errorf("unsupported action type %T", action.GetAction())
 }
 
-func applyChart(ctx context.Context, action *service_pb.ApplyChartRequest) error {
+func (a *Agent) applyChart(ctx context.Context, action *service_pb.ApplyChartRequest) (*service_pb.ActionResult, error) {
 	log.Printf("Applying chart action.")
+	if err := a.verifier.Verify(action.GetChart(), action.GetSignature()); err != nil {
+		return nil, fmt.Errorf("refusing to apply chart: %w", err)
+	}
+
+	values, err := chartValues(action.GetValuesStrategy(), action.GetValuesOverlay())
+	if err != nil {
+		return nil, err
+	}
+	if len(values.Overlay) > 0 {
+		if err := a.verifier.Verify(values.Overlay, action.GetValuesOverlaySignature()); err != nil {
+			return nil, fmt.Errorf("refusing to apply values overlay: %w", err)
+		}
+	}
+
 	c, err := cluster.Self(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	releaseName, namespace, err := a.target(action.GetReleaseName(), action.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts, err := c.CheckValues(ctx, action.GetChart(), releaseName, namespace, values)
+	result := &service_pb.ActionResult{ValueConflicts: conflictResults(conflicts)}
+	if err != nil {
+		return result, fmt.Errorf("refusing to upgrade: %w", err)
+	}
+	if len(conflicts) > 0 {
+		if action.GetRefuseValueConflicts() {
+			return result, fmt.Errorf("refusing to upgrade: the values overlay changes %d of the customer's values", len(conflicts))
+		}
+		log.Printf("The values overlay changes %d of the customer's values.", len(conflicts))
+	}
+
+	if err := a.backupRelease(ctx, c, releaseName, namespace); err != nil {
+		return result, fmt.Errorf("pre-upgrade backup failed, not upgrading: %w", err)
+	}
+
+	rel, err := c.UpgradeWithRollback(ctx, action.GetChart(), releaseName, namespace, values, a.cfg.ReadyTimeout)
+	if err != nil {
+		return result, a.withBackups(ctx, c, releaseName, namespace, err)
+	}
+
+	log.Printf("Chart applied.")
+
+	result.ReleaseRevision = int32(rel.Version)
+	return result, nil
+}
+
+func (a *Agent) planChart(ctx context.Context, action *service_pb.PlanChartRequest) (*service_pb.ActionResult, error) {
+	log.Printf("Planning chart action.")
+	values, err := chartValues(action.GetValuesStrategy(), action.GetValuesOverlay())
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := cluster.Self(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	releaseName, namespace, err := a.target(action.GetReleaseName(), action.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := c.Plan(ctx, action.GetChart(), releaseName, namespace, values)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Chart planned: %d resources would change.", len(plan.Resources))
+
+	return &service_pb.ActionResult{
+		ReleaseRevision: int32(plan.Revision),
+		Plan:            planResult(plan),
+		ValueConflicts:  conflictResults(plan.Conflicts),
+	}, nil
+}
+
+// backupRelease runs the configured backups of the current revision and records them against it.
+// The current revision is the deployed one or, if none is deployed, the last one.
+func (a *Agent) backupRelease(ctx context.Context, c *cluster.Cluster, releaseName, namespace string) error {
+	runner, err := a.backupRunner(c)
 	if err != nil {
 		return err
 	}
 
-	if err := c.Upgrade(ctx, action.GetChart(), cluster.CurrentReleaseName(), cluster.CurrentNamespace()); err != nil {
+	if !runner.Enabled() {
+		log.Printf("No pre-upgrade backups configured.")
+		return nil
+	}
+
+	current, err := c.Current(ctx, releaseName, namespace)
+	if err != nil {
 		return err
 	}
 
-	log.Printf("Chart applied.")
+	_, err = runner.Run(ctx, backup.Target{
+		ReleaseName: releaseName,
+		Namespace:   namespace,
+		Revision:    current.Version,
+	})
+	return err
+}
 
-	return nil
+// withBackups fills in the backups of the revision a *cluster.RolledBackError rolled back to, so
+// that the backend can tell the operator where the data from before the failed upgrade is. Other
+// errors are returned as they are.
+func (a *Agent) withBackups(ctx context.Context, c *cluster.Cluster, releaseName, namespace string, err error) error {
+	var rolledBack *cluster.RolledBackError
+	if errors.As(err, &rolledBack) {
+		rolledBack.Backups = a.findBackups(ctx, c, releaseName, namespace, rolledBack.ToRevision)
+	}
+	return err
+}
+
+// findBackups returns the backups recorded against a revision. Failing to find them doesn't fail
+// the action that wants them, so errors are only logged.
+func (a *Agent) findBackups(ctx context.Context, c *cluster.Cluster, releaseName, namespace string, revision int) []backup.Reference {
+	client, err := c.Clientset()
+	if err != nil {
+		log.Printf("Failed to find backups of release %q revision %d: %v", releaseName, revision, err)
+		return nil
+	}
+
+	refs, err := backup.NewStore(client).Find(ctx, releaseName, namespace, revision)
+	if err != nil {
+		log.Printf("Failed to find backups of release %q revision %d: %v", releaseName, revision, err)
+	}
+	return refs
+}
+
+func (a *Agent) backupRunner(c *cluster.Cluster) (*backup.Runner, error) {
+	client, err := c.Clientset()
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []backup.Backup
+	if a.cfg.Backup.JobImage != "" {
+		backups = append(backups, backup.NewJobBackup(client, a.cfg.Backup))
+	}
+
+	if a.cfg.Backup.VolumeSnapshots {
+		dynamic, err := c.Dynamic()
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, backup.NewSnapshotBackup(client, dynamic, a.cfg.Backup))
+	}
+
+	return backup.NewRunner(backup.NewStore(client), backups...), nil
+}
+
+// completeActionResult fills in the parts of an action's result that are common to every action.
+// result may be nil if the action failed before producing one.
+func completeActionResult(result *service_pb.ActionResult, action *service_pb.Action, startedAt time.Time, err error) *service_pb.ActionResult {
+	if result == nil {
+		result = &service_pb.ActionResult{}
+	}
+
+	result.ActionId = action.GetId()
+	result.State = service_pb.ActionState_ACTION_STATE_SUCCEEDED
+	result.StartedAt = timestamppb.New(startedAt)
+	result.FinishedAt = timestamppb.Now()
+
+	if err != nil {
+		result.State = service_pb.ActionState_ACTION_STATE_FAILED
+		result.Error = err.Error()
+	}
+
+	var rolledBack *cluster.RolledBackError
+	if errors.As(err, &rolledBack) {
+		result.Rollback = &service_pb.RollbackResult{
+			FromRevision: int32(rolledBack.FromRevision),
+			ToRevision:   int32(rolledBack.ToRevision),
+		}
+		if rolledBack.RollbackErr != nil {
+			result.Rollback.Error = rolledBack.RollbackErr.Error()
+		}
+		result.Rollback.Backups = backupResults(rolledBack.Backups)
+	}
+
+	return result
+}
+
+func backupResults(refs []backup.Reference) []*service_pb.BackupReference {
+	var results []*service_pb.BackupReference
+	for _, ref := range refs {
+		results = append(results, &service_pb.BackupReference{
+			Backup:    ref.Backup,
+			Kind:      ref.Kind,
+			Namespace: ref.Namespace,
+			Name:      ref.Name,
+			CreatedAt: timestamppb.New(ref.CreatedAt),
+		})
+	}
+	return results
+}
+
+func planResult(plan *cluster.Plan) *service_pb.PlanChartResult {
+	result := &service_pb.PlanChartResult{ReleaseRevision: int32(plan.Revision)}
+
+	for _, r := range plan.Resources {
+		diff := &service_pb.ResourceDiff{
+			Change:     resourceChanges[r.Change],
+			ApiVersion: r.APIVersion,
+			Kind:       r.Kind,
+			Namespace:  r.Namespace,
+			Name:       r.Name,
+		}
+		for _, f := range r.Fields {
+			diff.Fields = append(diff.Fields, &service_pb.FieldChange{Path: f.Path, From: f.From, To: f.To})
+		}
+		result.Resources = append(result.Resources, diff)
+	}
+
+	return result
+}
+
+var valuesStrategies = map[service_pb.ValuesStrategy]cluster.ValuesStrategy{
+	service_pb.ValuesStrategy_VALUES_STRATEGY_UNSPECIFIED:      cluster.ValuesResetThenReuse,
+	service_pb.ValuesStrategy_VALUES_STRATEGY_RESET_THEN_REUSE: cluster.ValuesResetThenReuse,
+	service_pb.ValuesStrategy_VALUES_STRATEGY_REUSE:            cluster.ValuesReuse,
+	service_pb.ValuesStrategy_VALUES_STRATEGY_RESET:            cluster.ValuesReset,
+	service_pb.ValuesStrategy_VALUES_STRATEGY_OVERLAY:          cluster.ValuesOverlay,
+}
+
+// chartValues returns how a chart action's values are merged.
+func chartValues(strategy service_pb.ValuesStrategy, overlay []byte) (cluster.Values, error) {
+	s, ok := valuesStrategies[strategy]
+	if !ok {
+		return cluster.Values{}, fmt.Errorf("unsupported values strategy %s", strategy)
+	}
+	if len(overlay) > 0 && s != cluster.ValuesOverlay {
+		return cluster.Values{}, fmt.Errorf("a values overlay requires %s, got %s", service_pb.ValuesStrategy_VALUES_STRATEGY_OVERLAY, strategy)
+	}
+
+	return cluster.Values{Strategy: s, Overlay: overlay}, nil
+}
+
+func conflictResults(conflicts []cluster.ValueConflict) []*service_pb.ValueConflict {
+	var results []*service_pb.ValueConflict
+	for _, c := range conflicts {
+		results = append(results, &service_pb.ValueConflict{Path: c.Path, Customer: c.Customer, Overlay: c.Overlay})
+	}
+	return results
+}
+
+var resourceChanges = map[cluster.ResourceChange]service_pb.ResourceChange{
+	cluster.ResourceAdded:   service_pb.ResourceChange_RESOURCE_CHANGE_ADDED,
+	cluster.ResourceChanged: service_pb.ResourceChange_RESOURCE_CHANGE_CHANGED,
+	cluster.ResourceRemoved: service_pb.ResourceChange_RESOURCE_CHANGE_REMOVED,
 }
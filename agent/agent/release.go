@@ -0,0 +1,252 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"agent/cluster"
+	"agent/generated/service_pb"
+	"agent/policy"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// releaseStatusTimeout bounds listing the managed releases for a heartbeat.
+	releaseStatusTimeout = 10 * time.Second
+
+	// releaseStatusInterval is how often the managed releases are listed for heartbeats. Listing
+	// reads every release in each managed namespace, which is too much to do on every heartbeat.
+	releaseStatusInterval = 5 * time.Minute
+)
+
+// ownRelease is the release the agent was installed with, which it always manages.
+func ownRelease() policy.Release {
+	return policy.Release{Namespace: cluster.CurrentNamespace(), Name: cluster.CurrentReleaseName()}
+}
+
+// target returns the release an action targets, defaulting to the agent's own. Releases the agent
+// doesn't manage are refused.
+func (a *Agent) target(releaseName, namespace string) (string, string, error) {
+	release := withDefaults(releaseName, namespace)
+	if !a.settings.Load().policy.Manages(release.Namespace, release.Name) {
+		return "", "", fmt.Errorf("release %s is not managed by this agent, see managed-releases", release)
+	}
+	return release.Name, release.Namespace, nil
+}
+
+// withDefaults returns the release an action names, defaulting to the agent's own.
+func withDefaults(releaseName, namespace string) policy.Release {
+	own := ownRelease()
+	if releaseName == "" {
+		releaseName = own.Name
+	}
+	if namespace == "" {
+		namespace = own.Namespace
+	}
+	return policy.Release{Namespace: namespace, Name: releaseName}
+}
+
+// managedReleases returns the latest revision of every release the agent manages. Namespaces whose
+// releases can't be listed are left out.
+func (a *Agent) managedReleases(ctx context.Context, c *cluster.Cluster) []cluster.ReleaseStatus {
+	pol := a.settings.Load().policy
+
+	var managed []cluster.ReleaseStatus
+	listed := map[string]bool{}
+	for _, r := range pol.Releases {
+		if listed[r.Namespace] {
+			continue
+		}
+		listed[r.Namespace] = true
+
+		releases, err := c.Releases(ctx, r.Namespace)
+		if err != nil {
+			log.Printf("Failed to list releases in namespace %s: %v", r.Namespace, err)
+			continue
+		}
+		for _, rel := range releases {
+			if pol.Manages(rel.Namespace, rel.Name) {
+				managed = append(managed, rel)
+			}
+		}
+	}
+
+	return managed
+}
+
+// releaseStatuses reports the managed releases in heartbeats, listing them at most once every
+// releaseStatusInterval unless an action has finished since. It returns nil if the agent isn't
+// running in a cluster.
+func (a *Agent) releaseStatuses(ctx context.Context) []*service_pb.ReleaseStatus {
+	a.releasesMu.Lock()
+	if time.Since(a.releasesAt) < releaseStatusInterval {
+		defer a.releasesMu.Unlock()
+		return a.releases
+	}
+	a.releasesMu.Unlock()
+
+	listedAt := time.Now()
+	releases := a.listReleaseStatuses(ctx)
+
+	a.releasesMu.Lock()
+	defer a.releasesMu.Unlock()
+	a.releases, a.releasesAt = releases, listedAt
+	return releases
+}
+
+// refreshReleases has the next heartbeat list the managed releases again, eg: once an action may
+// have changed them.
+func (a *Agent) refreshReleases() {
+	a.releasesMu.Lock()
+	defer a.releasesMu.Unlock()
+
+	a.releasesAt = time.Time{}
+}
+
+func (a *Agent) listReleaseStatuses(ctx context.Context) []*service_pb.ReleaseStatus {
+	ctx, cancel := context.WithTimeout(ctx, releaseStatusTimeout)
+	defer cancel()
+
+	c, err := cluster.Self(ctx)
+	if err != nil {
+		return nil
+	}
+
+	own := ownRelease()
+	var statuses []*service_pb.ReleaseStatus
+	for _, rel := range a.managedReleases(ctx, c) {
+		status := releaseStatus(rel)
+		status.Agent = own.Matches(rel.Namespace, rel.Name)
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+func releaseStatus(rel cluster.ReleaseStatus) *service_pb.ReleaseStatus {
+	return &service_pb.ReleaseStatus{
+		Name:         rel.Name,
+		Namespace:    rel.Namespace,
+		Revision:     int32(rel.Revision),
+		Status:       rel.Status,
+		ChartName:    rel.Chart,
+		ChartVersion: rel.ChartVersion,
+		AppVersion:   rel.AppVersion,
+		UpdatedAt:    timestamppb.New(rel.UpdatedAt),
+		Description:  rel.Description,
+	}
+}
+
+// pending reports whether the release was left part way through an install, upgrade or rollback.
+func pending(rel cluster.ReleaseStatus) bool {
+	return strings.HasPrefix(rel.Status, "pending-")
+}
+
+func (a *Agent) rollbackRelease(ctx context.Context, action *service_pb.RollbackReleaseRequest) (*service_pb.ActionResult, error) {
+	releaseName, namespace, err := a.target(action.GetReleaseName(), action.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+	if action.GetRevision() < 0 {
+		return nil, fmt.Errorf("invalid revision %d", action.GetRevision())
+	}
+
+	c, err := cluster.Self(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := c.Deployed(ctx, releaseName, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	revision := int(action.GetRevision())
+	if revision == 0 {
+		// As Helm does, see action.Rollback.
+		revision = current.Version - 1
+	}
+
+	log.Printf("Rolling back release %s/%s to revision %d.", namespace, releaseName, revision)
+	if err := c.Rollback(ctx, releaseName, namespace, revision, a.cfg.ReadyTimeout); err != nil {
+		return nil, err
+	}
+
+	rel, err := c.Deployed(ctx, releaseName, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return &service_pb.ActionResult{
+		ReleaseRevision: int32(rel.Version),
+		Rollback: &service_pb.RollbackResult{
+			FromRevision: int32(current.Version),
+			ToRevision:   int32(revision),
+			Backups:      backupResults(a.findBackups(ctx, c, releaseName, namespace, revision)),
+		},
+	}, nil
+}
+
+func (a *Agent) uninstallRelease(ctx context.Context, action *service_pb.UninstallReleaseRequest) (*service_pb.ActionResult, error) {
+	releaseName, namespace, err := a.target(action.GetReleaseName(), action.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+	if ownRelease().Matches(namespace, releaseName) {
+		return nil, fmt.Errorf("refusing to uninstall release %s/%s, which the agent runs in", namespace, releaseName)
+	}
+	if want := namespace + "/" + releaseName; action.GetConfirmation() != want {
+		return nil, fmt.Errorf("refusing to uninstall release %s: confirmation %q does not match %q", want, action.GetConfirmation(), want)
+	}
+
+	c, err := cluster.Self(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Uninstalling release %s/%s.", namespace, releaseName)
+	return nil, c.Uninstall(ctx, releaseName, namespace, action.GetKeepHistory())
+}
+
+func (a *Agent) releaseHistory(ctx context.Context, action *service_pb.ReleaseHistoryRequest) (*service_pb.ActionResult, error) {
+	releaseName, namespace, err := a.target(action.GetReleaseName(), action.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+	if action.GetMax() < 0 || action.GetRevision() < 0 {
+		return nil, fmt.Errorf("invalid max %d or revision %d", action.GetMax(), action.GetRevision())
+	}
+
+	c, err := cluster.Self(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions, err := c.History(ctx, releaseName, namespace, int(action.GetMax()))
+	if err != nil {
+		return nil, err
+	}
+
+	history := &service_pb.ReleaseHistory{}
+	for _, rel := range revisions {
+		history.Revisions = append(history.Revisions, releaseStatus(rel))
+	}
+
+	if action.GetRevision() > 0 {
+		m, err := c.Manifest(ctx, releaseName, namespace, int(action.GetRevision()))
+		if err != nil {
+			return nil, err
+		}
+		history.Manifest = &service_pb.RevisionManifest{
+			Revision: int32(m.Revision),
+			Manifest: m.Manifest,
+			Values:   m.Values,
+		}
+	}
+
+	return &service_pb.ActionResult{ReleaseHistory: history}, nil
+}
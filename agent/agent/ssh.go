@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"agent/generated/service_pb"
+	"agent/outbox"
+	"agent/ssh"
+
+	gssh "github.com/gliderlabs/ssh"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var errSSHDisabled = errors.New("SSH is not enabled on this agent")
+
+// authorizeSSHKey lets the holder of a key open SSH sessions until the key expires. An expiry in the
+// past revokes the key.
+func (a *Agent) authorizeSSHKey(req *service_pb.AuthorizeSshKeyRequest) error {
+	if a.cfg.SSH == nil {
+		return errSSHDisabled
+	}
+
+	key, _, _, _, err := gssh.ParseAuthorizedKey([]byte(req.GetPublicKey()))
+	if err != nil {
+		return fmt.Errorf("invalid public key: %w", err)
+	}
+	if req.GetOwner() == "" {
+		return errors.New("the key has no owner")
+	}
+
+	expiresAt := req.GetExpiresAt().AsTime()
+	a.cfg.SSH.AddKey(key, req.GetOwner(), expiresAt)
+	if expiresAt.After(time.Now()) {
+		log.Printf("Authorized SSH key %s of %s until %s", ssh.Fingerprint(key), req.GetOwner(), expiresAt)
+	} else {
+		log.Printf("Revoked SSH key %s of %s", ssh.Fingerprint(key), req.GetOwner())
+	}
+
+	return nil
+}
+
+// uploadRecording queues the recording of an SSH session for the backend.
+func (a *Agent) uploadRecording(rec ssh.Recording) {
+	a.enqueue(outbox.SessionRecording, a.client.NewSessionRecording(&service_pb.SessionRecording{
+		SessionId:      rec.SessionID,
+		Owner:          rec.Owner,
+		KeyFingerprint: rec.KeyFingerprint,
+		RemoteAddr:     rec.RemoteAddr,
+		StartedAt:      timestamppb.New(rec.StartedAt),
+		EndedAt:        timestamppb.New(rec.EndedAt),
+		Cast:           rec.Cast,
+		Truncated:      rec.Truncated,
+	}))
+}
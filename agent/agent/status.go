@@ -0,0 +1,95 @@
+package agent
+
+import (
+	"strings"
+	"time"
+
+	"agent/generated/service_pb"
+	"agent/version"
+)
+
+// Status describes what the agent has been doing, for the control server.
+type Status struct {
+	Name         string
+	LifecycleID  string
+	SessionID    string
+	AgentVersion string
+	AgentCommit  string
+
+	// LastHeartbeat is the last attempt to deliver a heartbeat to the backend. Its time is zero until
+	// the first attempt.
+	LastHeartbeat Delivery
+
+	// LastAction is the action whose result was last reported, nil until one is.
+	LastAction *ActionStatus
+
+	// QueuedRequests is how many heartbeats and action results are waiting to be sent.
+	QueuedRequests int
+
+	// Streaming is whether actions are received from the stream rather than by polling.
+	Streaming bool
+}
+
+// Delivery is the outcome of sending a request to the backend. Error is empty if it was received.
+type Delivery struct {
+	Time  time.Time
+	Error string
+}
+
+type ActionStatus struct {
+	ID string
+
+	// State is the reported state, eg: "succeeded" or "deferred".
+	State string
+	Time  time.Time
+	Error string
+}
+
+func (a *Agent) Status() Status {
+	agentVersion, agentCommit := version.Get()
+
+	a.statusMu.Lock()
+	defer a.statusMu.Unlock()
+
+	status := Status{
+		Name:           a.cfg.Name,
+		LifecycleID:    a.LifecycleID,
+		SessionID:      a.SessionID,
+		AgentVersion:   agentVersion,
+		AgentCommit:    agentCommit,
+		LastHeartbeat:  a.lastHeartbeat,
+		QueuedRequests: a.outbox.Len(),
+		Streaming:      a.streaming.Load(),
+	}
+	if a.lastAction != nil {
+		action := *a.lastAction
+		status.LastAction = &action
+	}
+
+	return status
+}
+
+func (a *Agent) recordHeartbeat(err error) {
+	a.statusMu.Lock()
+	defer a.statusMu.Unlock()
+
+	a.lastHeartbeat = Delivery{Time: time.Now()}
+	if err != nil {
+		a.lastHeartbeat.Error = err.Error()
+	}
+}
+
+func (a *Agent) recordActionResult(result *service_pb.ActionResult) {
+	a.statusMu.Lock()
+	defer a.statusMu.Unlock()
+
+	a.lastAction = &ActionStatus{
+		ID:    result.GetActionId(),
+		State: strings.ToLower(strings.TrimPrefix(result.GetState().String(), "ACTION_STATE_")),
+		Time:  time.Now(),
+		Error: result.GetError(),
+	}
+	if result.GetFinishedAt() != nil {
+		a.lastAction.Time = result.GetFinishedAt().AsTime()
+	}
+}
@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"agent/generated/service_pb"
+	"agent/retry"
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+const (
+	streamInitialBackoff = time.Second
+	streamMaxBackoff     = 5 * time.Minute
+
+	// streamIdleTimeout is how long the stream may go without a response, including keepalives,
+	// before it is presumed dead and reopened.
+	streamIdleTimeout = 3 * time.Minute
+
+	// streamHealthyAfter is how long a stream that delivers no responses must stay open to count as
+	// having worked. Streams that end sooner are reopened with backoff, as if they failed to open.
+	streamHealthyAfter = 30 * time.Second
+)
+
+var errStreamEnded = errors.New("action stream ended before it delivered a response")
+
+// watchActions keeps a WatchActions stream open so that actions are applied as soon as the backend
+// sends them. The apply loop polls instead whenever the stream isn't open.
+func (a *Agent) watchActions(ctx context.Context) {
+	for ctx.Err() == nil {
+		fn := func() error {
+			err := a.streamActions(ctx)
+			if err != nil {
+				log.Printf("Action stream unavailable, polling for actions: %v", err)
+			}
+			return err
+		}
+
+		// Streams that fail to open or end straight away back off, so that a backend that accepts
+		// and then closes the stream isn't reconnected to in a tight loop. The backoff only resets
+		// once a stream has worked.
+		if err := retry.RetryExponential(ctx, fn, streamInitialBackoff, streamMaxBackoff); err != nil && ctx.Err() == nil {
+			log.Printf("Action stream error: %v", err)
+		}
+
+		// Even a stream that worked is reopened no sooner than the initial backoff.
+		select {
+		case <-ctx.Done():
+		case <-time.After(streamInitialBackoff):
+		}
+	}
+}
+
+// streamActions handles actions from a WatchActions stream until it ends. It returns an error if
+// the stream could not be opened, or if it ended before it delivered a response or stayed open for
+// streamHealthyAfter.
+func (a *Agent) streamActions(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	responses, errs, err := a.client.WatchActions(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { go drain(responses, errs) }()
+
+	log.Printf("Watching for actions.")
+	a.streaming.Store(true)
+	defer a.streaming.Store(false)
+
+	idle := time.NewTimer(streamIdleTimeout)
+	defer idle.Stop()
+
+	opened := time.Now()
+	responded := false
+	ended := func(err error) error {
+		if responded || time.Since(opened) >= streamHealthyAfter || ctx.Err() != nil {
+			return nil
+		}
+		return errors.Join(errStreamEnded, err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-idle.C:
+			log.Printf("No response on the action stream for %s, reopening it.", streamIdleTimeout)
+			return nil
+		case err := <-errs:
+			log.Printf("Action stream error: %v", err)
+			return ended(err)
+		case resp, ok := <-responses:
+			if !ok {
+				log.Printf("Action stream closed by the backend.")
+				return ended(nil)
+			}
+
+			responded = true
+			if resp.GetAction() != nil {
+				a.handleAction(ctx, resp.GetAction())
+			}
+			idle.Reset(streamIdleTimeout)
+		}
+	}
+}
+
+// drain consumes a cancelled stream until its reader stops, so that the reader isn't left blocked
+// sending to channels nobody receives from.
+func drain(responses <-chan *service_pb.WatchActionsResponse, errs <-chan error) {
+	for {
+		select {
+		case _, ok := <-responses:
+			if !ok {
+				return
+			}
+		case <-errs:
+			return
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"context"
+	"log"
+
+	"agent/cluster"
+	"agent/generated/service_pb"
+)
+
+func (a *Agent) restartWorkloads(ctx context.Context, action *service_pb.RestartWorkloadsRequest) (*service_pb.ActionResult, error) {
+	releaseName, namespace, err := a.target(action.GetReleaseName(), action.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := cluster.Self(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	workloads, err := c.RestartWorkloads(ctx, releaseName, namespace, action.GetLabelSelector())
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Restarted %d workloads of release %s/%s.", len(workloads), namespace, releaseName)
+
+	return &service_pb.ActionResult{Workloads: workloadResults(workloads...)}, nil
+}
+
+// scaleWorkload scales one of the release's workloads. The replicas last until the release is next
+// upgraded, which sets them back to the chart's.
+func (a *Agent) scaleWorkload(ctx context.Context, action *service_pb.ScaleWorkloadRequest) (*service_pb.ActionResult, error) {
+	releaseName, namespace, err := a.target(action.GetReleaseName(), action.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := cluster.Self(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	workload, err := c.ScaleWorkload(ctx, releaseName, namespace, action.GetKind(), action.GetName(), action.GetReplicas())
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Scaled %s %s/%s to %d replicas.", workload.Kind, namespace, workload.Name, workload.Replicas)
+
+	return &service_pb.ActionResult{Workloads: workloadResults(workload)}, nil
+}
+
+func workloadResults(workloads ...cluster.Workload) []*service_pb.Workload {
+	results := make([]*service_pb.Workload, 0, len(workloads))
+	for _, w := range workloads {
+		results = append(results, &service_pb.Workload{
+			Kind:      w.Kind,
+			Namespace: w.Namespace,
+			Name:      w.Name,
+			Replicas:  w.Replicas,
+		})
+	}
+	return results
+}
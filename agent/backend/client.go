@@ -2,11 +2,13 @@ package backend
 
 import (
 	"context"
-	"fmt"
 	"log"
 	"net/http"
+	"sync/atomic"
+	"time"
 
 	"github.com/akuity/grpc-gateway-client/pkg/grpc/gateway"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	service_pb "agent/generated/service_pb"
 )
@@ -16,38 +18,56 @@ type Identity struct {
 	SessionID   string
 	Name        string
 	VersionID   string
+
+	AgentVersion string
+	AgentCommit  string
 }
 
 type Client struct {
 	client   service_pb.OnPremGatewayClient
 	identity Identity
+
+	// cluster is sent as part of the identity once it has been collected.
+	cluster atomic.Pointer[service_pb.ClusterInfo]
+
+	tokens *tokenSource
 }
 
-func NewClient(addr string, bearerToken string, identity Identity) (*Client, error) {
+func NewClient(addr string, creds Credentials, identity Identity, transportCfg TransportConfig) (*Client, error) {
 	log.Printf("Attempting to connect to gRPC server at %s", addr)
-	client := &http.Client{
-		Transport: &defaultHeaderTransport{
-			headers: map[string]string{
-				"Authorization": fmt.Sprintf("Bearer %s", bearerToken),
-			},
-			rt: http.DefaultTransport,
+	transport, err := newTransport(transportCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	exchangeClient := service_pb.NewOnPremGatewayClient(gateway.NewClient(addr, gateway.WithHTTPClient(&http.Client{
+		Transport: &bootstrapTransport{rt: transport},
+	})))
+
+	c := &Client{identity: identity}
+	c.tokens = &tokenSource{
+		creds: creds,
+		exchange: func(ctx context.Context, bootstrap string) (*service_pb.ExchangeTokenResponse, error) {
+			return exchangeClient.ExchangeToken(context.WithValue(ctx, bootstrapTokenKey{}, bootstrap), &service_pb.ExchangeTokenRequest{
+				Identity: c.protoIdentity(),
+			})
 		},
+		now: time.Now,
 	}
+	if err := c.tokens.loadBootstrap(); err != nil {
+		return nil, err
+	}
+
+	c.client = service_pb.NewOnPremGatewayClient(gateway.NewClient(addr, gateway.WithHTTPClient(&http.Client{
+		Transport: &tokenTransport{tokens: c.tokens, rt: transport},
+	})))
 
-	return &Client{
-		client:   service_pb.NewOnPremGatewayClient(gateway.NewClient(addr, gateway.WithHTTPClient(client))),
-		identity: identity,
-	}, nil
+	return c, nil
 }
 
 func (c *Client) Apply(ctx context.Context) (*service_pb.Action, error) {
 	resp, err := c.client.Apply(ctx, &service_pb.ApplyRequest{
-		Identity: &service_pb.Identity{
-			LifecycleId: c.identity.LifecycleID,
-			SessionId:   c.identity.SessionID,
-			Name:        c.identity.Name,
-			VersionId:   c.identity.VersionID,
-		},
+		Identity: c.protoIdentity(),
 	})
 	if err != nil {
 		return nil, err
@@ -56,29 +76,83 @@ func (c *Client) Apply(ctx context.Context) (*service_pb.Action, error) {
 	return resp.Action, nil
 }
 
-func (c *Client) Heartbeat(ctx context.Context) error {
-	_, err := c.client.Heartbeat(ctx, &service_pb.HeartbeatRequest{
-		Identity: &service_pb.Identity{
-			LifecycleId: c.identity.LifecycleID,
-			SessionId:   c.identity.SessionID,
-			Name:        c.identity.Name,
-			VersionId:   c.identity.VersionID,
-		},
+// WatchActions opens a stream of actions from the backend. Responses without an action are
+// keepalives. The stream is closed when ctx is done.
+func (c *Client) WatchActions(ctx context.Context) (<-chan *service_pb.WatchActionsResponse, <-chan error, error) {
+	return c.client.WatchActions(ctx, &service_pb.WatchActionsRequest{
+		Identity: c.protoIdentity(),
+	})
+}
+
+// NewHeartbeat stamps a heartbeat, which tells the backend the agent is alive, with the agent's
+// identity and the current time, to be sent now or later with SendHeartbeat. health may be nil if
+// it could not be collected.
+func (c *Client) NewHeartbeat(health *service_pb.HealthSnapshot) *service_pb.HeartbeatRequest {
+	return &service_pb.HeartbeatRequest{
+		Identity:    c.protoIdentity(),
+		Health:      health,
+		CollectedAt: timestamppb.Now(),
+	}
+}
+
+func (c *Client) SendHeartbeat(ctx context.Context, req *service_pb.HeartbeatRequest) error {
+	_, err := c.client.Heartbeat(ctx, req)
+	return err
+}
+
+// NewActionResult stamps the outcome of an action received from the backend with the agent's
+// identity and the current time, to be sent now or later with SendActionResult.
+func (c *Client) NewActionResult(result *service_pb.ActionResult) *service_pb.ReportActionResultRequest {
+	return &service_pb.ReportActionResultRequest{
+		Identity:    c.protoIdentity(),
+		Result:      result,
+		CollectedAt: timestamppb.Now(),
+	}
+}
+
+func (c *Client) SendActionResult(ctx context.Context, req *service_pb.ReportActionResultRequest) error {
+	_, err := c.client.ReportActionResult(ctx, req)
+	return err
+}
+
+// UploadLogs sends a batch of the supervised process's output. dropped is how many lines were
+// dropped since the previous batch.
+func (c *Client) UploadLogs(ctx context.Context, lines []*service_pb.LogLine, dropped int64) error {
+	_, err := c.client.UploadLogs(ctx, &service_pb.UploadLogsRequest{
+		Identity:     c.protoIdentity(),
+		Lines:        lines,
+		DroppedLines: dropped,
 	})
 	return err
 }
 
-// custom transport that adds headers
-type defaultHeaderTransport struct {
-	headers map[string]string
-	rt      http.RoundTripper
+// NewSessionRecording stamps the recording of an SSH session with the agent's identity, to be sent
+// now or later with SendSessionRecording.
+func (c *Client) NewSessionRecording(recording *service_pb.SessionRecording) *service_pb.UploadSessionRecordingRequest {
+	return &service_pb.UploadSessionRecordingRequest{
+		Identity:  c.protoIdentity(),
+		Recording: recording,
+	}
+}
+
+func (c *Client) SendSessionRecording(ctx context.Context, req *service_pb.UploadSessionRecordingRequest) error {
+	_, err := c.client.UploadSessionRecording(ctx, req)
+	return err
+}
+
+// SetClusterInfo sets the cluster facts sent with every request from now on.
+func (c *Client) SetClusterInfo(info *service_pb.ClusterInfo) {
+	c.cluster.Store(info)
 }
 
-func (dht *defaultHeaderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	for key, value := range dht.headers {
-		if req.Header.Get(key) == "" { // only add if not already set
-			req.Header.Set(key, value)
-		}
+func (c *Client) protoIdentity() *service_pb.Identity {
+	return &service_pb.Identity{
+		LifecycleId:  c.identity.LifecycleID,
+		SessionId:    c.identity.SessionID,
+		Name:         c.identity.Name,
+		VersionId:    c.identity.VersionID,
+		AgentVersion: c.identity.AgentVersion,
+		AgentCommit:  c.identity.AgentCommit,
+		Cluster:      c.cluster.Load(),
 	}
-	return dht.rt.RoundTrip(req)
 }
@@ -1,15 +1,25 @@
 package backend
 
 import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	service_pb "agent/generated/service_pb"
 )
 
 func TestNewClient(t *testing.T) {
 	tests := []struct {
-		name        string
-		addr        string
-		bearerToken string
-		wantErr     bool
+		name            string
+		addr            string
+		bearerToken     string
+		bearerTokenFile string
+		transport       TransportConfig
+		wantErr         bool
 	}{
 		{
 			name:        "valid client creation",
@@ -17,15 +27,35 @@ func TestNewClient(t *testing.T) {
 			bearerToken: "test-token",
 			wantErr:     false,
 		},
+		{
+			name:        "missing CA bundle",
+			addr:        "http://localhost:8080",
+			bearerToken: "test-token",
+			transport:   TransportConfig{CAFile: "/nonexistent/ca.pem"},
+			wantErr:     true,
+		},
+		{
+			name:        "invalid pinned fingerprint",
+			addr:        "http://localhost:8080",
+			bearerToken: "test-token",
+			transport:   TransportConfig{PinnedFingerprints: []string{"not-a-fingerprint"}},
+			wantErr:     true,
+		},
+		{
+			name:            "missing bearer token file",
+			addr:            "http://localhost:8080",
+			bearerTokenFile: "/nonexistent/token",
+			wantErr:         true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := NewClient(tt.addr, tt.bearerToken, Identity{
+			_, err := NewClient(tt.addr, Credentials{BootstrapToken: tt.bearerToken, BootstrapTokenFile: tt.bearerTokenFile}, Identity{
 				LifecycleID: "test-lifecycle-id",
 				SessionID:  "test-session-id",
 				Name:        "test-name",
-			})
+			}, tt.transport)
 			if !tt.wantErr && err != nil {
 				t.Errorf("NewClient() returned error: %v", err)
 			}
@@ -35,3 +65,105 @@ func TestNewClient(t *testing.T) {
 		})
 	}
 }
+
+func TestSendActionResult(t *testing.T) {
+	var gotPath, gotAuth string
+	var got service_pb.ReportActionResultRequest
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("failed to read body: %v", err)
+		}
+		if err := protojson.Unmarshal(body, &got); err != nil {
+			t.Fatalf("failed to unmarshal body: %v", err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL, Credentials{BootstrapToken: "test-token"}, Identity{
+		LifecycleID: "test-lifecycle-id",
+		SessionID:   "test-session-id",
+		Name:        "test-name",
+	}, TransportConfig{})
+	if err != nil {
+		t.Fatalf("NewClient() returned error: %v", err)
+	}
+
+	err = c.SendActionResult(context.Background(), c.NewActionResult(&service_pb.ActionResult{
+		ActionId:        "action-id",
+		State:           service_pb.ActionState_ACTION_STATE_FAILED,
+		Error:           "upgrade failed",
+		ReleaseRevision: 3,
+	}))
+	if err != nil {
+		t.Fatalf("SendActionResult() returned error: %v", err)
+	}
+
+	if gotPath != "/action_result" {
+		t.Errorf("Expected path /action_result, got %s", gotPath)
+	}
+	if gotAuth != "Bearer test-token" {
+		t.Errorf("Expected bearer token header, got %q", gotAuth)
+	}
+	if got.GetIdentity().GetLifecycleId() != "test-lifecycle-id" {
+		t.Errorf("Expected lifecycle id test-lifecycle-id, got %s", got.GetIdentity().GetLifecycleId())
+	}
+	if got.GetResult().GetActionId() != "action-id" || got.GetResult().GetState() != service_pb.ActionState_ACTION_STATE_FAILED {
+		t.Errorf("Unexpected result: %v", got.GetResult())
+	}
+}
+
+func TestWatchActions(t *testing.T) {
+	var gotPath, gotAccept string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAccept = r.Header.Get("Accept")
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"result\":{}}\n\n"))
+		w.Write([]byte("data: {\"result\":{\"action\":{\"id\":\"action-1\"}}}\n\n"))
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL, Credentials{BootstrapToken: "test-token"}, Identity{Name: "test-name"}, TransportConfig{})
+	if err != nil {
+		t.Fatalf("NewClient() returned error: %v", err)
+	}
+
+	responses, errs, err := c.WatchActions(context.Background())
+	if err != nil {
+		t.Fatalf("WatchActions() returned error: %v", err)
+	}
+
+	var got []*service_pb.WatchActionsResponse
+	for done := false; !done; {
+		select {
+		case resp, ok := <-responses:
+			if !ok {
+				done = true
+				break
+			}
+			got = append(got, resp)
+		case err := <-errs:
+			t.Fatalf("stream returned error: %v", err)
+		}
+	}
+
+	if gotPath != "/watch_actions" {
+		t.Errorf("Expected path /watch_actions, got %s", gotPath)
+	}
+	if gotAccept != "text/event-stream" {
+		t.Errorf("Expected to accept an event stream, got %q", gotAccept)
+	}
+	if len(got) != 2 || got[0].GetAction() != nil || got[1].GetAction().GetId() != "action-1" {
+		t.Errorf("Expected a keepalive then action-1, got %v", got)
+	}
+}
@@ -0,0 +1,192 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	service_pb "agent/generated/service_pb"
+)
+
+const (
+	// refreshFraction is how far through an access token's lifetime it is replaced, leaving time
+	// to retry the exchange before it expires.
+	refreshFraction = 0.8
+
+	// unsupportedRetryInterval is how long the bootstrap token is used directly before the exchange
+	// is tried again, after the backend did not issue an access token.
+	unsupportedRetryInterval = time.Hour
+)
+
+// Credentials are the long-lived bootstrap token the agent was installed with. It is only sent to
+// the backend to exchange it for short-lived access tokens, unless the backend does not issue them.
+type Credentials struct {
+	BootstrapToken string
+
+	// BootstrapTokenFile, if set, is read for the bootstrap token instead of BootstrapToken, and
+	// read again when it changes, eg: when a mounted Secret is rotated.
+	BootstrapTokenFile string
+}
+
+// tokenSource hands out the access token for requests to the backend, exchanging the bootstrap
+// token for a new one when it is close to expiry.
+type tokenSource struct {
+	creds    Credentials
+	exchange func(ctx context.Context, bootstrap string) (*service_pb.ExchangeTokenResponse, error)
+	now      func() time.Time
+
+	mu sync.Mutex
+
+	bootstrap    string
+	bootstrapMod time.Time
+
+	accessToken string
+	refreshAt   time.Time
+
+	// unsupportedUntil is when to try the exchange again after the backend did not issue an
+	// access token. The bootstrap token is used directly until then.
+	unsupportedUntil time.Time
+}
+
+// Token returns the bearer token to send with a request.
+func (ts *tokenSource) Token(ctx context.Context) (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ts.loadBootstrap(); err != nil {
+		return "", err
+	}
+
+	now := ts.now()
+	if ts.accessToken != "" && now.Before(ts.refreshAt) {
+		return ts.accessToken, nil
+	}
+	if now.Before(ts.unsupportedUntil) {
+		return ts.bootstrap, nil
+	}
+
+	resp, err := ts.exchange(ctx, ts.bootstrap)
+	if status.Code(err) == codes.Unimplemented || (err == nil && resp.GetAccessToken() == "") {
+		log.Printf("Backend does not issue access tokens, using the bootstrap token")
+		ts.accessToken = ""
+		ts.unsupportedUntil = now.Add(unsupportedRetryInterval)
+		return ts.bootstrap, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to exchange bootstrap token: %w", err)
+	}
+
+	ts.accessToken = resp.GetAccessToken()
+	ts.refreshAt = now
+	if expiresAt := resp.GetExpiresAt().AsTime(); expiresAt.After(now) {
+		ts.refreshAt = now.Add(time.Duration(float64(expiresAt.Sub(now)) * refreshFraction))
+	}
+
+	return ts.accessToken, nil
+}
+
+// Invalidate discards token after the backend rejected it, so that the next request exchanges the
+// bootstrap token again.
+func (ts *tokenSource) Invalidate(token string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	switch token {
+	case ts.accessToken:
+		ts.accessToken = ""
+	case ts.bootstrap:
+		// The backend may have started requiring access tokens.
+		ts.unsupportedUntil = time.Time{}
+	}
+}
+
+// loadBootstrap reads the bootstrap token file if it changed since it was last read. A new
+// bootstrap token invalidates the access token exchanged for the previous one.
+func (ts *tokenSource) loadBootstrap() error {
+	if ts.creds.BootstrapTokenFile == "" {
+		ts.bootstrap = ts.creds.BootstrapToken
+		return nil
+	}
+
+	info, err := os.Stat(ts.creds.BootstrapTokenFile)
+	if err != nil {
+		return fmt.Errorf("failed to read bootstrap token: %w", err)
+	}
+	if ts.bootstrap != "" && info.ModTime().Equal(ts.bootstrapMod) {
+		return nil
+	}
+
+	data, err := os.ReadFile(ts.creds.BootstrapTokenFile)
+	if err != nil {
+		return fmt.Errorf("failed to read bootstrap token: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return errors.New("bootstrap token file is empty")
+	}
+
+	if ts.bootstrap != "" && token != ts.bootstrap {
+		log.Printf("Bootstrap token changed, exchanging it for a new access token")
+		ts.accessToken = ""
+		ts.unsupportedUntil = time.Time{}
+	}
+	ts.bootstrap = token
+	ts.bootstrapMod = info.ModTime()
+
+	return nil
+}
+
+// tokenTransport authenticates requests with the token source's current token.
+type tokenTransport struct {
+	tokens *tokenSource
+	rt     http.RoundTripper
+}
+
+func (tt *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := tt.tokens.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := tt.rt.RoundTrip(req)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		tt.tokens.Invalidate(token)
+	}
+	return resp, err
+}
+
+// bootstrapTransport authenticates token exchanges with the bootstrap token passed in the context.
+type bootstrapTransport struct {
+	rt http.RoundTripper
+}
+
+type bootstrapTokenKey struct{}
+
+func (bt *bootstrapTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, _ := req.Context().Value(bootstrapTokenKey{}).(string)
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return bt.rt.RoundTrip(req)
+}
+
+// Redact hides all but the end of a secret, so that it can be recognised in logs.
+func Redact(secret string) string {
+	if len(secret) <= 12 {
+		return strings.Repeat("*", len(secret))
+	}
+	return "****" + secret[len(secret)-4:]
+}
@@ -0,0 +1,192 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	service_pb "agent/generated/service_pb"
+)
+
+// fakeExchange issues access tokens named after the bootstrap token and a counter, valid for ttl.
+type fakeExchange struct {
+	now   *time.Time
+	ttl   time.Duration
+	err   error
+	calls []string
+}
+
+func (f *fakeExchange) exchange(ctx context.Context, bootstrap string) (*service_pb.ExchangeTokenResponse, error) {
+	f.calls = append(f.calls, bootstrap)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &service_pb.ExchangeTokenResponse{
+		AccessToken: fmt.Sprintf("%s-access-%d", bootstrap, len(f.calls)),
+		ExpiresAt:   timestamppb.New(f.now.Add(f.ttl)),
+	}, nil
+}
+
+func newTestTokenSource(creds Credentials, f *fakeExchange) *tokenSource {
+	return &tokenSource{
+		creds:    creds,
+		exchange: f.exchange,
+		now:      func() time.Time { return *f.now },
+	}
+}
+
+func mustToken(t *testing.T, ts *tokenSource, want string) {
+	t.Helper()
+	got, err := ts.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token() returned error: %v", err)
+	}
+	if got != want {
+		t.Errorf("Expected token %q, got %q", want, got)
+	}
+}
+
+func TestTokenSourceRefresh(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := &fakeExchange{now: &now, ttl: 10 * time.Minute}
+	ts := newTestTokenSource(Credentials{BootstrapToken: "bootstrap"}, f)
+
+	mustToken(t, ts, "bootstrap-access-1")
+
+	now = now.Add(7 * time.Minute)
+	mustToken(t, ts, "bootstrap-access-1")
+
+	// Refreshed before the token expires.
+	now = now.Add(time.Minute)
+	mustToken(t, ts, "bootstrap-access-2")
+
+	ts.Invalidate("bootstrap-access-2")
+	mustToken(t, ts, "bootstrap-access-3")
+
+	f.err = status.Error(codes.Unauthenticated, "revoked")
+	ts.Invalidate("bootstrap-access-3")
+	if _, err := ts.Token(context.Background()); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected revoked bootstrap token to fail, got %v", err)
+	}
+}
+
+func TestTokenSourceUnsupported(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := &fakeExchange{now: &now, ttl: 10 * time.Minute, err: status.Error(codes.Unimplemented, "not found")}
+	ts := newTestTokenSource(Credentials{BootstrapToken: "bootstrap"}, f)
+
+	mustToken(t, ts, "bootstrap")
+	mustToken(t, ts, "bootstrap")
+	if len(f.calls) != 1 {
+		t.Errorf("Expected 1 exchange, got %d", len(f.calls))
+	}
+
+	// The backend starts issuing access tokens and rejects the bootstrap token.
+	f.err = nil
+	ts.Invalidate("bootstrap")
+	mustToken(t, ts, "bootstrap-access-2")
+}
+
+func TestTokenSourceFileRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("first\n"), 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := &fakeExchange{now: &now, ttl: time.Hour}
+	ts := newTestTokenSource(Credentials{BootstrapToken: "ignored", BootstrapTokenFile: path}, f)
+
+	mustToken(t, ts, "first-access-1")
+
+	if err := os.WriteFile(path, []byte("second\n"), 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Make sure the change is visible even on filesystems with coarse timestamps.
+	if err := os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	mustToken(t, ts, "second-access-2")
+
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := os.Chtimes(path, time.Now(), time.Now().Add(2*time.Minute)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := ts.Token(context.Background()); err == nil {
+		t.Error("Expected an empty token file to fail")
+	}
+}
+
+func TestClientExchangesToken(t *testing.T) {
+	var exchangeAuth, heartbeatAuth []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/exchange_token":
+			exchangeAuth = append(exchangeAuth, r.Header.Get("Authorization"))
+			fmt.Fprintf(w, `{"accessToken":"access-%d","expiresAt":%q}`, len(exchangeAuth), time.Now().Add(time.Hour).Format(time.RFC3339))
+		case "/heartbeat":
+			heartbeatAuth = append(heartbeatAuth, r.Header.Get("Authorization"))
+			if len(heartbeatAuth) == 2 {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"code":16,"message":"token revoked"}`))
+				return
+			}
+			w.Write([]byte("{}"))
+		}
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL, Credentials{BootstrapToken: "bootstrap"}, Identity{Name: "test-name"}, TransportConfig{})
+	if err != nil {
+		t.Fatalf("NewClient() returned error: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		err := c.SendHeartbeat(context.Background(), c.NewHeartbeat(nil))
+		if wantErr := i == 1; (err != nil) != wantErr {
+			t.Errorf("SendHeartbeat() %d error = %v, wantErr %v", i, err, wantErr)
+		}
+	}
+
+	wantExchange := []string{"Bearer bootstrap", "Bearer bootstrap"}
+	wantHeartbeat := []string{"Bearer access-1", "Bearer access-1", "Bearer access-2"}
+	if fmt.Sprint(exchangeAuth) != fmt.Sprint(wantExchange) {
+		t.Errorf("Expected exchanges with %v, got %v", wantExchange, exchangeAuth)
+	}
+	if fmt.Sprint(heartbeatAuth) != fmt.Sprint(wantHeartbeat) {
+		t.Errorf("Expected heartbeats with %v, got %v", wantHeartbeat, heartbeatAuth)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		secret   string
+		expected string
+	}{
+		{"", ""},
+		{"short", "*****"},
+		{"a-much-longer-secret-token", "****oken"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.secret, func(t *testing.T) {
+			if got := Redact(tt.secret); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
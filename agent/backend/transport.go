@@ -0,0 +1,116 @@
+package backend
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// TransportConfig configures how the client connects to the backend. The zero value connects with
+// the system's root CAs, through the proxy named by the standard proxy environment variables if any.
+type TransportConfig struct {
+	// ProxyURL routes requests through an HTTP(S) proxy. Credentials may be given as the URL's userinfo.
+	ProxyURL string
+
+	// CAFile is a PEM bundle of CAs to trust in addition to the system's, eg: a TLS-intercepting proxy's.
+	CAFile string
+
+	// ClientCertFile and ClientKeyFile are a PEM certificate and key presented for mutual TLS.
+	ClientCertFile string
+	ClientKeyFile  string
+
+	// PinnedFingerprints are SHA-256 fingerprints of certificates, in hex, one of which must be in
+	// the chain the backend presents.
+	PinnedFingerprints []string
+}
+
+func newTransport(cfg TransportConfig) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if cfg.ProxyURL != "" {
+		proxyURL, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			// The URL may contain credentials, so it is left out of the error.
+			return nil, errors.New("invalid proxy URL")
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", cfg.CAFile)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.ClientCertFile != "" || cfg.ClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCertFile, cfg.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(cfg.PinnedFingerprints) > 0 {
+		pins := map[string]bool{}
+		for _, fp := range cfg.PinnedFingerprints {
+			pin, err := parseFingerprint(fp)
+			if err != nil {
+				return nil, err
+			}
+			pins[pin] = true
+		}
+		tlsConfig.VerifyConnection = verifyPinned(pins)
+	}
+
+	transport.TLSClientConfig = tlsConfig
+
+	return transport, nil
+}
+
+// verifyPinned checks, after the usual chain verification, that one of the certificates the server
+// presented is pinned.
+func verifyPinned(pins map[string]bool) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		for _, cert := range cs.PeerCertificates {
+			sum := sha256.Sum256(cert.Raw)
+			if pins[hex.EncodeToString(sum[:])] {
+				return nil
+			}
+		}
+		return errors.New("backend certificate does not match any pinned fingerprint")
+	}
+}
+
+// parseFingerprint accepts a hex SHA-256 fingerprint in either case, with or without colons and a
+// "sha256:" prefix.
+func parseFingerprint(fp string) (string, error) {
+	pin := strings.ToLower(strings.TrimSpace(fp))
+	pin = strings.TrimPrefix(pin, "sha256:")
+	pin = strings.ReplaceAll(pin, ":", "")
+
+	if b, err := hex.DecodeString(pin); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("invalid SHA-256 fingerprint %q", fp)
+	}
+
+	return pin, nil
+}
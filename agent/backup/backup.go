@@ -0,0 +1,126 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// instanceLabel is set by Helm charts on the release's resources, it selects the volumes to snapshot.
+	instanceLabel = "app.kubernetes.io/instance"
+
+	// The labels of the objects backups create. They don't use instanceLabel, so that the release's
+	// own selectors, eg: of its Services and PodDisruptionBudgets, don't match the backup Job's pod.
+	releaseLabel  = "shepherd.trustshepherd.com/release"
+	revisionLabel = "shepherd.trustshepherd.com/revision"
+	backupLabel   = "shepherd.trustshepherd.com/backup"
+)
+
+// Config selects and configures the backups that run before an upgrade.
+type Config struct {
+	// JobImage enables a backup that runs JobCommand with `sh -c` in a Job using this image.
+	// JobCommand is required if JobImage is set.
+	JobImage   string
+	JobCommand string
+
+	// JobServiceAccountName is the service account the Job runs as. Empty uses the namespace default.
+	JobServiceAccountName string
+
+	// VolumeSnapshots enables CSI VolumeSnapshots of the release's PersistentVolumeClaims.
+	VolumeSnapshots bool
+
+	// VolumeSnapshotClassName is the VolumeSnapshotClass used for snapshots. Empty uses the cluster default.
+	VolumeSnapshotClassName string
+
+	// Timeout bounds how long each backup may take to complete.
+	Timeout time.Duration
+}
+
+// Validate checks that the configured backups can run.
+func (c Config) Validate() error {
+	if c.JobImage != "" && strings.TrimSpace(c.JobCommand) == "" {
+		return errors.New("the backup job image is set without a backup job command")
+	}
+	return nil
+}
+
+// Backup takes a backup of a release before it is upgraded.
+type Backup interface {
+	// Name identifies the backup implementation in logs and references.
+	Name() string
+
+	// Run takes the backup and blocks until it has completed successfully, returning references
+	// to everything it created.
+	Run(ctx context.Context, target Target) ([]Reference, error)
+}
+
+// Target is the release revision being backed up.
+type Target struct {
+	ReleaseName string
+	Namespace   string
+	Revision    int
+}
+
+// Reference locates a completed backup in the cluster.
+type Reference struct {
+	Backup    string    `json:"backup"`
+	Kind      string    `json:"kind"`
+	Name      string    `json:"name"`
+	Namespace string    `json:"namespace"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Runner runs every configured backup for a release and records the results in a Store.
+type Runner struct {
+	backups []Backup
+	store   *Store
+}
+
+func NewRunner(store *Store, backups ...Backup) *Runner {
+	return &Runner{
+		backups: backups,
+		store:   store,
+	}
+}
+
+// Enabled reports whether any backups are configured.
+func (r *Runner) Enabled() bool {
+	return len(r.backups) > 0
+}
+
+// Run runs each backup in order and stops at the first failure. References are only recorded
+// against the target revision once every backup has succeeded.
+func (r *Runner) Run(ctx context.Context, target Target) ([]Reference, error) {
+	var refs []Reference
+	for _, b := range r.backups {
+		log.Printf("Running %s backup of release %q revision %d", b.Name(), target.ReleaseName, target.Revision)
+
+		bRefs, err := b.Run(ctx, target)
+		if err != nil {
+			return nil, fmt.Errorf("%s backup failed: %w", b.Name(), err)
+		}
+
+		refs = append(refs, bRefs...)
+	}
+
+	if err := r.store.Record(ctx, target, refs); err != nil {
+		return nil, fmt.Errorf("failed to record backup references: %w", err)
+	}
+
+	log.Printf("Backed up release %q revision %d (%d references)", target.ReleaseName, target.Revision, len(refs))
+
+	return refs, nil
+}
+
+func labels(target Target, backup string) map[string]string {
+	return map[string]string{
+		releaseLabel:  target.ReleaseName,
+		revisionLabel: strconv.Itoa(target.Revision),
+		backupLabel:   backup,
+	}
+}
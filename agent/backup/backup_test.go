@@ -0,0 +1,226 @@
+package backup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore(fake.NewClientset())
+	target := Target{ReleaseName: "my-release", Namespace: "default", Revision: 3}
+
+	refs, err := store.Find(ctx, target.ReleaseName, target.Namespace, target.Revision)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if refs != nil {
+		t.Errorf("Expected no references before recording, got %v", refs)
+	}
+
+	want := []Reference{{Backup: "job", Kind: "Job", Name: "my-release-backup-3-abcde", Namespace: "default"}}
+	if err := store.Record(ctx, target, want); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	other := Target{ReleaseName: "my-release", Namespace: "default", Revision: 4}
+	if err := store.Record(ctx, other, []Reference{{Backup: "job", Name: "other"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	refs, err = store.Find(ctx, target.ReleaseName, target.Namespace, target.Revision)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(refs) != 1 || refs[0].Name != want[0].Name {
+		t.Errorf("Expected %v, got %v", want, refs)
+	}
+}
+
+func TestJobBackup(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition batchv1.JobConditionType
+		wantErr   bool
+	}{
+		{"complete", batchv1.JobComplete, false},
+		{"failed", batchv1.JobFailed, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fakeJobClient(tt.condition)
+			b := NewJobBackup(client, Config{
+				JobImage:   "busybox",
+				JobCommand: "echo backup",
+				Timeout:    time.Second,
+			})
+
+			refs, err := b.Run(context.Background(), Target{ReleaseName: "my-release", Namespace: "default", Revision: 2})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if len(refs) != 1 || refs[0].Kind != "Job" || refs[0].Name != "my-release-backup-2-abcde" {
+				t.Errorf("Unexpected references: %v", refs)
+			}
+
+			job, err := client.BatchV1().Jobs("default").Get(context.Background(), refs[0].Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if job.Labels[revisionLabel] != "2" {
+				t.Errorf("Expected revision label 2, got %q", job.Labels[revisionLabel])
+			}
+		})
+	}
+}
+
+func TestRunnerStopsOnFailure(t *testing.T) {
+	client := fake.NewClientset()
+	runner := NewRunner(NewStore(client), NewJobBackup(fakeJobClient(batchv1.JobFailed), Config{
+		JobImage:   "busybox",
+		JobCommand: "echo backup",
+		Timeout:    time.Second,
+	}))
+
+	target := Target{ReleaseName: "my-release", Namespace: "default", Revision: 1}
+	if _, err := runner.Run(context.Background(), target); err == nil {
+		t.Fatal("Expected error from failed backup")
+	}
+
+	refs, err := NewStore(client).Find(context.Background(), target.ReleaseName, target.Namespace, target.Revision)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if refs != nil {
+		t.Errorf("Expected no references to be recorded, got %v", refs)
+	}
+}
+
+// fakeJobClient returns a client that names created Jobs and marks them with the given condition.
+func fakeJobClient(condition batchv1.JobConditionType) *fake.Clientset {
+	client := fake.NewClientset()
+
+	client.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		job := action.(k8stesting.CreateAction).GetObject().(*batchv1.Job)
+		job.Name = job.GenerateName + "abcde"
+		job.Status.Conditions = []batchv1.JobCondition{{
+			Type:   condition,
+			Status: corev1.ConditionTrue,
+		}}
+		return false, nil, nil
+	})
+
+	return client
+}
+
+func TestJobBackupPodLabels(t *testing.T) {
+	b := NewJobBackup(fake.NewClientset(), Config{JobImage: "busybox", JobCommand: "echo backup"})
+	job := b.job(Target{ReleaseName: "my-release", Namespace: "default", Revision: 2})
+
+	if _, ok := job.Spec.Template.Labels[instanceLabel]; ok {
+		t.Errorf("Expected the pod not to be selectable as part of the release, got labels %v", job.Spec.Template.Labels)
+	}
+	if job.Spec.Template.Labels[releaseLabel] != "my-release" {
+		t.Errorf("Expected the pod to be labelled with the release, got labels %v", job.Spec.Template.Labels)
+	}
+	if job.Spec.TTLSecondsAfterFinished == nil {
+		t.Error("Expected finished Jobs to be cleaned up")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"disabled", Config{}, false},
+		{"job", Config{JobImage: "busybox", JobCommand: "echo backup"}, false},
+		{"job without command", Config{JobImage: "busybox", JobCommand: " "}, true},
+	}
+
+	for _, tt := range tests {
+		if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSnapshotBackup(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  map[string]any
+		wantErr bool
+	}{
+		{"ready", map[string]any{"readyToUse": true}, false},
+		{"failed", map[string]any{"error": map[string]any{"message": "no snapshot class"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientset(
+				&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "data-my-release-0", Namespace: "default", Labels: map[string]string{instanceLabel: "my-release"}}},
+				&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "data-other-0", Namespace: "default", Labels: map[string]string{instanceLabel: "other"}}},
+			)
+			dynamic := fakeSnapshotClient(tt.status)
+			b := NewSnapshotBackup(client, dynamic, Config{VolumeSnapshotClassName: "csi-snapclass", Timeout: time.Second})
+
+			refs, err := b.Run(context.Background(), Target{ReleaseName: "my-release", Namespace: "default", Revision: 2})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if len(refs) != 1 || refs[0].Kind != "VolumeSnapshot" || refs[0].Name != "data-my-release-0-2-abcde" {
+				t.Fatalf("Unexpected references: %v", refs)
+			}
+
+			snapshot, err := dynamic.Resource(volumeSnapshotResource).Namespace("default").Get(context.Background(), refs[0].Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			pvc, _, _ := unstructured.NestedString(snapshot.Object, "spec", "source", "persistentVolumeClaimName")
+			class, _, _ := unstructured.NestedString(snapshot.Object, "spec", "volumeSnapshotClassName")
+			if pvc != "data-my-release-0" || class != "csi-snapclass" {
+				t.Errorf("Unexpected snapshot spec: %v", snapshot.Object["spec"])
+			}
+			if snapshot.GetLabels()[revisionLabel] != "2" {
+				t.Errorf("Expected revision label 2, got %q", snapshot.GetLabels()[revisionLabel])
+			}
+		})
+	}
+}
+
+// fakeSnapshotClient returns a client that names created VolumeSnapshots and gives them status.
+func fakeSnapshotClient(status map[string]any) *dynamicfake.FakeDynamicClient {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		volumeSnapshotResource: "VolumeSnapshotList",
+	})
+
+	client.PrependReactor("create", "volumesnapshots", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		snapshot := action.(k8stesting.CreateAction).GetObject().(*unstructured.Unstructured)
+		snapshot.SetName(snapshot.GetGenerateName() + "abcde")
+		snapshot.Object["status"] = status
+		return false, nil, nil
+	})
+
+	return client
+}
@@ -0,0 +1,128 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"agent/pointer"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	jobPollInterval = 2 * time.Second
+
+	// jobTTL is how long a finished Job and its pod are kept, so that its logs can be read. The backup
+	// itself is wherever the command stored it, so the Job's reference outlives the Job.
+	jobTTL = 7 * 24 * time.Hour
+)
+
+// JobBackup runs the configured command with `sh -c` in a Job and waits for it to complete.
+//
+// The command receives the release being backed up in the SHEPHERD_RELEASE_NAME,
+// SHEPHERD_RELEASE_NAMESPACE and SHEPHERD_RELEASE_REVISION environment variables.
+type JobBackup struct {
+	client kubernetes.Interface
+	cfg    Config
+}
+
+func NewJobBackup(client kubernetes.Interface, cfg Config) *JobBackup {
+	return &JobBackup{
+		client: client,
+		cfg:    cfg,
+	}
+}
+
+func (j *JobBackup) Name() string {
+	return "job"
+}
+
+func (j *JobBackup) Run(ctx context.Context, target Target) ([]Reference, error) {
+	job, err := j.client.BatchV1().Jobs(target.Namespace).Create(ctx, j.job(target), metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup job: %w", err)
+	}
+
+	if err := j.wait(ctx, job); err != nil {
+		return nil, err
+	}
+
+	return []Reference{{
+		Backup:    j.Name(),
+		Kind:      "Job",
+		Name:      job.Name,
+		Namespace: job.Namespace,
+		CreatedAt: time.Now(),
+	}}, nil
+}
+
+func (j *JobBackup) job(target Target) *batchv1.Job {
+	l := labels(target, j.Name())
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: fmt.Sprintf("%s-backup-%d-", target.ReleaseName, target.Revision),
+			Namespace:    target.Namespace,
+			Labels:       l,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            pointer.To(int32(0)),
+			TTLSecondsAfterFinished: pointer.To(int32(jobTTL.Seconds())),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: l},
+				Spec: corev1.PodSpec{
+					RestartPolicy:      corev1.RestartPolicyNever,
+					ServiceAccountName: j.cfg.JobServiceAccountName,
+					Containers: []corev1.Container{{
+						Name:    "backup",
+						Image:   j.cfg.JobImage,
+						Command: []string{"sh", "-c", j.cfg.JobCommand},
+						Env: []corev1.EnvVar{
+							{Name: "SHEPHERD_RELEASE_NAME", Value: target.ReleaseName},
+							{Name: "SHEPHERD_RELEASE_NAMESPACE", Value: target.Namespace},
+							{Name: "SHEPHERD_RELEASE_REVISION", Value: strconv.Itoa(target.Revision)},
+						},
+					}},
+				},
+			},
+		},
+	}
+}
+
+// wait blocks until the Job completes, fails, or the timeout expires.
+func (j *JobBackup) wait(ctx context.Context, job *batchv1.Job) error {
+	jobs := j.client.BatchV1().Jobs(job.Namespace)
+
+	err := wait.PollUntilContextTimeout(ctx, jobPollInterval, j.cfg.Timeout, true, func(ctx context.Context) (bool, error) {
+		current, err := jobs.Get(ctx, job.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+
+		for _, c := range current.Status.Conditions {
+			if c.Status != corev1.ConditionTrue {
+				continue
+			}
+
+			switch c.Type {
+			case batchv1.JobComplete:
+				return true, nil
+			case batchv1.JobFailed:
+				return false, fmt.Errorf("backup job %s failed: %s", job.Name, c.Message)
+			}
+		}
+
+		return false, nil
+	})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("backup job %s did not complete within %s", job.Name, j.cfg.Timeout)
+	}
+
+	return err
+}
@@ -0,0 +1,121 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const snapshotPollInterval = 2 * time.Second
+
+var volumeSnapshotResource = schema.GroupVersionResource{
+	Group:    "snapshot.storage.k8s.io",
+	Version:  "v1",
+	Resource: "volumesnapshots",
+}
+
+// SnapshotBackup takes a CSI VolumeSnapshot of every PersistentVolumeClaim labelled with the
+// release's instance label and waits for all of them to become ready to use.
+type SnapshotBackup struct {
+	client  kubernetes.Interface
+	dynamic dynamic.Interface
+	cfg     Config
+}
+
+func NewSnapshotBackup(client kubernetes.Interface, dynamic dynamic.Interface, cfg Config) *SnapshotBackup {
+	return &SnapshotBackup{
+		client:  client,
+		dynamic: dynamic,
+		cfg:     cfg,
+	}
+}
+
+func (s *SnapshotBackup) Name() string {
+	return "volume-snapshot"
+}
+
+func (s *SnapshotBackup) Run(ctx context.Context, target Target) ([]Reference, error) {
+	pvcs, err := s.client.CoreV1().PersistentVolumeClaims(target.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", instanceLabel, target.ReleaseName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persistent volume claims: %w", err)
+	}
+
+	snapshots := s.dynamic.Resource(volumeSnapshotResource).Namespace(target.Namespace)
+
+	refs := make([]Reference, 0, len(pvcs.Items))
+	for _, pvc := range pvcs.Items {
+		snapshot, err := snapshots.Create(ctx, s.snapshot(target, pvc.Name), metav1.CreateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create volume snapshot of %s: %w", pvc.Name, err)
+		}
+
+		refs = append(refs, Reference{
+			Backup:    s.Name(),
+			Kind:      "VolumeSnapshot",
+			Name:      snapshot.GetName(),
+			Namespace: target.Namespace,
+			CreatedAt: time.Now(),
+		})
+	}
+
+	for _, ref := range refs {
+		if err := s.wait(ctx, snapshots, ref.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	return refs, nil
+}
+
+func (s *SnapshotBackup) snapshot(target Target, pvcName string) *unstructured.Unstructured {
+	spec := map[string]any{
+		"source": map[string]any{
+			"persistentVolumeClaimName": pvcName,
+		},
+	}
+	if s.cfg.VolumeSnapshotClassName != "" {
+		spec["volumeSnapshotClassName"] = s.cfg.VolumeSnapshotClassName
+	}
+
+	u := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": volumeSnapshotResource.GroupVersion().String(),
+		"kind":       "VolumeSnapshot",
+		"spec":       spec,
+	}}
+	u.SetGenerateName(fmt.Sprintf("%s-%d-", pvcName, target.Revision))
+	u.SetNamespace(target.Namespace)
+	u.SetLabels(labels(target, s.Name()))
+
+	return u
+}
+
+// wait blocks until the snapshot is ready to use, reports an error, or the timeout expires.
+func (s *SnapshotBackup) wait(ctx context.Context, snapshots dynamic.ResourceInterface, name string) error {
+	err := wait.PollUntilContextTimeout(ctx, snapshotPollInterval, s.cfg.Timeout, true, func(ctx context.Context) (bool, error) {
+		current, err := snapshots.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+
+		if msg, ok, _ := unstructured.NestedString(current.Object, "status", "error", "message"); ok && msg != "" {
+			return false, fmt.Errorf("volume snapshot %s failed: %s", name, msg)
+		}
+
+		ready, _, _ := unstructured.NestedBool(current.Object, "status", "readyToUse")
+		return ready, nil
+	})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("volume snapshot %s was not ready within %s", name, s.cfg.Timeout)
+	}
+
+	return err
+}
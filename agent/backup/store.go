@@ -0,0 +1,85 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Store records backup references against release revisions in a ConfigMap next to the release,
+// so that a later rollback can find the backup taken of the revision it returns to.
+type Store struct {
+	client kubernetes.Interface
+}
+
+func NewStore(client kubernetes.Interface) *Store {
+	return &Store{client: client}
+}
+
+// Record stores refs as the backups of the target revision, replacing any previous record.
+func (s *Store) Record(ctx context.Context, target Target, refs []Reference) error {
+	data, err := json.Marshal(refs)
+	if err != nil {
+		return err
+	}
+
+	configMaps := s.client.CoreV1().ConfigMaps(target.Namespace)
+	key := strconv.Itoa(target.Revision)
+
+	cm, err := configMaps.Get(ctx, configMapName(target.ReleaseName), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = configMaps.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configMapName(target.ReleaseName),
+				Namespace: target.Namespace,
+				Labels:    map[string]string{releaseLabel: target.ReleaseName},
+			},
+			Data: map[string]string{key: string(data)},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[key] = string(data)
+
+	_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+	return err
+}
+
+// Find returns the backups recorded for a release revision, or nil if there are none.
+func (s *Store) Find(ctx context.Context, releaseName, namespace string, revision int) ([]Reference, error) {
+	cm, err := s.client.CoreV1().ConfigMaps(namespace).Get(ctx, configMapName(releaseName), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := cm.Data[strconv.Itoa(revision)]
+	if !ok {
+		return nil, nil
+	}
+
+	var refs []Reference
+	if err := json.Unmarshal([]byte(data), &refs); err != nil {
+		return nil, fmt.Errorf("failed to parse backup references for revision %d: %w", revision, err)
+	}
+
+	return refs, nil
+}
+
+func configMapName(releaseName string) string {
+	return releaseName + "-shepherd-backups"
+}
@@ -0,0 +1,87 @@
+// Package chartsig verifies the detached ed25519 signatures of chart archives sent to the agent.
+package chartsig
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrUnsigned         = errors.New("chart is not signed")
+	ErrInvalidSignature = errors.New("chart signature is invalid")
+)
+
+// Verifier checks chart archives against a trusted public key. The zero value accepts every chart.
+type Verifier struct {
+	key ed25519.PublicKey
+}
+
+// NewVerifier returns a Verifier for the given public key, either PEM-encoded (PKIX) or the
+// base64-encoded raw key. An empty key disables verification.
+func NewVerifier(publicKey string) (*Verifier, error) {
+	publicKey = strings.TrimSpace(publicKey)
+	if publicKey == "" {
+		return &Verifier{}, nil
+	}
+
+	key, err := parsePublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse chart signing key: %w", err)
+	}
+
+	return &Verifier{key: key}, nil
+}
+
+// Enabled reports whether charts are being verified.
+func (v *Verifier) Enabled() bool {
+	return v.key != nil
+}
+
+// Verify returns ErrUnsigned if there is no signature and ErrInvalidSignature if it doesn't match
+// the chart. It always succeeds if verification is disabled.
+func (v *Verifier) Verify(chart, signature []byte) error {
+	if !v.Enabled() {
+		return nil
+	}
+
+	if len(signature) == 0 {
+		return ErrUnsigned
+	}
+
+	if !ed25519.Verify(v.key, chart, signature) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+func parsePublicKey(s string) (ed25519.PublicKey, error) {
+	if block, _ := pem.Decode([]byte(s)); block != nil {
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		edKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("expected an ed25519 key, got %T", key)
+		}
+		return edKey, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("expected a %d byte key, got %d bytes", ed25519.PublicKeySize, len(raw))
+	}
+
+	return ed25519.PublicKey(raw), nil
+}
@@ -0,0 +1,69 @@
+package chartsig
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	keys := map[string]string{
+		"base64": base64.StdEncoding.EncodeToString(pub),
+		"pem":    string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	}
+
+	chart := []byte("chart archive")
+	signature := ed25519.Sign(priv, chart)
+
+	for name, key := range keys {
+		t.Run(name, func(t *testing.T) {
+			v, err := NewVerifier(key)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if err := v.Verify(chart, signature); err != nil {
+				t.Errorf("Expected valid signature, got %v", err)
+			}
+			if err := v.Verify(chart, nil); !errors.Is(err, ErrUnsigned) {
+				t.Errorf("Expected ErrUnsigned, got %v", err)
+			}
+			if err := v.Verify([]byte("tampered archive"), signature); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("Expected ErrInvalidSignature, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifierDisabled(t *testing.T) {
+	v, err := NewVerifier("")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if v.Enabled() {
+		t.Error("Expected verification to be disabled")
+	}
+	if err := v.Verify([]byte("chart"), nil); err != nil {
+		t.Errorf("Expected unsigned chart to be accepted, got %v", err)
+	}
+}
+
+func TestNewVerifierInvalidKey(t *testing.T) {
+	if _, err := NewVerifier(base64.StdEncoding.EncodeToString([]byte("short"))); err == nil {
+		t.Error("Expected error for a key of the wrong size")
+	}
+}
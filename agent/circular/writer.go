@@ -2,73 +2,199 @@ package circular
 
 import (
 	"bytes"
-	"io"
+	"context"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 )
 
+type Stream string
+
+const (
+	Stdout Stream = "stdout"
+	Stderr Stream = "stderr"
+)
+
+// subscriptionSize is how many lines a subscriber may fall behind before lines are dropped for it.
+const subscriptionSize = 256
+
+// Buffer keeps the most recent lines written to it. It is safe for concurrent use.
 type Buffer struct {
+	mu     sync.RWMutex
 	buffer []Line
 	size   int
 	head   int
 	full   bool
-	buf    bytes.Buffer
+
+	maxLineLength int
+	untagged      *Writer
+
+	subscribers map[*subscriber]struct{}
 }
 
 type Line struct {
-	Text string
-	Time time.Time
+	Text   string
+	Time   time.Time
+	Stream Stream
 }
 
-func NewBuffer(limit int) *Buffer {
-	return &Buffer{
-		buffer: make([]Line, limit),
-		size:   limit,
-		head:   0,
-		full:   false,
+type Option func(*Buffer)
+
+// WithMaxLineLength truncates lines to at most n bytes, without splitting a character.
+func WithMaxLineLength(n int) Option {
+	return func(b *Buffer) {
+		b.maxLineLength = n
 	}
 }
 
-func (b *Buffer) Write(p []byte) (int, error) {
-	// Append to an internal buffer to handle incomplete lines
-	n, err := b.buf.Write(p)
-	if err != nil {
-		return n, err
+func NewBuffer(limit int, opts ...Option) *Buffer {
+	b := &Buffer{
+		buffer:      make([]Line, limit),
+		size:        limit,
+		head:        0,
+		full:        false,
+		subscribers: map[*subscriber]struct{}{},
 	}
-
-	// Extract lines from the buffer
-	for {
-		line, err := b.buf.ReadString('\n')
-		if err == io.EOF {
-			// If there's no complete line yet, put the remaining part back in the buffer
-			b.buf.WriteString(line)
-			break
-		}
-		// Trim newline characters and add the line to the ring buffer
-		b.Add(strings.TrimSuffix(line, "\n"))
+	for _, opt := range opts {
+		opt(b)
 	}
-	return n, nil
+	b.untagged = b.Writer("")
+
+	return b
+}
+
+// Write adds the complete lines in p to the buffer without a stream, holding on to an incomplete
+// last line until it is finished.
+func (b *Buffer) Write(p []byte) (int, error) {
+	return b.untagged.Write(p)
+}
+
+// Writer returns a writer whose lines are added to the buffer tagged with stream.
+func (b *Buffer) Writer(stream Stream) *Writer {
+	return &Writer{buffer: b, stream: stream}
 }
 
 func (b *Buffer) Add(line string) {
-	b.buffer[b.head] = NewLine(line)
+	b.AddLine(NewLine(line))
+}
+
+func (b *Buffer) AddLine(line Line) {
+	if b.maxLineLength > 0 {
+		line.Text = truncate(line.Text, b.maxLineLength)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buffer[b.head] = line
 	b.head = (b.head + 1) % b.size
 
 	// Mark the buffer as full once we've looped over all positions
 	if b.head == 0 {
 		b.full = true
 	}
+
+	for s := range b.subscribers {
+		if s.query.matches(line) {
+			select {
+			case s.c <- line:
+			default:
+				// The subscriber isn't keeping up, it misses the line rather than blocking the writer.
+			}
+		}
+	}
 }
 
+// Lines returns the most recent n lines, oldest first. Unlike Query's Limit, n of 0 returns no
+// lines.
 func (b *Buffer) Lines(n int) []Line {
+	if n <= 0 {
+		return []Line{}
+	}
+	return b.Query(Query{Limit: n})
+}
+
+// Query selects lines from the buffer. The zero value selects every line.
+type Query struct {
+	// Limit keeps only the most recent Limit matching lines. There is no limit if it is 0.
+	Limit int
+
+	// Since excludes lines added before it.
+	Since time.Time
+
+	// Stream, if set, excludes lines from other streams.
+	Stream Stream
+
+	// Contains and Match, if set, exclude lines that don't contain the substring or match the
+	// regular expression.
+	Contains string
+	Match    *regexp.Regexp
+}
+
+func (q Query) matches(line Line) bool {
+	return (q.Since.IsZero() || !line.Time.Before(q.Since)) &&
+		(q.Stream == "" || line.Stream == q.Stream) &&
+		(q.Contains == "" || strings.Contains(line.Text, q.Contains)) &&
+		(q.Match == nil || q.Match.MatchString(line.Text))
+}
+
+// Query returns the lines matching q, oldest first.
+func (b *Buffer) Query(q Query) []Line {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.query(q)
+}
+
+func (b *Buffer) query(q Query) []Line {
+	lines := []Line{}
+	for _, line := range b.ordered() {
+		if q.matches(line) {
+			lines = append(lines, line)
+		}
+	}
+
+	if q.Limit > 0 && len(lines) > q.Limit {
+		lines = lines[len(lines)-q.Limit:]
+	}
+	return lines
+}
+
+// ordered returns the buffered lines, oldest first.
+func (b *Buffer) ordered() []Line {
 	if !b.full {
-		// If the buffer isn't full, return the lines up to the current head
-		return b.buffer[:min(b.head, n)]
+		return b.buffer[:b.head]
 	}
+	return append(b.buffer[b.head:b.size:b.size], b.buffer[:b.head]...)
+}
 
-	// If the buffer is full, return the lines starting from head to the end,
-	// followed by lines from the start to head
-	return append(b.buffer[b.head:], b.buffer[:b.head]...)[:n]
+type subscriber struct {
+	query Query
+	c     chan Line
+}
+
+// Subscribe returns the lines matching q, then follows the buffer, sending lines matching q as they
+// are added until ctx is done. A subscriber that falls behind misses lines.
+func (b *Buffer) Subscribe(ctx context.Context, q Query) ([]Line, <-chan Line) {
+	s := &subscriber{query: q, c: make(chan Line, subscriptionSize)}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribers[s] = struct{}{}
+
+	go func() {
+		<-ctx.Done()
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers, s)
+		close(s.c)
+	}()
+
+	return b.query(q), s.c
 }
 
 func NewLine(text string) Line {
@@ -77,3 +203,78 @@ func NewLine(text string) Line {
 		Time: time.Now(),
 	}
 }
+
+// Writer splits its output into lines, which it adds to its buffer.
+type Writer struct {
+	buffer *Buffer
+	stream Stream
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Append to an internal buffer to handle incomplete lines
+	n, err := w.buf.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	// Extract lines from the buffer
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+
+		// Trim newline characters and add the line to the ring buffer
+		line := strings.TrimSuffix(string(w.buf.Next(i+1)), "\n")
+		w.add(strings.TrimSuffix(line, "\r"))
+	}
+
+	// A line that is already too long is added, truncated, rather than held on to. A character
+	// split across writes is kept, so that the rest of the line doesn't start part way through it.
+	if max := w.buffer.maxLineLength; max > 0 && w.buf.Len() >= max {
+		pending := w.buf.Bytes()
+		partial := bytes.Clone(pending[partialCharStart(pending):])
+		w.add(string(pending[:len(pending)-len(partial)]))
+		w.buf.Reset()
+		w.buf.Write(partial)
+	}
+
+	return n, nil
+}
+
+// partialCharStart returns where an incomplete UTF-8 encoded character at the end of p starts, or
+// len(p) if p doesn't end part way through a character.
+func partialCharStart(p []byte) int {
+	for i := len(p) - 1; i >= 0 && i >= len(p)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(p[i]) {
+			if !utf8.FullRune(p[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(p)
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 encoded character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func (w *Writer) add(text string) {
+	line := NewLine(text)
+	line.Stream = w.stream
+	w.buffer.AddLine(line)
+}
@@ -1,8 +1,14 @@
 package circular
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
 	"testing"
 	"time"
+	"unicode/utf8"
 )
 
 func TestNewBuffer(t *testing.T) {
@@ -103,3 +109,172 @@ func TestBufferLines(t *testing.T) {
 		}
 	}
 }
+
+func TestBufferLinesTail(t *testing.T) {
+	b := NewBuffer(5)
+	for _, line := range []string{"line1", "line2", "line3"} {
+		b.Add(line)
+	}
+
+	// The most recent lines are returned, whether or not the buffer is full.
+	if lines := b.Lines(2); len(lines) != 2 || lines[0].Text != "line2" || lines[1].Text != "line3" {
+		t.Errorf("Expected line2 and line3, got %v", lines)
+	}
+
+	for _, line := range []string{"line4", "line5", "line6"} {
+		b.Add(line)
+	}
+	if lines := b.Lines(2); len(lines) != 2 || lines[0].Text != "line5" || lines[1].Text != "line6" {
+		t.Errorf("Expected line5 and line6, got %v", lines)
+	}
+	if lines := b.Lines(10); len(lines) != 5 || lines[0].Text != "line2" {
+		t.Errorf("Expected the 5 buffered lines, got %v", lines)
+	}
+}
+
+func TestBufferQuery(t *testing.T) {
+	b := NewBuffer(10)
+	start := time.Now()
+
+	lines := []Line{
+		{Text: "starting server", Time: start, Stream: Stdout},
+		{Text: "error: connection refused", Time: start.Add(time.Second), Stream: Stderr},
+		{Text: "listening on :8080", Time: start.Add(2 * time.Second), Stream: Stdout},
+		{Text: "error: timeout", Time: start.Add(3 * time.Second), Stream: Stderr},
+	}
+	for _, l := range lines {
+		b.AddLine(l)
+	}
+
+	tests := []struct {
+		name     string
+		query    Query
+		expected []string
+	}{
+		{"all", Query{}, []string{"starting server", "error: connection refused", "listening on :8080", "error: timeout"}},
+		{"limit", Query{Limit: 1}, []string{"error: timeout"}},
+		{"since", Query{Since: start.Add(2 * time.Second)}, []string{"listening on :8080", "error: timeout"}},
+		{"stream", Query{Stream: Stdout}, []string{"starting server", "listening on :8080"}},
+		{"contains", Query{Contains: "error"}, []string{"error: connection refused", "error: timeout"}},
+		{"match", Query{Match: regexp.MustCompile(`:\d+$`)}, []string{"listening on :8080"}},
+		{"combined", Query{Stream: Stderr, Contains: "error", Limit: 1}, []string{"error: timeout"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := b.Query(tt.query)
+			if len(got) != len(tt.expected) {
+				t.Fatalf("Expected %d lines, got %v", len(tt.expected), got)
+			}
+			for i, exp := range tt.expected {
+				if got[i].Text != exp {
+					t.Errorf("Expected line %d to be %q, got %q", i, exp, got[i].Text)
+				}
+			}
+		})
+	}
+}
+
+func TestBufferStreams(t *testing.T) {
+	b := NewBuffer(5, WithMaxLineLength(8))
+
+	b.Writer(Stdout).Write([]byte("out\r\n"))
+	b.Writer(Stderr).Write([]byte("a very long error\n"))
+	b.Writer(Stderr).Write([]byte("no newline but too long"))
+
+	lines := b.Lines(5)
+	expected := []Line{{Text: "out", Stream: Stdout}, {Text: "a very l", Stream: Stderr}, {Text: "no newli", Stream: Stderr}}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d lines, got %v", len(expected), lines)
+	}
+	for i, exp := range expected {
+		if lines[i].Text != exp.Text || lines[i].Stream != exp.Stream {
+			t.Errorf("Expected line %d to be %v, got %v", i, exp, lines[i])
+		}
+	}
+}
+
+func TestBufferTruncatesCharacters(t *testing.T) {
+	b := NewBuffer(5, WithMaxLineLength(5))
+
+	b.Add("ééé")
+
+	// The euro sign is split across writes, after the line is already too long.
+	euro := []byte("€")
+	w := b.Writer(Stdout)
+	w.Write(append([]byte("abc"), euro[:2]...))
+	w.Write(append(euro[2:], '\n'))
+
+	lines := b.Lines(5)
+	expected := []string{"éé", "abc", "€"}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d lines, got %v", len(expected), lines)
+	}
+	for i, exp := range expected {
+		if lines[i].Text != exp || !utf8.ValidString(lines[i].Text) {
+			t.Errorf("Expected line %d to be %q, got %q", i, exp, lines[i].Text)
+		}
+	}
+
+	if lines := b.Lines(0); len(lines) != 0 {
+		t.Errorf("Expected no lines, got %v", lines)
+	}
+}
+
+func TestBufferSubscribe(t *testing.T) {
+	b := NewBuffer(5)
+	b.Add("before")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	backlog, live := b.Subscribe(ctx, Query{Contains: "match"})
+	if len(backlog) != 0 {
+		t.Errorf("Expected no matching backlog, got %v", backlog)
+	}
+
+	b.Add("no")
+	b.Add("a match")
+
+	select {
+	case line := <-live:
+		if line.Text != "a match" {
+			t.Errorf("Expected the matching line, got %q", line.Text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a live line")
+	}
+
+	cancel()
+	for range live {
+	}
+}
+
+func TestBufferConcurrent(t *testing.T) {
+	b := NewBuffer(16)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, live := b.Subscribe(ctx, Query{})
+	go func() {
+		for range live {
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for _, stream := range []Stream{Stdout, Stderr} {
+		wg.Add(1)
+		go func(w io.Writer) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				fmt.Fprintf(w, "line %d\n", i)
+			}
+		}(b.Writer(stream))
+	}
+	for i := 0; i < 100; i++ {
+		b.Query(Query{Contains: "line"})
+	}
+	wg.Wait()
+
+	if lines := b.Lines(16); len(lines) != 16 {
+		t.Errorf("Expected a full buffer, got %d lines", len(lines))
+	}
+}
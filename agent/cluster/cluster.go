@@ -3,15 +3,21 @@ package cluster
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 
 	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/tools/clientcmd"
@@ -51,6 +57,16 @@ func Self(ctx context.Context) (*Cluster, error) {
 	return &Cluster{config: config}, nil
 }
 
+// Clientset returns a typed Kubernetes client for the cluster.
+func (c *Cluster) Clientset() (kubernetes.Interface, error) {
+	return kubernetes.NewForConfig(c.config)
+}
+
+// Dynamic returns a dynamic Kubernetes client for the cluster, used for custom resources.
+func (c *Cluster) Dynamic() (dynamic.Interface, error) {
+	return dynamic.NewForConfig(c.config)
+}
+
 func CurrentReleaseName() string {
 	return os.Getenv(HELM_RELEASE_NAME_ENV_KEY)
 }
@@ -92,34 +108,85 @@ func (c *Cluster) Install(ctx context.Context, chartData []byte, releaseName, na
 	return nil
 }
 
-func (c *Cluster) Upgrade(ctx context.Context, chartData []byte, releaseName, namespace string) error {
+// Upgrade upgrades the release to the provided chart, with values merged as values says, and returns
+// the resulting release.
+func (c *Cluster) Upgrade(ctx context.Context, chartData []byte, releaseName, namespace string, values Values) (*release.Release, error) {
 	actionCfg, err := c.newActionConfig(namespace)
 	if err != nil {
-		return fmt.Errorf("failed to create action config: %w", err)
+		return nil, fmt.Errorf("failed to create action config: %w", err)
 	}
 
 	ch, err := loader.LoadArchive(bytes.NewReader(chartData))
 	if err != nil {
-		return fmt.Errorf("failed to load chart: %w", err)
+		return nil, fmt.Errorf("failed to load chart: %w", err)
 	}
 
+	return upgrade(ctx, actionCfg, ch, releaseName, namespace, values)
+}
+
+func upgrade(ctx context.Context, actionCfg *action.Configuration, ch *chart.Chart, releaseName, namespace string, values Values) (*release.Release, error) {
 	upgrade := action.NewUpgrade(actionCfg)
 	upgrade.Namespace = namespace
 	upgrade.CleanupOnFail = true
 
-	log.Printf("upgrading release %q in namespace %q", releaseName, namespace)
+	vals, err := values.configure(upgrade)
+	if err != nil {
+		return nil, err
+	}
 
-	_, err = upgrade.RunWithContext(ctx, releaseName, ch, map[string]any{})
+	log.Printf("upgrading release %q in namespace %q with the %s values strategy", releaseName, namespace, values.Strategy)
+
+	rel, err := upgrade.RunWithContext(ctx, releaseName, ch, vals)
 	if err != nil {
-		return fmt.Errorf("failed to upgrade chart: %w", err)
+		return nil, fmt.Errorf("failed to upgrade chart: %w", err)
 	}
 
-	log.Printf("successfully upgraded release %q in namespace %q", releaseName, namespace)
+	log.Printf("successfully upgraded release %q in namespace %q to revision %d", releaseName, namespace, rel.Version)
 
-	return nil
+	return rel, nil
+}
+
+// Deployed returns the currently deployed revision of the release.
+func (c *Cluster) Deployed(ctx context.Context, releaseName, namespace string) (*release.Release, error) {
+	actionCfg, err := c.newActionConfig(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create action config: %w", err)
+	}
+
+	rel, err := actionCfg.Releases.Deployed(releaseName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find deployed release: %w", err)
+	}
+
+	return rel, nil
+}
+
+// Current returns the deployed revision of the release or, if none is deployed, eg: because every
+// upgrade of it failed, its last revision.
+func (c *Cluster) Current(ctx context.Context, releaseName, namespace string) (*release.Release, error) {
+	actionCfg, err := c.newActionConfig(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create action config: %w", err)
+	}
+
+	return current(actionCfg, releaseName)
+}
+
+func current(actionCfg *action.Configuration, releaseName string) (*release.Release, error) {
+	rel, err := actionCfg.Releases.Deployed(releaseName)
+	if errors.Is(err, driver.ErrNoDeployedReleases) {
+		rel, err = actionCfg.Releases.Last(releaseName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find release: %w", err)
+	}
+
+	return rel, nil
 }
 
-func (c *Cluster) Uninstall(ctx context.Context, releaseName, namespace string) error {
+// Uninstall deletes the release's resources and waits for them to be gone. If keepHistory is set the
+// release's revisions are kept, so that it can be rolled back to.
+func (c *Cluster) Uninstall(ctx context.Context, releaseName, namespace string, keepHistory bool) error {
 	actionCfg, err := c.newActionConfig(namespace)
 	if err != nil {
 		return fmt.Errorf("failed to create action config: %w", err)
@@ -128,6 +195,7 @@ func (c *Cluster) Uninstall(ctx context.Context, releaseName, namespace string)
 	client := action.NewUninstall(actionCfg)
 	client.IgnoreNotFound = true
 	client.Wait = true
+	client.KeepHistory = keepHistory
 
 	_, err = client.Run(releaseName)
 	if err != nil {
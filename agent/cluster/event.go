@@ -0,0 +1,62 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// EventSource is the component Events recorded by the agent are attributed to.
+const EventSource = "shepherd-agent"
+
+// RecordEvent records a Kubernetes Event about the pod, so that it shows up in kubectl describe and
+// kubectl get events. eventType is corev1.EventTypeNormal or corev1.EventTypeWarning.
+func (c *Cluster) RecordEvent(ctx context.Context, namespace, podName, eventType, reason, message string) error {
+	client, err := c.Clientset()
+	if err != nil {
+		return err
+	}
+
+	return recordEvent(ctx, client, namespace, podName, eventType, reason, message)
+}
+
+func recordEvent(ctx context.Context, client kubernetes.Interface, namespace, podName, eventType, reason, message string) error {
+	pod, err := client.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get pod %s: %w", podName, err)
+	}
+
+	// Named like the events of client-go's event recorder.
+	t := time.Now()
+	now := metav1.NewTime(t)
+	_, err = client.CoreV1().Events(namespace).Create(ctx, &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", podName, t.UnixNano()),
+			Namespace: namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion:      "v1",
+			Kind:            "Pod",
+			Namespace:       namespace,
+			Name:            podName,
+			UID:             pod.UID,
+			ResourceVersion: pod.ResourceVersion,
+		},
+		Type:           eventType,
+		Reason:         reason,
+		Message:        message,
+		Source:         corev1.EventSource{Component: EventSource},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to record event %s: %w", reason, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRecordEvent(t *testing.T) {
+	client := fake.NewClientset(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "agent-0", Namespace: "app", UID: "pod-uid"}})
+
+	if err := recordEvent(context.Background(), client, "app", "agent-0", corev1.EventTypeNormal, "AccessRequested", "vendor requests access"); err != nil {
+		t.Fatalf("recordEvent() returned error: %v", err)
+	}
+
+	events, err := client.CoreV1().Events("app").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events.Items) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events.Items))
+	}
+
+	e := events.Items[0]
+	if e.InvolvedObject.Kind != "Pod" || e.InvolvedObject.UID != "pod-uid" || e.Reason != "AccessRequested" || e.Source.Component != EventSource {
+		t.Errorf("Unexpected event %+v", e)
+	}
+
+	if err := recordEvent(context.Background(), client, "app", "missing", corev1.EventTypeNormal, "AccessRequested", ""); err == nil {
+		t.Error("Expected an error for a missing pod")
+	}
+}
@@ -0,0 +1,124 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+)
+
+const (
+	ReleaseInstanceLabel = "app.kubernetes.io/instance"
+
+	podResyncPeriod = 10 * time.Minute
+)
+
+type PodHealth struct {
+	Name       string
+	Phase      string
+	Containers []ContainerHealth
+}
+
+type ContainerHealth struct {
+	Name                  string
+	Image                 string
+	Ready                 bool
+	RestartCount          int32
+	WaitingReason         string
+	LastTerminationReason string
+}
+
+// PodWatcher keeps an informer-backed cache of the pods belonging to a release.
+type PodWatcher struct {
+	factory informers.SharedInformerFactory
+	lister  corelisters.PodLister
+}
+
+// WatchPods returns a PodWatcher for the release's pods. It must be started before use.
+func (c *Cluster) WatchPods(releaseName, namespace string) (*PodWatcher, error) {
+	client, err := c.Clientset()
+	if err != nil {
+		return nil, err
+	}
+
+	return newPodWatcher(client, releaseName, namespace), nil
+}
+
+func newPodWatcher(client kubernetes.Interface, releaseName, namespace string) *PodWatcher {
+	factory := informers.NewSharedInformerFactoryWithOptions(client, podResyncPeriod,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = fmt.Sprintf("%s=%s", ReleaseInstanceLabel, releaseName)
+		}),
+	)
+
+	return &PodWatcher{
+		factory: factory,
+		lister:  factory.Core().V1().Pods().Lister(),
+	}
+}
+
+// Start starts the informer and blocks until its cache has synced. The informer runs until ctx is done.
+func (w *PodWatcher) Start(ctx context.Context) error {
+	w.factory.Start(ctx.Done())
+
+	for informer, synced := range w.factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return fmt.Errorf("failed to sync %v informer", informer)
+		}
+	}
+
+	return nil
+}
+
+// Snapshot returns the current health of every pod in the release, sorted by name.
+func (w *PodWatcher) Snapshot() ([]PodHealth, error) {
+	pods, err := w.lister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	health := make([]PodHealth, 0, len(pods))
+	for _, pod := range pods {
+		health = append(health, podHealth(pod))
+	}
+
+	sort.Slice(health, func(i, j int) bool { return health[i].Name < health[j].Name })
+
+	return health, nil
+}
+
+func podHealth(pod *corev1.Pod) PodHealth {
+	h := PodHealth{
+		Name:  pod.Name,
+		Phase: string(pod.Status.Phase),
+	}
+
+	for _, cs := range pod.Status.ContainerStatuses {
+		c := ContainerHealth{
+			Name:         cs.Name,
+			Image:        cs.Image,
+			Ready:        cs.Ready,
+			RestartCount: cs.RestartCount,
+		}
+
+		if cs.State.Waiting != nil {
+			c.WaitingReason = cs.State.Waiting.Reason
+		}
+
+		if cs.LastTerminationState.Terminated != nil {
+			c.LastTerminationReason = cs.LastTerminationState.Terminated.Reason
+		}
+
+		h.Containers = append(h.Containers, c)
+	}
+
+	return h
+}
@@ -0,0 +1,73 @@
+package cluster
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPodWatcherSnapshot(t *testing.T) {
+	client := fake.NewClientset(
+		newPod("web-b", "my-release", corev1.ContainerStatus{
+			Name:         "web",
+			Image:        "web:1.0.0",
+			RestartCount: 3,
+			State: corev1.ContainerState{
+				Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+			},
+			LastTerminationState: corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled"},
+			},
+		}),
+		newPod("web-a", "my-release", corev1.ContainerStatus{
+			Name:  "web",
+			Image: "web:1.0.0",
+			Ready: true,
+		}),
+		newPod("other", "other-release", corev1.ContainerStatus{Name: "other"}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := newPodWatcher(client, "my-release", "default")
+	if err := w.Start(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	health, err := w.Snapshot()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []PodHealth{
+		{Name: "web-a", Phase: "Running", Containers: []ContainerHealth{
+			{Name: "web", Image: "web:1.0.0", Ready: true},
+		}},
+		{Name: "web-b", Phase: "Running", Containers: []ContainerHealth{
+			{Name: "web", Image: "web:1.0.0", RestartCount: 3, WaitingReason: "CrashLoopBackOff", LastTerminationReason: "OOMKilled"},
+		}},
+	}
+
+	if !reflect.DeepEqual(health, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, health)
+	}
+}
+
+func newPod(name, release string, status corev1.ContainerStatus) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    map[string]string{ReleaseInstanceLabel: release},
+		},
+		Status: corev1.PodStatus{
+			Phase:             corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{status},
+		},
+	}
+}
@@ -0,0 +1,171 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"sigs.k8s.io/yaml"
+)
+
+// sensitiveKey matches the keys of values that are masked in reported values.
+var sensitiveKey = regexp.MustCompile(`(?i)(passw(or)?d|secret|token|credential|private.?key|api.?key|access.?key)`)
+
+// RevisionManifest is what a revision of a release installed.
+type RevisionManifest struct {
+	Revision int
+
+	// Manifest is the rendered manifest, with the data and stringData of Secrets redacted, see
+	// redactManifest.
+	Manifest string
+
+	// Values are the user-supplied values as YAML, with values whose keys look sensitive redacted.
+	Values string
+}
+
+// History returns the revisions of the release, newest first. limit keeps only the most recent
+// revisions, unless it is 0.
+func (c *Cluster) History(ctx context.Context, releaseName, namespace string, limit int) ([]ReleaseStatus, error) {
+	actionCfg, err := c.newActionConfig(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create action config: %w", err)
+	}
+
+	return history(actionCfg, releaseName, limit)
+}
+
+func history(actionCfg *action.Configuration, releaseName string, limit int) ([]ReleaseStatus, error) {
+	rels, err := action.NewHistory(actionCfg).Run(releaseName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get history of release %s: %w", releaseName, err)
+	}
+
+	releaseutil.Reverse(rels, releaseutil.SortByRevision)
+	if limit > 0 && len(rels) > limit {
+		rels = rels[:limit]
+	}
+
+	statuses := make([]ReleaseStatus, 0, len(rels))
+	for _, rel := range rels {
+		statuses = append(statuses, releaseStatus(rel))
+	}
+	return statuses, nil
+}
+
+// Manifest returns what a revision of the release installed, with secrets redacted.
+func (c *Cluster) Manifest(ctx context.Context, releaseName, namespace string, revision int) (*RevisionManifest, error) {
+	actionCfg, err := c.newActionConfig(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create action config: %w", err)
+	}
+
+	return manifest(actionCfg, releaseName, revision)
+}
+
+func manifest(actionCfg *action.Configuration, releaseName string, revision int) (*RevisionManifest, error) {
+	get := action.NewGet(actionCfg)
+	get.Version = revision
+
+	rel, err := get.Run(releaseName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revision %d of release %s: %w", revision, releaseName, err)
+	}
+
+	m, err := redactManifest(rel.Manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	var values string
+	if len(rel.Config) > 0 {
+		b, err := yaml.Marshal(redactValues(rel.Config, false))
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode values: %w", err)
+		}
+		values = string(b)
+	}
+
+	return &RevisionManifest{Revision: rel.Version, Manifest: m, Values: values}, nil
+}
+
+// redactManifest redacts the data and stringData of the Secrets in a rendered manifest, including
+// the Secrets in a List. Other resources are left as they were rendered.
+func redactManifest(manifest string) (string, error) {
+	docs := releaseutil.SplitManifests(manifest)
+	keys := make([]string, 0, len(docs))
+	for k := range docs {
+		keys = append(keys, k)
+	}
+	sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+
+	var b strings.Builder
+	for _, k := range keys {
+		doc := docs[k]
+
+		var obj map[string]any
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+			return "", err
+		}
+		hasSecrets := false
+		eachSecret(obj, func(_ string, secret map[string]any) {
+			redactSecret(secret)
+			hasSecrets = true
+		})
+		if hasSecrets {
+			redactedDoc, err := yaml.Marshal(obj)
+			if err != nil {
+				return "", err
+			}
+			// Keep the "# Source:" comment that says which template rendered the resource.
+			doc = leadingComments(doc) + string(redactedDoc)
+		}
+
+		b.WriteString("---\n")
+		b.WriteString(strings.TrimSuffix(doc, "\n"))
+		b.WriteString("\n")
+	}
+
+	return b.String(), nil
+}
+
+func leadingComments(doc string) string {
+	var comments strings.Builder
+	for _, line := range strings.SplitAfter(doc, "\n") {
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		comments.WriteString(line)
+	}
+	return comments.String()
+}
+
+// redactValues returns a copy of v whose values under sensitive keys are redacted, or, if all is
+// set, whose values are all redacted. Maps and lists keep their shape, so that the keys that were
+// set can still be seen.
+func redactValues(v any, all bool) any {
+	switch v := v.(type) {
+	case map[string]any:
+		redactedMap := make(map[string]any, len(v))
+		for k, val := range v {
+			redactedMap[k] = redactValues(val, all || sensitiveKey.MatchString(k))
+		}
+		return redactedMap
+	case []any:
+		redactedList := make([]any, len(v))
+		for i, val := range v {
+			redactedList[i] = redactValues(val, all)
+		}
+		return redactedList
+	case nil:
+		return nil
+	}
+
+	if all {
+		return redacted
+	}
+	return v
+}
@@ -0,0 +1,141 @@
+package cluster
+
+import (
+	"log"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/action"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+func newHistoryConfig(t *testing.T, rels ...*release.Release) *action.Configuration {
+	t.Helper()
+
+	store := storage.Init(driver.NewMemory())
+	for _, rel := range rels {
+		if err := store.Create(rel); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &action.Configuration{Releases: store, KubeClient: &kubefake.PrintingKubeClient{}, Log: log.Printf}
+}
+
+func TestHistory(t *testing.T) {
+	upgraded := newRelease("web", 2, release.StatusFailed, "0.2.0")
+	upgraded.Info.Description = "Upgrade \"web\" failed"
+	actionCfg := newHistoryConfig(t,
+		newRelease("web", 1, release.StatusSuperseded, "0.1.0"),
+		upgraded,
+		newRelease("web", 3, release.StatusDeployed, "0.1.0"),
+		newRelease("worker", 1, release.StatusDeployed, "0.1.0"),
+	)
+
+	revisions, err := history(actionCfg, "web", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []int
+	for _, r := range revisions {
+		got = append(got, r.Revision)
+	}
+	if len(got) != 3 || got[0] != 3 || got[2] != 1 {
+		t.Fatalf("Expected every revision of the release, newest first, got %v", got)
+	}
+	if r := revisions[1]; r.Status != "failed" || r.ChartVersion != "0.2.0" || r.Description != `Upgrade "web" failed` {
+		t.Errorf("Unexpected revision %+v", r)
+	}
+
+	revisions, err = history(actionCfg, "web", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 || revisions[0].Revision != 3 {
+		t.Errorf("Expected the 2 most recent revisions, got %+v", revisions)
+	}
+
+	if _, err := history(actionCfg, "missing", 0); err == nil {
+		t.Error("Expected an error for a release without history")
+	}
+}
+
+func TestManifest(t *testing.T) {
+	rel := newRelease("web", 1, release.StatusDeployed, "0.1.0")
+	rel.Manifest = liveManifest + `---
+# Source: app/templates/credentials.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: web-credentials
+stringData:
+  token: hunter2
+  nested:
+    - key: value
+---
+# Source: app/templates/list.yaml
+apiVersion: v1
+kind: List
+items:
+  - apiVersion: v1
+    kind: Secret
+    metadata:
+      name: web-listed
+    data:
+      listed: c2VjcmV0
+  - apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: web-listed
+    data:
+      color: blue
+`
+	rel.Config = map[string]any{
+		"ingress": map[string]any{"host": "app.example.com"},
+		"db": map[string]any{
+			"host":     "db.internal",
+			"password": "hunter2",
+		},
+		"auth": map[string]any{"apiKey": "abc", "providers": []any{map[string]any{"name": "sso", "clientSecret": "xyz"}}},
+		"smtp": map[string]any{"credentials": map[string]any{"user": "mail", "pass": "letmein"}},
+	}
+	actionCfg := newHistoryConfig(t, rel)
+
+	m, err := manifest(actionCfg, "web", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Revision != 1 {
+		t.Errorf("Expected revision 1, got %d", m.Revision)
+	}
+	for _, secret := range []string{"b2xk", "hunter2", "abc", "xyz", "letmein", "value", "c2VjcmV0"} {
+		if strings.Contains(m.Manifest, secret) || strings.Contains(m.Values, secret) {
+			t.Errorf("Expected %q to be redacted, got:\n%s\n%s", secret, m.Manifest, m.Values)
+		}
+	}
+	for _, want := range []string{
+		"# Source: app/templates/deployment.yaml\napiVersion: apps/v1\nkind: Deployment\n",
+		"        - name: web\n          image: web:1.0.0\n",
+		"# Source: app/templates/secrets.yaml\napiVersion: v1\ndata:\n  password: <redacted>\n",
+		"  token: <redacted>\n",
+		"  data:\n    listed: <redacted>\n",
+		"  data:\n    color: blue\n",
+	} {
+		if !strings.Contains(m.Manifest, want) {
+			t.Errorf("Expected the manifest to contain %q, got:\n%s", want, m.Manifest)
+		}
+	}
+	for _, want := range []string{"host: app.example.com", "host: db.internal", "password: <redacted>", "name: sso", "user: <redacted>"} {
+		if !strings.Contains(m.Values, want) {
+			t.Errorf("Expected the values to contain %q, got:\n%s", want, m.Values)
+		}
+	}
+
+	if _, err := manifest(actionCfg, "web", 2); err == nil {
+		t.Error("Expected an error for a missing revision")
+	}
+}
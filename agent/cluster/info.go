@@ -0,0 +1,135 @@
+package cluster
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+type Distribution string
+
+const (
+	DistributionUnknown   Distribution = ""
+	DistributionEKS       Distribution = "eks"
+	DistributionGKE       Distribution = "gke"
+	DistributionAKS       Distribution = "aks"
+	DistributionK3s       Distribution = "k3s"
+	DistributionOpenShift Distribution = "openshift"
+)
+
+// Info describes the cluster and the release the agent runs in.
+type Info struct {
+	// UID is the UID of the kube-system namespace, which lives as long as the cluster.
+	UID string
+
+	KubernetesVersion string
+	Distribution      Distribution
+
+	NodeCount           int
+	CPUCapacityMillis   int64
+	MemoryCapacityBytes int64
+
+	ChartVersion string
+}
+
+// Info collects what it can about the cluster and the release. Facts that can't be read, usually
+// because the agent lacks the cluster-scoped RBAC permissions, are left empty.
+func (c *Cluster) Info(ctx context.Context, releaseName, namespace string) (*Info, error) {
+	client, err := c.Clientset()
+	if err != nil {
+		return nil, err
+	}
+
+	info := collectInfo(ctx, client)
+
+	rel, err := c.Deployed(ctx, releaseName, namespace)
+	if err != nil {
+		log.Printf("Failed to read chart version: %v", err)
+	} else if rel.Chart != nil && rel.Chart.Metadata != nil {
+		info.ChartVersion = rel.Chart.Metadata.Version
+	}
+
+	return info, nil
+}
+
+func collectInfo(ctx context.Context, client kubernetes.Interface) *Info {
+	info := &Info{}
+
+	if ns, err := client.CoreV1().Namespaces().Get(ctx, metav1.NamespaceSystem, metav1.GetOptions{}); err != nil {
+		log.Printf("Failed to read cluster UID: %v", err)
+	} else {
+		info.UID = string(ns.UID)
+	}
+
+	if version, err := client.Discovery().ServerVersion(); err != nil {
+		log.Printf("Failed to read Kubernetes version: %v", err)
+	} else {
+		info.KubernetesVersion = version.GitVersion
+	}
+
+	var groups []string
+	if groupList, err := client.Discovery().ServerGroups(); err != nil {
+		log.Printf("Failed to read API groups: %v", err)
+	} else {
+		for _, g := range groupList.Groups {
+			groups = append(groups, g.Name)
+		}
+	}
+
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		log.Printf("Failed to list nodes: %v", err)
+		nodes = &corev1.NodeList{}
+	}
+
+	info.NodeCount = len(nodes.Items)
+	for _, node := range nodes.Items {
+		info.CPUCapacityMillis += node.Status.Capacity.Cpu().MilliValue()
+		info.MemoryCapacityBytes += node.Status.Capacity.Memory().Value()
+	}
+
+	info.Distribution = detectDistribution(info.KubernetesVersion, groups, nodes.Items)
+
+	return info
+}
+
+// detectDistribution recognises managed and packaged Kubernetes distributions from the API groups
+// their controllers install, the markers they add to the server version, and the node provider IDs.
+func detectDistribution(version string, groups []string, nodes []corev1.Node) Distribution {
+	for _, g := range groups {
+		switch {
+		case strings.HasSuffix(g, ".openshift.io"):
+			return DistributionOpenShift
+		case strings.HasSuffix(g, ".gke.io"):
+			return DistributionGKE
+		case strings.HasSuffix(g, ".k8s.aws"), strings.HasSuffix(g, ".eks.amazonaws.com"):
+			return DistributionEKS
+		}
+	}
+
+	switch {
+	case strings.Contains(version, "-eks-"):
+		return DistributionEKS
+	case strings.Contains(version, "-gke."):
+		return DistributionGKE
+	case strings.Contains(version, "+k3s"):
+		return DistributionK3s
+	}
+
+	for _, node := range nodes {
+		switch {
+		case strings.HasPrefix(node.Spec.ProviderID, "azure://"):
+			return DistributionAKS
+		case strings.HasPrefix(node.Spec.ProviderID, "gce://"):
+			return DistributionGKE
+		case strings.HasPrefix(node.Spec.ProviderID, "aws://") && node.Labels["eks.amazonaws.com/nodegroup"] != "":
+			return DistributionEKS
+		}
+	}
+
+	return DistributionUnknown
+}
@@ -0,0 +1,78 @@
+package cluster
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCollectInfo(t *testing.T) {
+	client := fake.NewClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "cluster-uid"}},
+		newNode("node-1", "4", "16Gi"),
+		newNode("node-2", "2", "8Gi"),
+	)
+
+	discovery := client.Discovery().(*fakediscovery.FakeDiscovery)
+	discovery.FakedServerVersion = &version.Info{GitVersion: "v1.30.4-gke.1348000"}
+
+	info := collectInfo(context.Background(), client)
+
+	expected := &Info{
+		UID:                 "cluster-uid",
+		KubernetesVersion:   "v1.30.4-gke.1348000",
+		Distribution:        DistributionGKE,
+		NodeCount:           2,
+		CPUCapacityMillis:   6000,
+		MemoryCapacityBytes: 24 << 30,
+	}
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, info)
+	}
+}
+
+func TestDetectDistribution(t *testing.T) {
+	tests := []struct {
+		name       string
+		version    string
+		groups     []string
+		providerID string
+		expected   Distribution
+	}{
+		{"openshift", "v1.29.0", []string{"apps", "route.openshift.io"}, "", DistributionOpenShift},
+		{"gke group", "v1.30.0", []string{"networking.gke.io"}, "", DistributionGKE},
+		{"eks group", "v1.30.0", []string{"elbv2.k8s.aws"}, "", DistributionEKS},
+		{"eks version", "v1.30.4-eks-a737599", nil, "", DistributionEKS},
+		{"k3s", "v1.30.5+k3s1", nil, "", DistributionK3s},
+		{"aks", "v1.30.0", nil, "azure:///subscriptions/abc", DistributionAKS},
+		{"unknown", "v1.30.0", []string{"apps"}, "kind://docker/kind/kind-control-plane", DistributionUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := []corev1.Node{{Spec: corev1.NodeSpec{ProviderID: tt.providerID}}}
+			if got := detectDistribution(tt.version, tt.groups, nodes); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func newNode(name, cpu, memory string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{
+			Capacity: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(cpu),
+				corev1.ResourceMemory: resource.MustParse(memory),
+			},
+		},
+	}
+}
@@ -0,0 +1,381 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"sigs.k8s.io/yaml"
+)
+
+const redacted = "<redacted>"
+
+type ResourceChange int
+
+const (
+	ResourceAdded ResourceChange = iota + 1
+	ResourceChanged
+	ResourceRemoved
+)
+
+// Plan describes what upgrading a release to a chart would change.
+type Plan struct {
+	// Revision is the revision of the live release the chart was planned against.
+	Revision int
+
+	Resources []ResourceDiff
+
+	// Conflicts are the customer's values the values overlay would change.
+	Conflicts []ValueConflict
+}
+
+type ResourceDiff struct {
+	Change ResourceChange
+
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+
+	Fields []FieldChange
+}
+
+// FieldChange is a change to a single field. From and To are JSON-encoded, and empty when the field
+// was added or removed respectively.
+type FieldChange struct {
+	Path string
+	From string
+	To   string
+}
+
+// Plan renders the chart with a dry-run upgrade and diffs the result against the deployed release,
+// or its last revision if none is deployed. Values are merged as they would be by Upgrade.
+func (c *Cluster) Plan(ctx context.Context, chartData []byte, releaseName, namespace string, values Values) (*Plan, error) {
+	actionCfg, err := c.newActionConfig(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create action config: %w", err)
+	}
+
+	ch, err := loader.LoadArchive(bytes.NewReader(chartData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chart: %w", err)
+	}
+
+	return plan(ctx, actionCfg, ch, releaseName, namespace, values)
+}
+
+func plan(ctx context.Context, actionCfg *action.Configuration, ch *chart.Chart, releaseName, namespace string, values Values) (*Plan, error) {
+	live, err := current(actionCfg, releaseName)
+	if err != nil {
+		return nil, err
+	}
+
+	upgrade := action.NewUpgrade(actionCfg)
+	upgrade.Namespace = namespace
+	upgrade.DryRun = true
+
+	vals, err := values.configure(upgrade)
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts, err := checkValues(ch, live, values)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("planning upgrade of release %q in namespace %q with the %s values strategy", releaseName, namespace, values.Strategy)
+
+	planned, err := upgrade.RunWithContext(ctx, releaseName, ch, vals)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render chart: %w", err)
+	}
+
+	resources, err := DiffManifests(live.Manifest, planned.Manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Plan{
+		Revision:  live.Version,
+		Resources: resources,
+		Conflicts: conflicts,
+	}, nil
+}
+
+type resourceKey struct {
+	apiVersion, kind, namespace, name string
+}
+
+// DiffManifests compares two rendered Helm manifests and returns every resource that was added,
+// changed or removed, in a stable order. Values under the data and stringData of Secrets, including
+// the Secrets in a List, are redacted.
+func DiffManifests(from, to string) ([]ResourceDiff, error) {
+	fromObjs, err := parseManifest(from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse live manifest: %w", err)
+	}
+
+	toObjs, err := parseManifest(to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse planned manifest: %w", err)
+	}
+
+	var diffs []ResourceDiff
+	for key, toObj := range toObjs {
+		fromObj, ok := fromObjs[key]
+		if !ok {
+			diffs = append(diffs, newResourceDiff(ResourceAdded, key, nil))
+			continue
+		}
+
+		var fields []FieldChange
+		diffValues("", fromObj, toObj, &fields)
+		if len(fields) == 0 {
+			continue
+		}
+
+		redactSecretFields(fields, fromObj, toObj)
+		diffs = append(diffs, newResourceDiff(ResourceChanged, key, fields))
+	}
+
+	for key := range fromObjs {
+		if _, ok := toObjs[key]; !ok {
+			diffs = append(diffs, newResourceDiff(ResourceRemoved, key, nil))
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		a, b := diffs[i], diffs[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.APIVersion < b.APIVersion
+	})
+
+	return diffs, nil
+}
+
+func newResourceDiff(change ResourceChange, key resourceKey, fields []FieldChange) ResourceDiff {
+	return ResourceDiff{
+		Change:     change,
+		APIVersion: key.apiVersion,
+		Kind:       key.kind,
+		Namespace:  key.namespace,
+		Name:       key.name,
+		Fields:     fields,
+	}
+}
+
+func parseManifest(manifest string) (map[resourceKey]map[string]any, error) {
+	objs := map[resourceKey]map[string]any{}
+
+	for _, doc := range releaseutil.SplitManifests(manifest) {
+		var obj map[string]any
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+			return nil, err
+		}
+		if len(obj) == 0 {
+			continue
+		}
+
+		metadata, _ := obj["metadata"].(map[string]any)
+		key := resourceKey{
+			apiVersion: stringField(obj, "apiVersion"),
+			kind:       stringField(obj, "kind"),
+			namespace:  stringField(metadata, "namespace"),
+			name:       stringField(metadata, "name"),
+		}
+		objs[key] = obj
+	}
+
+	return objs, nil
+}
+
+func stringField(obj map[string]any, field string) string {
+	s, _ := obj[field].(string)
+	return s
+}
+
+// diffValues appends a FieldChange for every leaf that differs between from and to. Maps are
+// compared key by key and lists index by index; anything else is compared as a whole.
+func diffValues(path string, from, to any, fields *[]FieldChange) {
+	fromMap, fromIsMap := from.(map[string]any)
+	toMap, toIsMap := to.(map[string]any)
+	if fromIsMap && toIsMap {
+		keys := map[string]struct{}{}
+		for k := range fromMap {
+			keys[k] = struct{}{}
+		}
+		for k := range toMap {
+			keys[k] = struct{}{}
+		}
+
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+
+		for _, k := range sorted {
+			fromV, inFrom := fromMap[k]
+			toV, inTo := toMap[k]
+			switch {
+			case !inFrom:
+				*fields = append(*fields, FieldChange{Path: joinPath(path, k), To: encodeValue(toV)})
+			case !inTo:
+				*fields = append(*fields, FieldChange{Path: joinPath(path, k), From: encodeValue(fromV)})
+			default:
+				diffValues(joinPath(path, k), fromV, toV, fields)
+			}
+		}
+		return
+	}
+
+	fromList, fromIsList := from.([]any)
+	toList, toIsList := to.([]any)
+	if fromIsList && toIsList {
+		for i := 0; i < max(len(fromList), len(toList)); i++ {
+			elemPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(fromList):
+				*fields = append(*fields, FieldChange{Path: elemPath, To: encodeValue(toList[i])})
+			case i >= len(toList):
+				*fields = append(*fields, FieldChange{Path: elemPath, From: encodeValue(fromList[i])})
+			default:
+				diffValues(elemPath, fromList[i], toList[i], fields)
+			}
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(from, to) {
+		*fields = append(*fields, FieldChange{Path: path, From: encodeValue(from), To: encodeValue(to)})
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func encodeValue(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// redactSecretFields redacts the changes to the Secrets in either version of a resource, see
+// eachSecret. Changes to their data and stringData are redacted outright, and Secrets added to or
+// removed from a List keep their other fields.
+func redactSecretFields(fields []FieldChange, objs ...map[string]any) {
+	var secrets []string
+	for _, obj := range objs {
+		eachSecret(obj, func(path string, _ map[string]any) {
+			secrets = append(secrets, path)
+		})
+	}
+
+	for i, f := range fields {
+		for _, secret := range secrets {
+			switch {
+			case f.Path == secret:
+				fields[i].From = redactEncodedSecret(f.From)
+				fields[i].To = redactEncodedSecret(f.To)
+			case isSecretValuePath(secret, f.Path), within(f.Path, secret):
+				// A field holding the Secret's values, or a List holding the Secret.
+				if f.From != "" {
+					fields[i].From = redacted
+				}
+				if f.To != "" {
+					fields[i].To = redacted
+				}
+			default:
+				continue
+			}
+			break
+		}
+	}
+}
+
+// isSecretValuePath reports whether path is under the data or stringData of the Secret at secret.
+func isSecretValuePath(secret, path string) bool {
+	for _, field := range []string{"data", "stringData"} {
+		if p := joinPath(secret, field); path == p || within(p, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// within reports whether the path is a field or item under parent.
+func within(parent, path string) bool {
+	if parent == "" {
+		return path != ""
+	}
+	return strings.HasPrefix(path, parent+".") || strings.HasPrefix(path, parent+"[")
+}
+
+func redactEncodedSecret(v string) string {
+	if v == "" {
+		return ""
+	}
+
+	var secret map[string]any
+	if err := json.Unmarshal([]byte(v), &secret); err != nil {
+		return redacted
+	}
+	redactSecret(secret)
+	return encodeValue(secret)
+}
+
+// eachSecret calls fn with every Secret in a manifest resource: the resource itself if it is a
+// Secret, or the Secrets among its items if it is a List. path locates the Secret in obj, "" for
+// obj itself and eg: "items[1]" for an item.
+func eachSecret(obj map[string]any, fn func(path string, secret map[string]any)) {
+	kind := stringField(obj, "kind")
+	if kind == "Secret" {
+		fn("", obj)
+		return
+	}
+	if !strings.HasSuffix(kind, "List") {
+		return
+	}
+
+	items, _ := obj["items"].([]any)
+	for i, item := range items {
+		if item, ok := item.(map[string]any); ok && stringField(item, "kind") == "Secret" {
+			fn(fmt.Sprintf("items[%d]", i), item)
+		}
+	}
+}
+
+// redactSecret redacts the values of a Secret's data and stringData in place, keeping their keys.
+func redactSecret(secret map[string]any) {
+	for _, field := range []string{"data", "stringData"} {
+		if data, ok := secret[field].(map[string]any); ok {
+			secret[field] = redactValues(data, true)
+		} else if secret[field] != nil {
+			secret[field] = redacted
+		}
+	}
+}
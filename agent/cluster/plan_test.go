@@ -0,0 +1,212 @@
+package cluster
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+const liveManifest = `---
+# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: default
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+        - name: web
+          image: web:1.0.0
+---
+# Source: app/templates/secrets.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: web-secrets
+data:
+  password: b2xk
+---
+# Source: app/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  ports:
+    - port: 80
+`
+
+const plannedManifest = `---
+# Source: app/templates/config.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web-config
+data:
+  KEY: value
+---
+# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: default
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+        - name: web
+          image: web:1.1.0
+---
+# Source: app/templates/secrets.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: web-secrets
+data:
+  password: bmV3
+`
+
+func TestPlanNothingDeployed(t *testing.T) {
+	actionCfg := newUpgradeConfig(t, &waitKubeClient{})
+	failDeployed(t, actionCfg)
+
+	p, err := plan(context.Background(), actionCfg, upgradedChart(), "app", "app", Values{Strategy: ValuesOverlay, Overlay: []byte("ingress:\n  host: app.vendor.com\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Revision != 1 || len(p.Resources) != 1 || p.Resources[0].Name != "app" {
+		t.Errorf("Expected the ConfigMap to be added to revision 1, got %+v", p)
+	}
+	if len(p.Conflicts) != 1 || p.Conflicts[0].Path != "ingress.host" {
+		t.Errorf("Expected the overlay to conflict with the failed revision's values, got %+v", p.Conflicts)
+	}
+}
+
+func TestDiffManifests(t *testing.T) {
+	diffs, err := DiffManifests(liveManifest, plannedManifest)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []ResourceDiff{
+		{Change: ResourceAdded, APIVersion: "v1", Kind: "ConfigMap", Name: "web-config"},
+		{Change: ResourceChanged, APIVersion: "apps/v1", Kind: "Deployment", Namespace: "default", Name: "web", Fields: []FieldChange{
+			{Path: "spec.replicas", From: "1", To: "2"},
+			{Path: "spec.template.spec.containers[0].image", From: `"web:1.0.0"`, To: `"web:1.1.0"`},
+		}},
+		{Change: ResourceChanged, APIVersion: "v1", Kind: "Secret", Name: "web-secrets", Fields: []FieldChange{
+			{Path: "data.password", From: redacted, To: redacted},
+		}},
+		{Change: ResourceRemoved, APIVersion: "v1", Kind: "Service", Name: "web"},
+	}
+
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, diffs)
+	}
+}
+
+func TestDiffManifestsUnchanged(t *testing.T) {
+	diffs, err := DiffManifests(liveManifest, liveManifest)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("Expected no diffs, got %+v", diffs)
+	}
+}
+
+func TestDiffManifestsSecretList(t *testing.T) {
+	live := `---
+# Source: app/templates/secrets.yaml
+apiVersion: v1
+kind: List
+items:
+  - apiVersion: v1
+    kind: Secret
+    metadata:
+      name: web-secrets
+    stringData:
+      password: hunter2
+`
+	planned := `---
+# Source: app/templates/secrets.yaml
+apiVersion: v1
+kind: List
+items:
+  - apiVersion: v1
+    kind: Secret
+    metadata:
+      name: web-secrets
+    stringData:
+      password: letmein
+  - apiVersion: v1
+    kind: Secret
+    metadata:
+      name: web-tokens
+    data:
+      token: dG9rZW4=
+`
+
+	diffs, err := DiffManifests(live, planned)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []ResourceDiff{
+		{Change: ResourceChanged, APIVersion: "v1", Kind: "List", Fields: []FieldChange{
+			{Path: "items[0].stringData.password", From: redacted, To: redacted},
+			{Path: "items[1]", To: encodeValue(map[string]any{
+				"apiVersion": "v1",
+				"kind":       "Secret",
+				"metadata":   map[string]any{"name": "web-tokens"},
+				"data":       map[string]any{"token": redacted},
+			})},
+		}},
+	}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, diffs)
+	}
+}
+
+func TestDiffValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     any
+		to       any
+		expected []FieldChange
+	}{
+		{
+			name:     "added key",
+			from:     map[string]any{},
+			to:       map[string]any{"a": "b"},
+			expected: []FieldChange{{Path: "a", To: `"b"`}},
+		},
+		{
+			name:     "removed list element",
+			from:     map[string]any{"a": []any{"x", "y"}},
+			to:       map[string]any{"a": []any{"x"}},
+			expected: []FieldChange{{Path: "a[1]", From: `"y"`}},
+		},
+		{
+			name:     "type change",
+			from:     map[string]any{"a": "1"},
+			to:       map[string]any{"a": map[string]any{"b": 1}},
+			expected: []FieldChange{{Path: "a", From: `"1"`, To: `{"b":1}`}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fields []FieldChange
+			diffValues("", tt.from, tt.to, &fields)
+			if !reflect.DeepEqual(fields, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// ReleaseStatus is a revision of a Helm release.
+type ReleaseStatus struct {
+	Name      string
+	Namespace string
+	Revision  int
+
+	// Status is the Helm status of the revision, eg: "deployed", "failed" or "pending-upgrade".
+	Status string
+
+	// Description is Helm's description of the revision, eg: "Upgrade complete".
+	Description string
+
+	Chart        string
+	ChartVersion string
+	AppVersion   string
+	UpdatedAt    time.Time
+}
+
+// Releases returns the latest revision of every release in the namespace.
+func (c *Cluster) Releases(ctx context.Context, namespace string) ([]ReleaseStatus, error) {
+	actionCfg, err := c.newActionConfig(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create action config: %w", err)
+	}
+
+	return releases(actionCfg)
+}
+
+func releases(actionCfg *action.Configuration) ([]ReleaseStatus, error) {
+	list := action.NewList(actionCfg)
+	list.All = true
+	list.SetStateMask()
+
+	rels, err := list.Run()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list releases: %w", err)
+	}
+
+	statuses := make([]ReleaseStatus, 0, len(rels))
+	for _, rel := range rels {
+		statuses = append(statuses, releaseStatus(rel))
+	}
+
+	return statuses, nil
+}
+
+func releaseStatus(rel *release.Release) ReleaseStatus {
+	status := ReleaseStatus{
+		Name:      rel.Name,
+		Namespace: rel.Namespace,
+		Revision:  rel.Version,
+	}
+	if rel.Info != nil {
+		status.Status = rel.Info.Status.String()
+		status.Description = rel.Info.Description
+		status.UpdatedAt = rel.Info.LastDeployed.Time
+	}
+	if rel.Chart != nil && rel.Chart.Metadata != nil {
+		status.Chart = rel.Chart.Metadata.Name
+		status.ChartVersion = rel.Chart.Metadata.Version
+		status.AppVersion = rel.Chart.Metadata.AppVersion
+	}
+	return status
+}
@@ -0,0 +1,61 @@
+package cluster
+
+import (
+	"log"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	helmtime "helm.sh/helm/v3/pkg/time"
+)
+
+func newRelease(name string, version int, status release.Status, chartVersion string) *release.Release {
+	return &release.Release{
+		Name:      name,
+		Namespace: "app",
+		Version:   version,
+		Info:      &release.Info{Status: status, LastDeployed: helmtime.Time{Time: time.Date(2024, 6, 1, 0, version, 0, 0, time.UTC)}},
+		Chart:     &chart.Chart{Metadata: &chart.Metadata{Name: name, Version: chartVersion, AppVersion: "1.0"}},
+	}
+}
+
+func TestReleases(t *testing.T) {
+	store := storage.Init(driver.NewMemory())
+	for _, rel := range []*release.Release{
+		newRelease("web", 1, release.StatusSuperseded, "0.1.0"),
+		newRelease("web", 2, release.StatusDeployed, "0.2.0"),
+		newRelease("worker", 1, release.StatusFailed, "0.1.0"),
+	} {
+		if err := store.Create(rel); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	statuses, err := releases(&action.Configuration{Releases: store, KubeClient: &kubefake.PrintingKubeClient{}, Log: log.Printf})
+	if err != nil {
+		t.Fatalf("releases() returned error: %v", err)
+	}
+
+	if len(statuses) != 2 {
+		t.Fatalf("Expected the latest revision of 2 releases, got %+v", statuses)
+	}
+	for _, s := range statuses {
+		switch s.Name {
+		case "web":
+			if s.Revision != 2 || s.Status != "deployed" || s.ChartVersion != "0.2.0" || s.UpdatedAt.Minute() != 2 {
+				t.Errorf("Unexpected status %+v", s)
+			}
+		case "worker":
+			if s.Revision != 1 || s.Status != "failed" {
+				t.Errorf("Unexpected status %+v", s)
+			}
+		default:
+			t.Errorf("Unexpected release %+v", s)
+		}
+	}
+}
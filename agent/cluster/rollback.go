@@ -0,0 +1,213 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"agent/backup"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+// ErrUpgradeInterrupted is the reason given when a release left pending by an interrupted upgrade
+// is rolled back.
+var ErrUpgradeInterrupted = errors.New("upgrade was interrupted before it completed")
+
+// RolledBackError is returned by UpgradeWithRollback when a failed upgrade has been rolled back.
+type RolledBackError struct {
+	// Err is the reason the upgrade was rolled back.
+	Err error
+
+	FromRevision int
+	ToRevision   int
+
+	// RollbackErr is the error returned by the rollback itself, nil if it succeeded.
+	RollbackErr error
+
+	// Backups are the backups taken of ToRevision before it was upgraded. They are filled in by the
+	// caller, which knows where backups are recorded.
+	Backups []backup.Reference
+}
+
+func (e *RolledBackError) Error() string {
+	if e.RollbackErr != nil {
+		return fmt.Sprintf("%s; rollback to revision %d failed: %s", e.Err, e.ToRevision, e.RollbackErr)
+	}
+	return fmt.Sprintf("%s; rolled back to revision %d", e.Err, e.ToRevision)
+}
+
+func (e *RolledBackError) Unwrap() error {
+	return e.Err
+}
+
+// UpgradeWithRollback upgrades the release and waits up to readyTimeout for its Deployments and
+// StatefulSets to become ready. If the upgrade fails or the workloads don't become ready in time,
+// the release is rolled back to the revision that was deployed before the upgrade and a
+// *RolledBackError is returned. A release without a deployed revision is upgraded but not rolled
+// back. Errors from before the upgrade created a revision, eg: values that don't match the chart's
+// schema, are returned as they are, with the release untouched.
+func (c *Cluster) UpgradeWithRollback(ctx context.Context, chartData []byte, releaseName, namespace string, values Values, readyTimeout time.Duration) (*release.Release, error) {
+	actionCfg, err := c.newActionConfig(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create action config: %w", err)
+	}
+
+	ch, err := loader.LoadArchive(bytes.NewReader(chartData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chart: %w", err)
+	}
+
+	return upgradeWithRollback(ctx, actionCfg, ch, releaseName, namespace, values, readyTimeout)
+}
+
+func upgradeWithRollback(ctx context.Context, actionCfg *action.Configuration, ch *chart.Chart, releaseName, namespace string, values Values, readyTimeout time.Duration) (*release.Release, error) {
+	before, err := actionCfg.Releases.Last(releaseName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find release: %w", err)
+	}
+
+	// A release whose upgrades have all failed has no deployed revision. It can still be upgraded,
+	// as Helm does, but there is nothing to roll it back to.
+	previous, err := actionCfg.Releases.Deployed(releaseName)
+	if err != nil && !errors.Is(err, driver.ErrNoDeployedReleases) {
+		return nil, fmt.Errorf("failed to find deployed release: %w", err)
+	}
+
+	rel, err := upgrade(ctx, actionCfg, ch, releaseName, namespace, values)
+	if err == nil {
+		err = waitForWorkloads(ctx, actionCfg, rel, readyTimeout)
+		if err == nil {
+			return rel, nil
+		}
+	}
+
+	last, lastErr := actionCfg.Releases.Last(releaseName)
+	if lastErr != nil {
+		return nil, errors.Join(err, fmt.Errorf("failed to find the upgraded revision: %w", lastErr))
+	}
+	if last.Version <= before.Version {
+		// The upgrade failed before it created a revision, there is nothing to roll back.
+		return nil, err
+	}
+	if previous == nil {
+		return nil, fmt.Errorf("%w; not rolled back, release %q had no deployed revision before the upgrade", err, releaseName)
+	}
+
+	rolledBack := &RolledBackError{
+		Err:          err,
+		FromRevision: last.Version,
+		ToRevision:   previous.Version,
+	}
+
+	if ctx.Err() != nil {
+		// The agent is shutting down, the rollback couldn't finish before it exits.
+		rolledBack.RollbackErr = fmt.Errorf("not rolled back: %w", ctx.Err())
+		return nil, rolledBack
+	}
+
+	log.Printf("upgrade of release %q failed, rolling back to revision %d: %v", releaseName, previous.Version, err)
+
+	rolledBack.RollbackErr = rollback(actionCfg, releaseName, namespace, previous.Version, readyTimeout)
+
+	return nil, rolledBack
+}
+
+// RecoverInterruptedUpgrade rolls back a release whose last revision is stuck pending, which
+// happens when the process running the upgrade dies part way through. It must only be called when
+// nothing else is upgrading the release. It returns nil if the release isn't pending, and otherwise
+// a *RolledBackError wrapping ErrUpgradeInterrupted.
+func (c *Cluster) RecoverInterruptedUpgrade(ctx context.Context, releaseName, namespace string, timeout time.Duration) error {
+	actionCfg, err := c.newActionConfig(namespace)
+	if err != nil {
+		return fmt.Errorf("failed to create action config: %w", err)
+	}
+
+	last, err := actionCfg.Releases.Last(releaseName)
+	if err != nil {
+		return fmt.Errorf("failed to find release: %w", err)
+	}
+
+	if !last.Info.Status.IsPending() {
+		return nil
+	}
+
+	previous, err := actionCfg.Releases.Deployed(releaseName)
+	if err != nil {
+		return fmt.Errorf("release %q is stuck in %s with no deployed revision to roll back to: %w", releaseName, last.Info.Status, err)
+	}
+
+	log.Printf("release %q revision %d is stuck in %s, rolling back to revision %d", releaseName, last.Version, last.Info.Status, previous.Version)
+
+	return &RolledBackError{
+		Err:          ErrUpgradeInterrupted,
+		FromRevision: last.Version,
+		ToRevision:   previous.Version,
+		RollbackErr:  rollback(actionCfg, releaseName, namespace, previous.Version, timeout),
+	}
+}
+
+// Rollback rolls the release back to the given revision and waits up to timeout for it to become ready.
+func (c *Cluster) Rollback(ctx context.Context, releaseName, namespace string, revision int, timeout time.Duration) error {
+	actionCfg, err := c.newActionConfig(namespace)
+	if err != nil {
+		return fmt.Errorf("failed to create action config: %w", err)
+	}
+
+	return rollback(actionCfg, releaseName, namespace, revision, timeout)
+}
+
+func rollback(actionCfg *action.Configuration, releaseName, namespace string, revision int, timeout time.Duration) error {
+	rollback := action.NewRollback(actionCfg)
+	rollback.Version = revision
+	rollback.Wait = true
+	rollback.Timeout = timeout
+	rollback.CleanupOnFail = true
+
+	if err := rollback.Run(releaseName); err != nil {
+		return fmt.Errorf("failed to roll back release: %w", err)
+	}
+
+	log.Printf("successfully rolled back release %q in namespace %q to revision %d", releaseName, namespace, revision)
+
+	return nil
+}
+
+// waitForWorkloads waits for the Deployments and StatefulSets in the release manifest to become
+// ready. It returns early if ctx is done, leaving Helm's wait to run out in the background.
+func waitForWorkloads(ctx context.Context, actionCfg *action.Configuration, rel *release.Release, timeout time.Duration) error {
+	resources, err := actionCfg.KubeClient.Build(bytes.NewBufferString(rel.Manifest), false)
+	if err != nil {
+		return fmt.Errorf("failed to build release resources: %w", err)
+	}
+
+	workloads := resources.Filter(func(info *resource.Info) bool {
+		kind := info.Mapping.GroupVersionKind.Kind
+		return kind == "Deployment" || kind == "StatefulSet"
+	})
+
+	log.Printf("waiting up to %s for %d workloads in release %q to become ready", timeout, len(workloads), rel.Name)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- actionCfg.KubeClient.Wait(workloads, timeout)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("release %q did not become ready within %s: %w", rel.Name, timeout, err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("stopped waiting for release %q to become ready: %w", rel.Name, ctx.Err())
+	}
+}
@@ -0,0 +1,232 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/kube"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// waitKubeClient returns the errors in waits from its successive waits, and nil once they run out.
+// A wait blocks until unblock is closed, if it is set.
+type waitKubeClient struct {
+	kubefake.PrintingKubeClient
+
+	mu      sync.Mutex
+	waits   []error
+	unblock chan struct{}
+}
+
+func (c *waitKubeClient) Wait(resources kube.ResourceList, timeout time.Duration) error {
+	if c.unblock != nil {
+		<-c.unblock
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.waits) == 0 {
+		return nil
+	}
+	err := c.waits[0]
+	c.waits = c.waits[1:]
+	return err
+}
+
+func newUpgradeConfig(t *testing.T, client kube.Interface) *action.Configuration {
+	t.Helper()
+
+	deployed := &release.Release{
+		Name:      "app",
+		Namespace: "app",
+		Version:   1,
+		Info:      &release.Info{Status: release.StatusDeployed},
+		Chart:     newValuesChart("0.1.0", map[string]any{"ingress": map[string]any{"host": ""}}),
+		Config:    map[string]any{"ingress": map[string]any{"host": "app.example.com"}},
+	}
+	store := storage.Init(driver.NewMemory())
+	if err := store.Create(deployed); err != nil {
+		t.Fatal(err)
+	}
+
+	return &action.Configuration{
+		Releases:     store,
+		KubeClient:   client,
+		Capabilities: chartutil.DefaultCapabilities,
+		Log:          log.Printf,
+	}
+}
+
+func upgradedChart() *chart.Chart {
+	ch := newValuesChart("0.2.0", map[string]any{"ingress": map[string]any{"host": ""}})
+	ch.Templates = []*chart.File{{Name: "templates/config.yaml", Data: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\ndata:\n  host: {{ .Values.ingress.host }}\n")}}
+	return ch
+}
+
+func revisions(t *testing.T, actionCfg *action.Configuration) []int {
+	t.Helper()
+
+	rels, err := actionCfg.Releases.History("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var versions []int
+	for _, rel := range rels {
+		versions = append(versions, rel.Version)
+	}
+	return versions
+}
+
+func TestUpgradeWithRollback(t *testing.T) {
+	actionCfg := newUpgradeConfig(t, &waitKubeClient{})
+
+	rel, err := upgradeWithRollback(context.Background(), actionCfg, upgradedChart(), "app", "app", Values{}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.Version != 2 || rel.Info.Status != release.StatusDeployed {
+		t.Errorf("Expected revision 2 to be deployed, got %d %s", rel.Version, rel.Info.Status)
+	}
+}
+
+func TestUpgradeWithRollbackFailsBeforeRevision(t *testing.T) {
+	actionCfg := newUpgradeConfig(t, &waitKubeClient{})
+
+	// Resetting the values loses the required ingress host, which Helm refuses before upgrading.
+	_, err := upgradeWithRollback(context.Background(), actionCfg, upgradedChart(), "app", "app", Values{Strategy: ValuesReset}, time.Minute)
+	if err == nil {
+		t.Fatal("Expected the upgrade to fail")
+	}
+
+	var rolledBack *RolledBackError
+	if errors.As(err, &rolledBack) {
+		t.Errorf("Expected no rollback for an upgrade that never started, got %v", err)
+	}
+	if got := revisions(t, actionCfg); len(got) != 1 {
+		t.Errorf("Expected the release to be untouched, got revisions %v", got)
+	}
+}
+
+func TestUpgradeWithRollbackWaitTimesOut(t *testing.T) {
+	timeout := errors.New("timed out waiting for the condition")
+	actionCfg := newUpgradeConfig(t, &waitKubeClient{waits: []error{timeout}})
+
+	_, err := upgradeWithRollback(context.Background(), actionCfg, upgradedChart(), "app", "app", Values{}, time.Minute)
+
+	var rolledBack *RolledBackError
+	if !errors.As(err, &rolledBack) {
+		t.Fatalf("Expected a RolledBackError, got %v", err)
+	}
+	if !errors.Is(err, timeout) || rolledBack.FromRevision != 2 || rolledBack.ToRevision != 1 || rolledBack.RollbackErr != nil {
+		t.Errorf("Unexpected rollback %+v", rolledBack)
+	}
+
+	deployed, err := actionCfg.Releases.Deployed("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deployed.Version != 3 || deployed.Chart.Metadata.Version != "0.1.0" {
+		t.Errorf("Expected revision 3 to redeploy chart 0.1.0, got revision %d of %s", deployed.Version, deployed.Chart.Metadata.Version)
+	}
+}
+
+func TestUpgradeWithRollbackRollbackFails(t *testing.T) {
+	actionCfg := newUpgradeConfig(t, &waitKubeClient{waits: []error{
+		errors.New("timed out waiting for the condition"),
+		errors.New("rollback timed out"),
+	}})
+
+	_, err := upgradeWithRollback(context.Background(), actionCfg, upgradedChart(), "app", "app", Values{}, time.Minute)
+
+	var rolledBack *RolledBackError
+	if !errors.As(err, &rolledBack) {
+		t.Fatalf("Expected a RolledBackError, got %v", err)
+	}
+	if rolledBack.RollbackErr == nil {
+		t.Errorf("Expected the rollback error to be reported, got %+v", rolledBack)
+	}
+}
+
+// failDeployed marks the deployed revision of the release failed, as if its only upgrade failed.
+func failDeployed(t *testing.T, actionCfg *action.Configuration) {
+	t.Helper()
+
+	rel, err := actionCfg.Releases.Deployed("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel.Info.Status = release.StatusFailed
+	if err := actionCfg.Releases.Update(rel); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpgradeWithRollbackNothingDeployed(t *testing.T) {
+	actionCfg := newUpgradeConfig(t, &waitKubeClient{})
+	failDeployed(t, actionCfg)
+
+	rel, err := upgradeWithRollback(context.Background(), actionCfg, upgradedChart(), "app", "app", Values{}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.Version != 2 || rel.Info.Status != release.StatusDeployed {
+		t.Errorf("Expected revision 2 to be deployed, got %d %s", rel.Version, rel.Info.Status)
+	}
+}
+
+func TestUpgradeWithRollbackNothingDeployedWaitTimesOut(t *testing.T) {
+	timeout := errors.New("timed out waiting for the condition")
+	actionCfg := newUpgradeConfig(t, &waitKubeClient{waits: []error{timeout}})
+	failDeployed(t, actionCfg)
+
+	_, err := upgradeWithRollback(context.Background(), actionCfg, upgradedChart(), "app", "app", Values{}, time.Minute)
+	if !errors.Is(err, timeout) {
+		t.Fatalf("Expected the wait to fail, got %v", err)
+	}
+
+	var rolledBack *RolledBackError
+	if errors.As(err, &rolledBack) {
+		t.Errorf("Expected no rollback without a deployed revision, got %v", err)
+	}
+	if got := revisions(t, actionCfg); len(got) != 2 {
+		t.Errorf("Expected the upgrade to leave revisions 1 and 2, got %v", got)
+	}
+}
+
+func TestUpgradeWithRollbackShutdown(t *testing.T) {
+	client := &waitKubeClient{unblock: make(chan struct{})}
+	defer close(client.unblock)
+	actionCfg := newUpgradeConfig(t, client)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, err := upgradeWithRollback(ctx, actionCfg, upgradedChart(), "app", "app", Values{}, time.Minute)
+		errs <- err
+	}()
+
+	// The wait blocks until the test ends, only the cancelled context can end the upgrade.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-errs:
+		var rolledBack *RolledBackError
+		if !errors.As(err, &rolledBack) || !errors.Is(rolledBack.RollbackErr, context.Canceled) {
+			t.Errorf("Expected the rollback to be skipped on shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected shutdown to interrupt the wait")
+	}
+}
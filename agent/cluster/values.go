@@ -0,0 +1,186 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// ValuesStrategy is how an upgrade treats the values the customer supplied when they installed or
+// last upgraded the release, eg: with helm install -f values.yaml.
+type ValuesStrategy int
+
+const (
+	// ValuesResetThenReuse uses the new chart's defaults with the customer's values merged over them.
+	ValuesResetThenReuse ValuesStrategy = iota
+
+	// ValuesReuse keeps the previous revision's values, including its chart's defaults, so that new
+	// chart defaults are ignored.
+	ValuesReuse
+
+	// ValuesReset uses only the new chart's defaults, discarding the customer's values.
+	ValuesReset
+
+	// ValuesOverlay merges the vendor's overlay over the customer's values, over the new chart's
+	// defaults. Where both set a value, the overlay's wins and a ValueConflict is reported.
+	ValuesOverlay
+)
+
+func (s ValuesStrategy) String() string {
+	switch s {
+	case ValuesResetThenReuse:
+		return "reset-then-reuse"
+	case ValuesReuse:
+		return "reuse"
+	case ValuesReset:
+		return "reset"
+	case ValuesOverlay:
+		return "overlay"
+	}
+	return fmt.Sprintf("ValuesStrategy(%d)", int(s))
+}
+
+// Values are the values an upgrade is rendered with. The zero value keeps the customer's values.
+type Values struct {
+	Strategy ValuesStrategy
+
+	// Overlay is YAML, only used by ValuesOverlay.
+	Overlay []byte
+}
+
+// ValueConflict is a value the customer set that an overlay changes. Customer and Overlay are
+// JSON-encoded, and redacted if the value's key looks sensitive.
+type ValueConflict struct {
+	Path     string
+	Customer string
+	Overlay  string
+}
+
+// configure sets up the upgrade for the strategy and returns the values to run it with.
+func (v Values) configure(upgrade *action.Upgrade) (map[string]any, error) {
+	switch v.Strategy {
+	case ValuesResetThenReuse:
+		upgrade.ResetThenReuseValues = true
+		return map[string]any{}, nil
+	case ValuesReuse:
+		upgrade.ReuseValues = true
+		return map[string]any{}, nil
+	case ValuesReset:
+		upgrade.ResetValues = true
+		return map[string]any{}, nil
+	case ValuesOverlay:
+		// The overlay takes the place of the values passed with helm upgrade -f.
+		upgrade.ResetThenReuseValues = true
+		overlay, err := chartutil.ReadValues(v.Overlay)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse values overlay: %w", err)
+		}
+		return overlay, nil
+	}
+	return nil, fmt.Errorf("unsupported values strategy %s", v.Strategy)
+}
+
+// CheckValues validates the values an upgrade of the release to the chart would be rendered with
+// against the chart's values schema, and returns the customer's values an overlay changes. The
+// customer's values are those of the deployed revision, or the last one if none is deployed. It runs
+// nothing in the cluster, so that invalid values are refused before an upgrade is attempted.
+func (c *Cluster) CheckValues(ctx context.Context, chartData []byte, releaseName, namespace string, values Values) ([]ValueConflict, error) {
+	actionCfg, err := c.newActionConfig(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create action config: %w", err)
+	}
+
+	ch, err := loader.LoadArchive(bytes.NewReader(chartData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chart: %w", err)
+	}
+
+	rel, err := current(actionCfg, releaseName)
+	if err != nil {
+		return nil, err
+	}
+
+	return checkValues(ch, rel, values)
+}
+
+func checkValues(ch *chart.Chart, current *release.Release, values Values) ([]ValueConflict, error) {
+	vals, err := values.configure(&action.Upgrade{})
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts []ValueConflict
+	if values.Strategy == ValuesOverlay {
+		valueConflicts("", current.Config, vals, false, &conflicts)
+	}
+
+	// Mirror how Helm merges the values, see action.Upgrade.
+	defaults := ch
+	switch values.Strategy {
+	case ValuesReuse:
+		previous, err := chartutil.CoalesceValues(current.Chart, current.Config)
+		if err != nil {
+			return conflicts, fmt.Errorf("failed to rebuild the previous values: %w", err)
+		}
+		withPrevious := *ch
+		withPrevious.Values = previous
+		defaults = &withPrevious
+		vals = chartutil.CoalesceTables(vals, current.Config)
+	case ValuesResetThenReuse, ValuesOverlay:
+		vals = chartutil.CoalesceTables(vals, current.Config)
+	}
+
+	coalesced, err := chartutil.CoalesceValues(defaults, vals)
+	if err != nil {
+		return conflicts, fmt.Errorf("failed to merge values: %w", err)
+	}
+	if err := chartutil.ValidateAgainstSchema(defaults, coalesced); err != nil {
+		return conflicts, fmt.Errorf("values don't match the chart's schema with the %s strategy: %w", values.Strategy, err)
+	}
+
+	return conflicts, nil
+}
+
+// valueConflicts appends a ValueConflict for every value set by both the customer and the overlay
+// to something different. Maps are compared key by key, anything else as a whole.
+func valueConflicts(path string, customer, overlay map[string]any, sensitive bool, conflicts *[]ValueConflict) {
+	keys := make([]string, 0, len(overlay))
+	for k := range overlay {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		customerV, ok := customer[k]
+		if !ok {
+			continue
+		}
+		overlayV := overlay[k]
+		keyPath := joinPath(path, k)
+		keySensitive := sensitive || sensitiveKey.MatchString(k)
+
+		customerMap, customerIsMap := customerV.(map[string]any)
+		overlayMap, overlayIsMap := overlayV.(map[string]any)
+		if customerIsMap && overlayIsMap {
+			valueConflicts(keyPath, customerMap, overlayMap, keySensitive, conflicts)
+			continue
+		}
+
+		// Compared encoded, since numbers may be decoded as different types.
+		conflict := ValueConflict{Path: keyPath, Customer: encodeValue(customerV), Overlay: encodeValue(overlayV)}
+		if conflict.Customer == conflict.Overlay {
+			continue
+		}
+		if keySensitive {
+			conflict.Customer, conflict.Overlay = redacted, redacted
+		}
+		*conflicts = append(*conflicts, conflict)
+	}
+}
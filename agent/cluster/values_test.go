@@ -0,0 +1,105 @@
+package cluster
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+const valuesSchema = `{
+  "type": "object",
+  "required": ["ingress"],
+  "properties": {
+    "replicas": {"type": "integer"},
+    "ingress": {
+      "type": "object",
+      "required": ["host"],
+      "properties": {"host": {"type": "string", "minLength": 1}}
+    }
+  }
+}`
+
+func newValuesChart(version string, values map[string]any) *chart.Chart {
+	return &chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "app", Version: version},
+		Values:   values,
+		Schema:   []byte(valuesSchema),
+	}
+}
+
+func TestCheckValues(t *testing.T) {
+	current := &release.Release{
+		Name:    "app",
+		Version: 1,
+		Chart:   newValuesChart("0.1.0", map[string]any{"replicas": 1, "ingress": map[string]any{"host": ""}}),
+		Config:  map[string]any{"ingress": map[string]any{"host": "app.example.com"}},
+	}
+	upgraded := newValuesChart("0.2.0", map[string]any{"replicas": 2, "ingress": map[string]any{"host": ""}})
+
+	tests := []struct {
+		name   string
+		values Values
+		err    string
+	}{
+		{name: "reset then reuse", values: Values{}},
+		{name: "reuse", values: Values{Strategy: ValuesReuse}},
+		{name: "reset", values: Values{Strategy: ValuesReset}, err: "ingress.host"},
+		{name: "overlay", values: Values{Strategy: ValuesOverlay, Overlay: []byte("replicas: 3\n")}},
+		{name: "invalid overlay", values: Values{Strategy: ValuesOverlay, Overlay: []byte("replicas: three\n")}, err: "replicas"},
+		{name: "malformed overlay", values: Values{Strategy: ValuesOverlay, Overlay: []byte("- not a map")}, err: "failed to parse values overlay"},
+	}
+	for _, tt := range tests {
+		_, err := checkValues(upgraded, current, tt.values)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: Unexpected error: %v", tt.name, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: Expected an error about %q, got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func TestCheckValuesConflicts(t *testing.T) {
+	current := &release.Release{
+		Name:    "app",
+		Version: 1,
+		Chart:   newValuesChart("0.1.0", map[string]any{"ingress": map[string]any{"host": ""}}),
+		Config: map[string]any{
+			"ingress":  map[string]any{"host": "app.example.com", "tls": true},
+			"replicas": 2,
+			"db":       map[string]any{"password": "hunter2"},
+		},
+	}
+	overlay := []byte(`
+ingress:
+  host: app.vendor.com
+  tls: true
+replicas: 2
+db:
+  password: changeme
+resources:
+  limits:
+    memory: 1Gi
+`)
+
+	conflicts, err := checkValues(newValuesChart("0.2.0", current.Chart.Values), current, Values{Strategy: ValuesOverlay, Overlay: overlay})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []ValueConflict{
+		{Path: "db.password", Customer: redacted, Overlay: redacted},
+		{Path: "ingress.host", Customer: `"app.example.com"`, Overlay: `"app.vendor.com"`},
+	}
+	if !reflect.DeepEqual(conflicts, expected) {
+		t.Errorf("Expected conflicts %+v, got %+v", expected, conflicts)
+	}
+
+	conflicts, err = checkValues(newValuesChart("0.2.0", current.Chart.Values), current, Values{})
+	if err != nil || len(conflicts) != 0 {
+		t.Errorf("Expected no conflicts without an overlay, got %+v, %v", conflicts, err)
+	}
+}
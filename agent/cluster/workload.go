@@ -0,0 +1,161 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	KindDeployment  = "Deployment"
+	KindStatefulSet = "StatefulSet"
+
+	// restartedAtAnnotation is the pod template annotation kubectl rollout restart sets.
+	restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+)
+
+// Workload is a Deployment or StatefulSet of a release.
+type Workload struct {
+	Kind      string
+	Namespace string
+	Name      string
+
+	// Replicas is the desired number of replicas.
+	Replicas int32
+}
+
+// RestartWorkloads restarts the release's Deployments and StatefulSets matching selector, which may
+// be empty, by rolling out new pods as kubectl rollout restart does. It doesn't wait for the rollout.
+func (c *Cluster) RestartWorkloads(ctx context.Context, releaseName, namespace, selector string) ([]Workload, error) {
+	client, err := c.Clientset()
+	if err != nil {
+		return nil, err
+	}
+
+	return restartWorkloads(ctx, client, releaseName, namespace, selector, time.Now())
+}
+
+func restartWorkloads(ctx context.Context, client kubernetes.Interface, releaseName, namespace, selector string, now time.Time) ([]Workload, error) {
+	sel, err := releaseSelector(releaseName, selector)
+	if err != nil {
+		return nil, err
+	}
+	opts := metav1.ListOptions{LabelSelector: sel}
+
+	deployments, err := client.AppsV1().Deployments(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	statefulSets, err := client.AppsV1().StatefulSets(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets: %w", err)
+	}
+
+	var workloads []Workload
+	for _, d := range deployments.Items {
+		workloads = append(workloads, Workload{Kind: KindDeployment, Namespace: namespace, Name: d.Name, Replicas: replicas(d.Spec.Replicas)})
+	}
+	for _, s := range statefulSets.Items {
+		workloads = append(workloads, Workload{Kind: KindStatefulSet, Namespace: namespace, Name: s.Name, Replicas: replicas(s.Spec.Replicas)})
+	}
+	if len(workloads) == 0 {
+		return nil, fmt.Errorf("release %s has no deployments or statefulsets matching %q", releaseName, sel)
+	}
+
+	patch := fmt.Appendf(nil, `{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`, restartedAtAnnotation, now.Format(time.RFC3339))
+	for _, w := range workloads {
+		if w.Kind == KindDeployment {
+			_, err = client.AppsV1().Deployments(namespace).Patch(ctx, w.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+		} else {
+			_, err = client.AppsV1().StatefulSets(namespace).Patch(ctx, w.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to restart %s %s: %w", w.Kind, w.Name, err)
+		}
+	}
+
+	return workloads, nil
+}
+
+// ScaleWorkload sets the replicas of a Deployment or StatefulSet of the release. Workloads that
+// don't carry the release's instance label are refused.
+func (c *Cluster) ScaleWorkload(ctx context.Context, releaseName, namespace, kind, name string, replicas int32) (Workload, error) {
+	client, err := c.Clientset()
+	if err != nil {
+		return Workload{}, err
+	}
+
+	return scaleWorkload(ctx, client, releaseName, namespace, kind, name, replicas)
+}
+
+func scaleWorkload(ctx context.Context, client kubernetes.Interface, releaseName, namespace, kind, name string, replicas int32) (Workload, error) {
+	if replicas < 0 {
+		return Workload{}, fmt.Errorf("invalid replicas %d", replicas)
+	}
+
+	var (
+		meta   metav1.ObjectMeta
+		update func(context.Context, string, *autoscalingv1.Scale, metav1.UpdateOptions) (*autoscalingv1.Scale, error)
+	)
+	switch kind {
+	case KindDeployment:
+		deployments := client.AppsV1().Deployments(namespace)
+		d, err := deployments.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return Workload{}, fmt.Errorf("failed to get deployment %s: %w", name, err)
+		}
+		meta, update = d.ObjectMeta, deployments.UpdateScale
+	case KindStatefulSet:
+		statefulSets := client.AppsV1().StatefulSets(namespace)
+		s, err := statefulSets.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return Workload{}, fmt.Errorf("failed to get statefulset %s: %w", name, err)
+		}
+		meta, update = s.ObjectMeta, statefulSets.UpdateScale
+	default:
+		return Workload{}, fmt.Errorf("unsupported workload kind %q, expected %s or %s", kind, KindDeployment, KindStatefulSet)
+	}
+
+	if meta.Labels[ReleaseInstanceLabel] != releaseName {
+		return Workload{}, fmt.Errorf("%s %s does not belong to release %s", kind, name, releaseName)
+	}
+
+	scale, err := update(ctx, name, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, ResourceVersion: meta.ResourceVersion},
+		Spec:       autoscalingv1.ScaleSpec{Replicas: replicas},
+	}, metav1.UpdateOptions{})
+	if err != nil {
+		return Workload{}, fmt.Errorf("failed to scale %s %s: %w", kind, name, err)
+	}
+
+	return Workload{Kind: kind, Namespace: namespace, Name: name, Replicas: scale.Spec.Replicas}, nil
+}
+
+// releaseSelector selects the resources of the release that also match selector.
+func releaseSelector(releaseName, selector string) (string, error) {
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		return "", fmt.Errorf("invalid label selector %q: %w", selector, err)
+	}
+
+	instance, err := labels.NewRequirement(ReleaseInstanceLabel, "=", []string{releaseName})
+	if err != nil {
+		return "", fmt.Errorf("invalid release name %q: %w", releaseName, err)
+	}
+
+	return sel.Add(*instance).String(), nil
+}
+
+// replicas returns the desired replicas of a workload, which default to 1.
+func replicas(r *int32) int32 {
+	if r == nil {
+		return 1
+	}
+	return *r
+}
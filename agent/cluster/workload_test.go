@@ -0,0 +1,125 @@
+package cluster
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func workloadMeta(name, release string, extra map[string]string) metav1.ObjectMeta {
+	labels := map[string]string{ReleaseInstanceLabel: release}
+	for k, v := range extra {
+		labels[k] = v
+	}
+	return metav1.ObjectMeta{Name: name, Namespace: "app", Labels: labels}
+}
+
+func TestRestartWorkloads(t *testing.T) {
+	three := int32(3)
+	client := fake.NewClientset(
+		&appsv1.Deployment{ObjectMeta: workloadMeta("web", "app", map[string]string{"tier": "web"}), Spec: appsv1.DeploymentSpec{Replicas: &three}},
+		&appsv1.Deployment{ObjectMeta: workloadMeta("worker", "app", map[string]string{"tier": "worker"})},
+		&appsv1.StatefulSet{ObjectMeta: workloadMeta("db", "app", map[string]string{"tier": "db"})},
+		&appsv1.Deployment{ObjectMeta: workloadMeta("other", "other", nil)},
+	)
+	ctx := context.Background()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	workloads, err := restartWorkloads(ctx, client, "app", "app", "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, w := range workloads {
+		got = append(got, w.Kind+"/"+w.Name)
+	}
+	if strings.Join(got, ",") != "Deployment/web,Deployment/worker,StatefulSet/db" {
+		t.Errorf("Expected the release's workloads to be restarted, got %v", got)
+	}
+	if workloads[0].Replicas != 3 || workloads[1].Replicas != 1 {
+		t.Errorf("Expected the desired replicas to be reported, got %+v", workloads)
+	}
+
+	web, _ := client.AppsV1().Deployments("app").Get(ctx, "web", metav1.GetOptions{})
+	if got := web.Spec.Template.Annotations[restartedAtAnnotation]; got != "2024-06-01T12:00:00Z" {
+		t.Errorf("Expected the pod template to be annotated, got %q", got)
+	}
+	other, _ := client.AppsV1().Deployments("app").Get(ctx, "other", metav1.GetOptions{})
+	if _, ok := other.Spec.Template.Annotations[restartedAtAnnotation]; ok {
+		t.Error("Expected another release's deployment to be left alone")
+	}
+
+	workloads, err = restartWorkloads(ctx, client, "app", "app", "tier in (db)", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(workloads) != 1 || workloads[0].Name != "db" {
+		t.Errorf("Expected the selector to narrow the restart, got %+v", workloads)
+	}
+
+	if _, err := restartWorkloads(ctx, client, "app", "app", "tier=cache", now); err == nil {
+		t.Error("Expected an error when no workloads match")
+	}
+	if _, err := restartWorkloads(ctx, client, "app", "app", "tier in (", now); err == nil {
+		t.Error("Expected an error for an invalid selector")
+	}
+}
+
+func TestScaleWorkload(t *testing.T) {
+	client := fake.NewClientset(
+		&appsv1.Deployment{ObjectMeta: workloadMeta("web", "app", nil)},
+		&appsv1.StatefulSet{ObjectMeta: workloadMeta("db", "app", nil)},
+		&appsv1.Deployment{ObjectMeta: workloadMeta("other", "other", nil)},
+	)
+
+	var scaled []string
+	client.PrependReactor("update", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "scale" {
+			return false, nil, nil
+		}
+		scale := action.(k8stesting.UpdateAction).GetObject().(*autoscalingv1.Scale)
+		scaled = append(scaled, action.GetResource().Resource+"/"+scale.Name)
+		return true, scale, nil
+	})
+	ctx := context.Background()
+
+	w, err := scaleWorkload(ctx, client, "app", "app", KindDeployment, "web", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w != (Workload{Kind: KindDeployment, Namespace: "app", Name: "web", Replicas: 4}) {
+		t.Errorf("Unexpected workload %+v", w)
+	}
+
+	if _, err := scaleWorkload(ctx, client, "app", "app", KindStatefulSet, "db", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		kind, name string
+		replicas   int32
+	}{
+		{KindDeployment, "other", 1},
+		{KindDeployment, "missing", 1},
+		{"DaemonSet", "web", 1},
+		{KindDeployment, "web", -1},
+	}
+	for _, tt := range tests {
+		if _, err := scaleWorkload(ctx, client, "app", "app", tt.kind, tt.name, tt.replicas); err == nil {
+			t.Errorf("%s/%s to %d: Expected an error", tt.kind, tt.name, tt.replicas)
+		}
+	}
+
+	if strings.Join(scaled, ",") != "deployments/web,statefulsets/db" {
+		t.Errorf("Expected only the release's workloads to be scaled, got %v", scaled)
+	}
+}
@@ -1,34 +1,78 @@
 package config
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"log"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 var (
 	flagSet = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+
+	configFile  = flagSet.String("config-file", "", "A YAML or JSON file of config variables, keyed by flag name. Flags and environment variables take precedence over it")
+	printConfig = flagSet.Bool("print-config", false, "Print the resolved configuration, with secrets redacted, and exit")
+
+	// vars are all the defined config variables, by name.
+	vars = map[string]variable{}
+
+	// fileValues holds the values read from the config file, by name. The map is replaced, not
+	// modified, when the file is reloaded.
+	fileMu      sync.RWMutex
+	fileValues  = map[string]string{}
+	fileModTime time.Time
 )
 
+// variable is a ConfigVar of any type.
+type variable interface {
+	// resolve returns the variable's value, given the config file's values, and where it was
+	// taken from.
+	resolve(file map[string]string) (any, string, error)
+	secret() bool
+
+	// listSeparator joins the items of a list given for the variable in the config file.
+	listSeparator() string
+}
+
+// Init parses the command line and loads the config file, exiting if any config variable has an
+// invalid value.
 func Init(args []string) {
 	flagSet.Parse(args)
+
+	if path := configFilePath(); path != "" {
+		if _, err := loadFile(path); err != nil {
+			log.Fatalf("Failed to load config file: %s", err)
+		}
+	}
+
+	if err := validate(currentFile()); err != nil {
+		log.Fatalf("Invalid config: %s", err)
+	}
 }
 
 type ConfigVar[T comparable] struct {
 	name         string
 	defaultValue T
 	required     bool
+	sensitive    bool
+	separator    string
 }
 
 func Define[T comparable](name string, defaultValue T, usage string) *ConfigVar[T] {
 	_ = flagSet.String(name, "", usage)
-	return &ConfigVar[T]{
+	c := &ConfigVar[T]{
 		name:         name,
 		defaultValue: defaultValue,
 	}
+	vars[name] = c
+	return c
 }
 
 func MustDefine[T comparable](name string, usage string) *ConfigVar[T] {
@@ -37,38 +81,71 @@ func MustDefine[T comparable](name string, usage string) *ConfigVar[T] {
 	return c
 }
 
+// Secret marks the variable as sensitive, so that its value is redacted when the config is printed.
+func (c *ConfigVar[T]) Secret() *ConfigVar[T] {
+	c.sensitive = true
+	return c
+}
+
+// ListSeparator sets the separator a list given for the variable in the config file is joined
+// with, so that it parses as the items separated on the command line would. It is a comma by
+// default.
+func (c *ConfigVar[T]) ListSeparator(sep string) *ConfigVar[T] {
+	c.separator = sep
+	return c
+}
+
+// Value returns the variable's value from, in order of precedence, its flag, its environment
+// variable, the config file, or its default.
 func (c *ConfigVar[T]) Value() (T, error) {
-	v := flagSet.Lookup(c.name)
+	v, _, err := c.value()
+	return v, err
+}
+
+func (c *ConfigVar[T]) value() (T, string, error) {
+	return c.valueFrom(currentFile())
+}
 
+func (c *ConfigVar[T]) valueFrom(file map[string]string) (T, string, error) {
 	var zero T
-	if v == nil {
-		return zero, fmt.Errorf("required flag %s not configured in this flag set", c.name)
-	}
 
-	parsed, err := parseType[T](v.Value.String())
-	if err != nil {
-		return zero, err
+	f := flagSet.Lookup(c.name)
+	if f == nil {
+		return zero, "", fmt.Errorf("required flag %s not configured in this flag set", c.name)
 	}
 
-	if parsed != zero {
-		return parsed, nil
-	}
+	env := nameToEnv(c.name)
+	fileValue, inFile := file[c.name]
 
-	envValue := os.Getenv(nameToEnv(c.name))
-	parsed, err = parseType[T](envValue)
-	if err != nil {
-		return zero, err
+	sources := []struct {
+		name  string
+		value string
+		set   bool
+	}{
+		{"flag --" + c.name, f.Value.String(), isSet(c.name)},
+		{"env " + env, os.Getenv(env), os.Getenv(env) != ""},
+		{"config file", fileValue, inFile},
 	}
 
-	if parsed != zero {
-		return parsed, nil
+	for _, s := range sources {
+		if !s.set {
+			continue
+		}
+
+		parsed, err := parseType[T](s.value)
+		if err != nil {
+			return zero, "", fmt.Errorf("invalid value %q for %s from %s: %w", s.value, c.name, s.name, err)
+		}
+		if parsed != zero || !c.required {
+			return parsed, s.name, nil
+		}
 	}
 
-	if c.required && parsed == zero {
-		return zero, fmt.Errorf("required config variable %s not set", c.name)
+	if c.required {
+		return zero, "", fmt.Errorf("required config variable %s not set", c.name)
 	}
 
-	return c.defaultValue, nil
+	return c.defaultValue, "default", nil
 }
 
 func (c *ConfigVar[T]) MustValue() T {
@@ -79,18 +156,135 @@ func (c *ConfigVar[T]) MustValue() T {
 	return v
 }
 
+func (c *ConfigVar[T]) resolve(file map[string]string) (any, string, error) {
+	return c.valueFrom(file)
+}
+
+func (c *ConfigVar[T]) secret() bool {
+	return c.sensitive
+}
+
+func (c *ConfigVar[T]) listSeparator() string {
+	if c.separator == "" {
+		return ","
+	}
+	return c.separator
+}
+
+// isSet reports whether the flag was given on the command line.
+func isSet(name string) bool {
+	set := false
+	flagSet.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// validate resolves every variable against the config file's values, so that invalid values are
+// reported together.
+func validate(file map[string]string) error {
+	var errs []error
+	for _, name := range names() {
+		if _, _, err := vars[name].resolve(file); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func names() []string {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func nameToEnv(name string) string {
 	return strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
 }
 
+func configFilePath() string {
+	if isSet("config-file") {
+		return *configFile
+	}
+	return os.Getenv(nameToEnv("config-file"))
+}
+
+// parseType parses v as a T. The empty string is T's zero value.
 func parseType[T comparable](v string) (T, error) {
 	var zero T
-	n, err := fmt.Sscanf(v, "%v", &zero)
-	if err != nil && err != io.EOF && n == 0 {
+	if v == "" {
+		return zero, nil
+	}
+
+	var parsed any
+	var err error
+
+	switch any(zero).(type) {
+	case string:
+		parsed = v
+	case bool:
+		parsed, err = strconv.ParseBool(v)
+	case int:
+		parsed, err = strconv.Atoi(v)
+	case int64:
+		parsed, err = strconv.ParseInt(v, 10, 64)
+	case float64:
+		parsed, err = strconv.ParseFloat(v, 64)
+	case time.Duration:
+		parsed, err = time.ParseDuration(v)
+	default:
+		return zero, fmt.Errorf("unsupported config type %T", zero)
+	}
+	if err != nil {
 		return zero, err
 	}
 
-	return zero, nil
+	return parsed.(T), nil
+}
+
+// Args returns the arguments left after the flags.
+func Args() []string {
+	return flagSet.Args()
+}
+
+// PrintRequested reports whether --print-config was given.
+func PrintRequested() bool {
+	return *printConfig
+}
+
+// Watch polls the config file for changes until ctx is done. Changes are applied only if every
+// variable is still valid, after which onReload is called. Invalid changes are logged and ignored.
+func Watch(ctx context.Context, interval time.Duration, onReload func()) {
+	path := configFilePath()
+	if path == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed, err := loadFile(path)
+		if err != nil {
+			log.Printf("Ignoring changed config file: %s", err)
+			continue
+		}
+		if changed {
+			log.Printf("Config file %s changed, reloading", path)
+			onReload()
+		}
+	}
 }
 
 func Production() bool {
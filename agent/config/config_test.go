@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 )
 
 func TestDefineString(t *testing.T) {
@@ -162,10 +163,17 @@ func TestParseType(t *testing.T) {
 		wantErr  bool
 	}{
 		{"string", "test", "test", false},
+		{"string-with-spaces", "Sat 02:00-04:00 UTC", "Sat 02:00-04:00 UTC", false},
 		{"int", "42", 42, false},
 		{"bool-true", "true", true, false},
 		{"bool-false", "false", false, false},
 		{"invalid-int", "not-an-int", 0, true},
+		{"int-trailing-garbage", "42 x", 0, true},
+		{"duration", "30s", 30 * time.Second, false},
+		{"duration-trailing-garbage", "30s x", time.Duration(0), true},
+		{"duration-without-unit", "30", time.Duration(0), true},
+		{"invalid-bool", "yes please", false, true},
+		{"empty", "", 0, false},
 	}
 
 	for _, tt := range tests {
@@ -198,6 +206,15 @@ func TestParseType(t *testing.T) {
 				if result != tt.expected {
 					t.Errorf("Expected %v, got %v", tt.expected, result)
 				}
+			case time.Duration:
+				result, err := parseType[time.Duration](tt.input)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("parseType() error = %v, wantErr %v", err, tt.wantErr)
+					return
+				}
+				if result != tt.expected {
+					t.Errorf("Expected %v, got %v", tt.expected, result)
+				}
 			}
 		})
 	}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+func currentFile() map[string]string {
+	fileMu.RLock()
+	defer fileMu.RUnlock()
+	return fileValues
+}
+
+// loadFile reads the config file if it changed since it was last read, and reports whether it did.
+// The new values replace the old ones only if every variable is valid with them.
+func loadFile(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	fileMu.Lock()
+	unchanged := info.ModTime().Equal(fileModTime)
+	// An invalid file is reported once, not every time it is polled.
+	fileModTime = info.ModTime()
+	fileMu.Unlock()
+	if unchanged {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	values, err := parseFile(data)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validate(values); err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+
+	fileMu.Lock()
+	fileValues = values
+	fileMu.Unlock()
+
+	return true, nil
+}
+
+// parseFile parses a YAML or JSON object of config variables keyed by flag name. Lists are joined
+// with the variable's list separator, and null values are ignored.
+func parseFile(data []byte) (map[string]string, error) {
+	j, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]any
+	dec := json.NewDecoder(bytes.NewReader(j))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("expected an object of config variables: %w", err)
+	}
+
+	values := map[string]string{}
+	for name, v := range raw {
+		variable, ok := vars[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown config variable %s", name)
+		}
+		if v == nil {
+			continue
+		}
+
+		value, err := listOrScalar(v, variable.listSeparator())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		values[name] = value
+	}
+
+	return values, nil
+}
+
+func listOrScalar(v any, sep string) (string, error) {
+	items, ok := v.([]any)
+	if !ok {
+		return scalar(v)
+	}
+
+	parts := make([]string, 0, len(items))
+	for _, item := range items {
+		part, err := scalar(item)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, sep), nil
+}
+
+func scalar(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case []any:
+		return "", fmt.Errorf("nested lists are not supported")
+	default:
+		return "", fmt.Errorf("expected a scalar or a list, got %T", v)
+	}
+}
+
+// Print writes the resolved configuration as YAML, commented with where each value was taken from,
+// so that it can be used as a config file. Secrets are redacted, and invalid values are commented
+// out with their error.
+func Print(w io.Writer) error {
+	file := currentFile()
+
+	for _, name := range names() {
+		v := vars[name]
+		value, source, err := v.resolve(file)
+		if err != nil {
+			if _, err := fmt.Fprintf(w, "# %s: %s\n", name, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+		if v.secret() && fmt.Sprint(value) != "" {
+			value = "<redacted>"
+		}
+
+		out, err := yaml.Marshal(map[string]any{name: value})
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "# from %s\n%s", source, out); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"agent/logship"
+	"agent/policy"
+)
+
+func writeConfigFile(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Set the modification time explicitly, as consecutive writes may share a timestamp.
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+// isolate hides the variables defined by other tests, which may be invalid, and restores them and
+// the config file's values when t finishes.
+func isolate(t *testing.T) {
+	saved := vars
+	vars = map[string]variable{}
+	t.Cleanup(func() {
+		vars = saved
+		fileValues = map[string]string{}
+		fileModTime = time.Time{}
+	})
+}
+
+func TestLoadFile(t *testing.T) {
+	isolate(t)
+
+	interval := Define("file-interval", time.Minute, "test usage")
+	windows := Define("file-windows", "", "test usage")
+	pins := Define("file-pins", "", "test usage")
+	envOverride := Define("file-env-override", 1, "test usage")
+
+	os.Setenv("FILE_ENV_OVERRIDE", "3")
+	defer os.Unsetenv("FILE_ENV_OVERRIDE")
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	now := time.Now()
+	writeConfigFile(t, path, `
+file-interval: 30s
+file-windows: Sat 02:00-04:00 UTC
+file-pins: [aa, bb]
+file-env-override: 2
+`, now)
+
+	changed, err := loadFile(path)
+	if err != nil || !changed {
+		t.Fatalf("loadFile() = %v, %v, want true, nil", changed, err)
+	}
+
+	if v := interval.MustValue(); v != 30*time.Second {
+		t.Errorf("Expected 30s, got %v", v)
+	}
+	if v := windows.MustValue(); v != "Sat 02:00-04:00 UTC" {
+		t.Errorf("Expected windows from file, got %q", v)
+	}
+	if v := pins.MustValue(); v != "aa,bb" {
+		t.Errorf("Expected list to be joined, got %q", v)
+	}
+	if v := envOverride.MustValue(); v != 3 {
+		t.Errorf("Expected env to take precedence over the file, got %v", v)
+	}
+
+	if changed, err := loadFile(path); err != nil || changed {
+		t.Errorf("loadFile() of unchanged file = %v, %v, want false, nil", changed, err)
+	}
+
+	// Invalid changes are rejected and the previous values kept.
+	writeConfigFile(t, path, "file-interval: 30s x\n", now.Add(time.Minute))
+	if _, err := loadFile(path); err == nil || !strings.Contains(err.Error(), "file-interval") {
+		t.Errorf("Expected error naming file-interval, got %v", err)
+	}
+	if v := interval.MustValue(); v != 30*time.Second {
+		t.Errorf("Expected previous value to be kept, got %v", v)
+	}
+
+	writeConfigFile(t, path, "file-interval: 2m\n", now.Add(2*time.Minute))
+	if changed, err := loadFile(path); err != nil || !changed {
+		t.Fatalf("loadFile() = %v, %v, want true, nil", changed, err)
+	}
+	if v := interval.MustValue(); v != 2*time.Minute {
+		t.Errorf("Expected 2m, got %v", v)
+	}
+	if v := windows.MustValue(); v != "" {
+		t.Errorf("Expected removed value to fall back to its default, got %q", v)
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	isolate(t)
+	Define("parse-file-var", "", "test usage")
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"yaml", "parse-file-var: value", "value", false},
+		{"json", `{"parse-file-var": 42}`, "42", false},
+		{"large number", "parse-file-var: 10000000", "10000000", false},
+		{"unknown variable", "not-a-var: value", "", true},
+		{"nested object", "parse-file-var: {a: b}", "", true},
+		{"not an object", "- value", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := parseFile([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && values["parse-file-var"] != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, values["parse-file-var"])
+			}
+		})
+	}
+}
+
+func TestParseFileListSeparators(t *testing.T) {
+	isolate(t)
+	// As main defines them, so that the joined lists parse as the agent parses them.
+	windows := Define("maintenance-windows", "", "test usage").ListSeparator(";")
+	redactions := Define("log-redaction-patterns", "", "test usage").ListSeparator("\n")
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfigFile(t, path, `
+maintenance-windows:
+  - Sat 02:00-04:00 UTC
+  - Sun 02:00-04:00 UTC
+log-redaction-patterns:
+  - 'password=\S+'
+  - 'token-[a-z]{2,4}'
+`, time.Now())
+	if _, err := loadFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	parsedWindows, err := policy.ParseWindows(windows.MustValue())
+	if err != nil || len(parsedWindows) != 2 {
+		t.Errorf("Expected 2 maintenance windows, got %v, %v", parsedWindows, err)
+	}
+
+	res, err := logship.ParseRedactions(redactions.MustValue())
+	if err != nil || len(res) != 2 {
+		t.Fatalf("Expected 2 redaction patterns, got %v, %v", res, err)
+	}
+	if res[1].String() != "token-[a-z]{2,4}" {
+		t.Errorf("Expected the second pattern to be kept whole, got %q", res[1])
+	}
+}
+
+func TestPrint(t *testing.T) {
+	isolate(t)
+	Define("print-token", "super-secret", "test usage").Secret()
+	Define("print-timeout", 5*time.Minute, "test usage")
+
+	var buf bytes.Buffer
+	if err := Print(&buf); err != nil {
+		t.Fatalf("Print() returned error: %v", err)
+	}
+	out := buf.String()
+
+	if strings.Contains(out, "super-secret") {
+		t.Errorf("Expected secret to be redacted, got:\n%s", out)
+	}
+	for _, want := range []string{"print-token: <redacted>\n", "# from default\nprint-timeout: 5m0s\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
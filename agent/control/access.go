@@ -0,0 +1,170 @@
+package control
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"agent/access"
+)
+
+type accessResponse struct {
+	MaxDurationSeconds int64           `json:"max_duration_seconds"`
+	Pending            []accessRequest `json:"pending"`
+	Grant              *accessGrant    `json:"grant"`
+}
+
+type accessRequest struct {
+	ID              string    `json:"id"`
+	Requester       string    `json:"requester"`
+	Reason          string    `json:"reason"`
+	DurationSeconds int64     `json:"duration_seconds,omitempty"`
+	RequestedAt     time.Time `json:"requested_at"`
+	ExpiresAt       time.Time `json:"expires_at"`
+}
+
+type accessGrant struct {
+	Request    accessRequest `json:"request"`
+	ApprovedBy string        `json:"approved_by"`
+	ApprovedAt time.Time     `json:"approved_at"`
+	ExpiresAt  time.Time     `json:"expires_at"`
+}
+
+func newAccessRequest(r access.Request) accessRequest {
+	return accessRequest{
+		ID:              r.ID,
+		Requester:       r.Requester,
+		Reason:          r.Reason,
+		DurationSeconds: int64(r.Duration.Seconds()),
+		RequestedAt:     r.RequestedAt,
+		ExpiresAt:       r.ExpiresAt,
+	}
+}
+
+func newAccessGrant(g *access.Grant) *accessGrant {
+	if g == nil {
+		return nil
+	}
+	return &accessGrant{
+		Request:    newAccessRequest(g.Request),
+		ApprovedBy: g.ApprovedBy,
+		ApprovedAt: g.ApprovedAt,
+		ExpiresAt:  g.ExpiresAt,
+	}
+}
+
+var (
+	errAccessDisabled  = errors.New("SSH access is not enabled on this agent")
+	errInvalidDuration = errors.New("invalid duration")
+)
+
+func (s *Server) accessStatus(w http.ResponseWriter, r *http.Request) {
+	if s.Access == nil {
+		writeError(w, http.StatusNotFound, errAccessDisabled)
+		return
+	}
+
+	resp := accessResponse{
+		MaxDurationSeconds: int64(s.Access.MaxDuration().Seconds()),
+		Pending:            []accessRequest{},
+		Grant:              newAccessGrant(s.Access.Grant()),
+	}
+	for _, req := range s.Access.Pending() {
+		resp.Pending = append(resp.Pending, newAccessRequest(req))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// approveAccess grants a pending request. It takes the form or query parameter duration, eg: "1h",
+// which is bounded by the requested duration. The requested duration is granted if it is empty.
+func (s *Server) approveAccess(w http.ResponseWriter, r *http.Request) {
+	if s.Access == nil {
+		s.accessError(w, r, errAccessDisabled)
+		return
+	}
+
+	var d time.Duration
+	if param := r.FormValue("duration"); param != "" {
+		var err error
+		d, err = time.ParseDuration(param)
+		if err != nil || d <= 0 {
+			s.accessError(w, r, fmt.Errorf("%w %q", errInvalidDuration, param))
+			return
+		}
+	}
+
+	grant, err := s.Access.Approve(r.Context(), r.PathValue("id"), identity(r), d)
+	if err != nil {
+		s.accessError(w, r, err)
+		return
+	}
+
+	s.accessDone(w, r, newAccessGrant(&grant))
+}
+
+func (s *Server) denyAccess(w http.ResponseWriter, r *http.Request) {
+	if s.Access == nil {
+		s.accessError(w, r, errAccessDisabled)
+		return
+	}
+
+	if err := s.Access.Deny(r.PathValue("id"), identity(r)); err != nil {
+		s.accessError(w, r, err)
+		return
+	}
+
+	s.accessDone(w, r, nil)
+}
+
+func (s *Server) revokeAccess(w http.ResponseWriter, r *http.Request) {
+	if s.Access == nil {
+		s.accessError(w, r, errAccessDisabled)
+		return
+	}
+
+	if err := s.Access.Revoke(identity(r)); err != nil {
+		s.accessError(w, r, err)
+		return
+	}
+
+	s.accessDone(w, r, nil)
+}
+
+// accessDone responds to a decision with the grant, if any, or sends the page's form back home.
+func (s *Server) accessDone(w http.ResponseWriter, r *http.Request, grant *accessGrant) {
+	if !isAPI(r) {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	if grant != nil {
+		writeJSON(w, http.StatusOK, grant)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) accessError(w http.ResponseWriter, r *http.Request, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errAccessDisabled), errors.Is(err, access.ErrNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, access.ErrGrantActive), errors.Is(err, access.ErrNoGrant), errors.Is(err, access.ErrApproving):
+		code = http.StatusConflict
+	case errors.Is(err, errInvalidDuration):
+		code = http.StatusBadRequest
+	}
+
+	if isAPI(r) {
+		writeError(w, code, err)
+	} else {
+		http.Error(w, err.Error(), code)
+	}
+
+	if code == http.StatusInternalServerError {
+		log.Printf("Access error: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"agent/access"
+)
+
+type fakeShell struct {
+	running bool
+}
+
+func (s *fakeShell) Start(ctx context.Context) error {
+	s.running = true
+	return nil
+}
+
+func (s *fakeShell) Close() error {
+	s.running = false
+	return nil
+}
+
+func TestAccess(t *testing.T) {
+	shell := &fakeShell{}
+	var decisions []access.Decision
+	manager := access.New(access.Config{
+		Shell:       shell,
+		MaxDuration: 4 * time.Hour,
+		Decided:     func(d access.Decision) { decisions = append(decisions, d) },
+	})
+	manager.Request(access.Request{ID: "a1", Requester: "vendor@example.com", Reason: "debug", Duration: 2 * time.Hour})
+	manager.Request(access.Request{ID: "a2", Requester: "vendor@example.com"})
+
+	s := newServer(nil)
+	s.Access = manager
+	srv := serve(t, s)
+
+	resp := request(t, http.MethodGet, srv.URL+"/api/access", "secret")
+	var status accessResponse
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode access: %v", err)
+	}
+	if len(status.Pending) != 2 || status.Pending[0].DurationSeconds != 7200 || status.Grant != nil || status.MaxDurationSeconds != 14400 {
+		t.Errorf("Unexpected access %+v", status)
+	}
+
+	resp = request(t, http.MethodGet, srv.URL+"/", "secret")
+	page, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{`action="/access/requests/a1/approve"`, `<option value="2h0m0s" selected>For 2h</option>`, `<option value="4h0m0s" selected>For 4h</option>`} {
+		if !strings.Contains(string(page), want) {
+			t.Errorf("Expected the page to contain %s", want)
+		}
+	}
+
+	if resp := request(t, http.MethodPost, srv.URL+"/api/access/requests/a1/approve?duration=soon", "secret"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected an invalid duration to be rejected, got %d", resp.StatusCode)
+	}
+	if resp := request(t, http.MethodPost, srv.URL+"/api/access/requests/unknown/approve", "secret"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected an unknown request to be rejected, got %d", resp.StatusCode)
+	}
+
+	resp = request(t, http.MethodPost, srv.URL+"/api/access/requests/a1/approve?duration=1h", "secret")
+	var grant accessGrant
+	if err := json.NewDecoder(resp.Body).Decode(&grant); err != nil {
+		t.Fatalf("Failed to decode grant: %v", err)
+	}
+	if grant.ApprovedBy != tokenIdentity || grant.ExpiresAt.Sub(grant.ApprovedAt) != time.Hour || !shell.running {
+		t.Errorf("Unexpected grant %+v", grant)
+	}
+
+	if resp := request(t, http.MethodPost, srv.URL+"/api/access/requests/a2/approve", "secret"); resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected approving while access is granted to conflict, got %d", resp.StatusCode)
+	}
+
+	// The page's forms are redirected back to the page.
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	for _, path := range []string{"/access/revoke", "/access/requests/a2/deny"} {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+path, strings.NewReader(url.Values{}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth("", "secret")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusSeeOther {
+			t.Errorf("Expected %s to redirect, got %d", path, resp.StatusCode)
+		}
+	}
+
+	if shell.running || manager.Grant() != nil || len(manager.Pending()) != 0 {
+		t.Error("Expected access to be revoked and the request denied")
+	}
+	if len(decisions) != 2 || !decisions[0].Approved || decisions[1].Approved {
+		t.Errorf("Unexpected decisions %+v", decisions)
+	}
+}
+
+func TestAccessDisabled(t *testing.T) {
+	srv := newTestServer(t, nil)
+
+	if resp := request(t, http.MethodGet, srv.URL+"/api/access", "secret"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected access to be unavailable, got %d", resp.StatusCode)
+	}
+
+	resp := request(t, http.MethodGet, srv.URL+"/", "secret")
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the page to render without access, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,280 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"agent/circular"
+	"agent/process"
+)
+
+// defaultLogTail is how many lines /api/logs returns unless asked for a different tail.
+const defaultLogTail = 100
+
+type statusResponse struct {
+	Agent          agentInfo      `json:"agent"`
+	LastHeartbeat  *delivery      `json:"last_heartbeat"`
+	LastAction     *actionStatus  `json:"last_action"`
+	QueuedRequests int            `json:"queued_requests"`
+	Streaming      bool           `json:"streaming"`
+	Process        *processStatus `json:"process"`
+	SSH            sshStatus      `json:"ssh"`
+}
+
+type agentInfo struct {
+	Name        string `json:"name"`
+	LifecycleID string `json:"lifecycle_id"`
+	SessionID   string `json:"session_id"`
+	Version     string `json:"version"`
+	Commit      string `json:"commit"`
+}
+
+type delivery struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error,omitempty"`
+}
+
+type actionStatus struct {
+	ID    string    `json:"id"`
+	State string    `json:"state"`
+	Time  time.Time `json:"time"`
+	Error string    `json:"error,omitempty"`
+}
+
+type processStatus struct {
+	Command      []string      `json:"command"`
+	State        process.State `json:"state"`
+	PID          int           `json:"pid,omitempty"`
+	StartedAt    *time.Time    `json:"started_at,omitempty"`
+	Restarts     int           `json:"restarts"`
+	CrashLooping bool          `json:"crash_looping"`
+	NextStart    *time.Time    `json:"next_start,omitempty"`
+	Exits        []processExit `json:"exits"`
+}
+
+type processExit struct {
+	StartedAt time.Time `json:"started_at"`
+	ExitedAt  time.Time `json:"exited_at"`
+	ExitCode  int       `json:"exit_code"`
+	Signal    string    `json:"signal,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type sshStatus struct {
+	Running bool `json:"running"`
+}
+
+type logLine struct {
+	Time   time.Time       `json:"time"`
+	Stream circular.Stream `json:"stream"`
+	Text   string          `json:"text"`
+}
+
+func newLogLine(l circular.Line) logLine {
+	return logLine{Time: l.Time, Stream: l.Stream, Text: l.Text}
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	resp := statusResponse{
+		Process: s.processStatus(),
+		SSH:     sshStatus{Running: s.SshSrv != nil && s.SshSrv.Running()},
+	}
+
+	if s.Agent != nil {
+		status := s.Agent.Status()
+		resp.Agent = agentInfo{
+			Name:        status.Name,
+			LifecycleID: status.LifecycleID,
+			SessionID:   status.SessionID,
+			Version:     status.AgentVersion,
+			Commit:      status.AgentCommit,
+		}
+		if !status.LastHeartbeat.Time.IsZero() {
+			resp.LastHeartbeat = &delivery{Time: status.LastHeartbeat.Time, Error: status.LastHeartbeat.Error}
+		}
+		if a := status.LastAction; a != nil {
+			resp.LastAction = &actionStatus{ID: a.ID, State: a.State, Time: a.Time, Error: a.Error}
+		}
+		resp.QueuedRequests = status.QueuedRequests
+		resp.Streaming = status.Streaming
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) processStatus() *processStatus {
+	if s.Supervisor == nil {
+		return nil
+	}
+
+	status := s.Supervisor.Status()
+	ps := &processStatus{
+		Command:      s.Supervisor.Args(),
+		State:        status.State,
+		PID:          status.PID,
+		Restarts:     status.Restarts,
+		CrashLooping: status.CrashLooping,
+		Exits:        []processExit{},
+	}
+	if status.State == process.StateRunning {
+		ps.StartedAt = &status.StartedAt
+	}
+	if status.State == process.StateBackoff {
+		ps.NextStart = &status.NextStart
+	}
+	for _, e := range status.Exits {
+		ps.Exits = append(ps.Exits, processExit{
+			StartedAt: e.StartedAt,
+			ExitedAt:  e.ExitedAt,
+			ExitCode:  e.ExitCode,
+			Signal:    e.Signal,
+			Error:     e.Error,
+		})
+	}
+
+	return ps
+}
+
+// logs returns the process's recent output. It takes the query parameters:
+//
+//   - tail: how many of the most recent matching lines to return, 100 by default or all if 0.
+//   - since: an RFC 3339 time, or a duration such as "5m", excluding older lines.
+//   - stream: "stdout" or "stderr".
+//   - contains: a substring lines must contain.
+//   - match: a regular expression lines must match.
+//   - follow: if "true", newline-delimited JSON lines are streamed as they are written, until the
+//     client disconnects.
+func (s *Server) logs(w http.ResponseWriter, r *http.Request) {
+	if s.Supervisor == nil {
+		writeError(w, http.StatusNotFound, errNoProcess)
+		return
+	}
+
+	q, follow, err := logQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if !follow {
+		lines := []logLine{}
+		for _, l := range s.Supervisor.Logs().Query(q) {
+			lines = append(lines, newLogLine(l))
+		}
+		writeJSON(w, http.StatusOK, lines)
+		return
+	}
+
+	backlog, live := s.Supervisor.Logs().Subscribe(r.Context(), q)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	for _, l := range backlog {
+		if err := enc.Encode(newLogLine(l)); err != nil {
+			return
+		}
+	}
+	for {
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		l, ok := <-live
+		if !ok {
+			return
+		}
+		if err := enc.Encode(newLogLine(l)); err != nil {
+			return
+		}
+	}
+}
+
+func logQuery(r *http.Request) (circular.Query, bool, error) {
+	params := r.URL.Query()
+	q := circular.Query{
+		Limit:    defaultLogTail,
+		Stream:   circular.Stream(params.Get("stream")),
+		Contains: params.Get("contains"),
+	}
+
+	if tail := params.Get("tail"); tail != "" {
+		n, err := strconv.Atoi(tail)
+		if err != nil || n < 0 {
+			return q, false, fmt.Errorf("invalid tail %q", tail)
+		}
+		q.Limit = n
+	}
+
+	if since := params.Get("since"); since != "" {
+		if t, err := time.Parse(time.RFC3339, since); err == nil {
+			q.Since = t
+		} else if d, err := time.ParseDuration(since); err == nil {
+			q.Since = time.Now().Add(-d)
+		} else {
+			return q, false, fmt.Errorf("invalid since %q, expected an RFC 3339 time or a duration", since)
+		}
+	}
+
+	switch q.Stream {
+	case "", circular.Stdout, circular.Stderr:
+	default:
+		return q, false, fmt.Errorf("invalid stream %q, expected stdout or stderr", q.Stream)
+	}
+
+	if match := params.Get("match"); match != "" {
+		re, err := regexp.Compile(match)
+		if err != nil {
+			return q, false, fmt.Errorf("invalid match: %w", err)
+		}
+		q.Match = re
+	}
+
+	follow, err := strconv.ParseBool(params.Get("follow"))
+	if err != nil && params.Get("follow") != "" {
+		return q, false, fmt.Errorf("invalid follow %q", params.Get("follow"))
+	}
+
+	return q, follow, nil
+}
+
+func (s *Server) restartProcess(w http.ResponseWriter, r *http.Request) {
+	if s.Supervisor == nil {
+		writeError(w, http.StatusNotFound, errNoProcess)
+		return
+	}
+
+	if err := s.Supervisor.Restart(); err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+
+	log.Printf("Restarting the process, requested through the control server")
+	writeJSON(w, http.StatusAccepted, s.processStatus())
+}
+
+var errNoProcess = errors.New("the agent is not supervising a process")
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,177 @@
+package control
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var errUnauthenticated = errors.New("unauthenticated")
+
+// Authenticator checks the bearer token of a request to the control server, returning who the
+// caller is. The identity is logged with what the caller does, eg: approving access.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (string, error)
+}
+
+// tokenIdentity is the identity of callers holding the shared token, who can't be told apart.
+const tokenIdentity = "control token holder"
+
+// TokenAuthenticator accepts a shared token, eg: from a Kubernetes Secret. If File is set the token
+// is read from it, and read again when it changes, so that the Secret can be rotated.
+type TokenAuthenticator struct {
+	Token string
+	File  string
+
+	mu      sync.Mutex
+	modTime time.Time
+}
+
+func (a *TokenAuthenticator) Authenticate(ctx context.Context, token string) (string, error) {
+	expected, err := a.token()
+	if err != nil {
+		return "", err
+	}
+	if expected == "" || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+		return "", errUnauthenticated
+	}
+	return tokenIdentity, nil
+}
+
+func (a *TokenAuthenticator) token() (string, error) {
+	if a.File == "" {
+		return a.Token, nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	info, err := os.Stat(a.File)
+	if err != nil {
+		return "", fmt.Errorf("failed to read control token: %w", err)
+	}
+	if info.ModTime().Equal(a.modTime) {
+		return a.Token, nil
+	}
+
+	data, err := os.ReadFile(a.File)
+	if err != nil {
+		return "", fmt.Errorf("failed to read control token: %w", err)
+	}
+	a.Token, a.modTime = strings.TrimSpace(string(data)), info.ModTime()
+
+	return a.Token, nil
+}
+
+// tokenReviewCacheTTL is how long an accepted token is accepted again without a TokenReview. Rejected
+// tokens are reviewed every time, so that callers can't fill the cache with them.
+const tokenReviewCacheTTL = time.Minute
+
+// TokenReviewAuthenticator accepts the service account tokens of callers, checked with a Kubernetes
+// TokenReview. Callers are identified by their service account's username.
+type TokenReviewAuthenticator struct {
+	client    kubernetes.Interface
+	allowed   []string
+	audiences []string
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]tokenReview
+}
+
+type tokenReview struct {
+	username string
+	expires  time.Time
+}
+
+// NewTokenReviewAuthenticator accepts the tokens of the allowed service accounts, given as
+// "namespace:name". Tokens must be valid for one of audiences, or the API server's if it is empty.
+func NewTokenReviewAuthenticator(client kubernetes.Interface, allowed, audiences []string) *TokenReviewAuthenticator {
+	usernames := make([]string, 0, len(allowed))
+	for _, sa := range allowed {
+		usernames = append(usernames, "system:serviceaccount:"+sa)
+	}
+
+	return &TokenReviewAuthenticator{
+		client:    client,
+		allowed:   usernames,
+		audiences: audiences,
+		cache:     map[[sha256.Size]byte]tokenReview{},
+	}
+}
+
+func (a *TokenReviewAuthenticator) Authenticate(ctx context.Context, token string) (string, error) {
+	if token == "" {
+		return "", errUnauthenticated
+	}
+
+	key := sha256.Sum256([]byte(token))
+	now := time.Now()
+
+	a.mu.Lock()
+	cached, ok := a.cache[key]
+	a.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.username, nil
+	}
+
+	username, err := a.review(ctx, token)
+	if err != nil {
+		return "", err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for k, r := range a.cache {
+		if now.After(r.expires) {
+			delete(a.cache, k)
+		}
+	}
+	a.cache[key] = tokenReview{username: username, expires: now.Add(tokenReviewCacheTTL)}
+
+	return username, nil
+}
+
+func (a *TokenReviewAuthenticator) review(ctx context.Context, token string) (string, error) {
+	review, err := a.client.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token, Audiences: a.audiences},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to review token: %w", err)
+	}
+
+	if !review.Status.Authenticated || !slices.Contains(a.allowed, review.Status.User.Username) {
+		return "", errUnauthenticated
+	}
+	// The API server may authenticate a token for other audiences than those asked for, which it
+	// reports in the status.
+	if len(a.audiences) > 0 && !slices.ContainsFunc(review.Status.Audiences, func(audience string) bool {
+		return slices.Contains(a.audiences, audience)
+	}) {
+		return "", errUnauthenticated
+	}
+	return review.Status.User.Username, nil
+}
+
+// bearerToken returns the token from the Authorization header, either as a bearer token or, so that
+// the page can be opened in a browser, as the password of basic auth.
+func bearerToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	return ""
+}
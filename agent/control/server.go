@@ -2,24 +2,74 @@ package control
 
 import (
 	"context"
+	"errors"
+	"log"
 	"net/http"
-	"sync"
+	"net/url"
+	"strings"
+	"time"
 
+	"agent/access"
+	"agent/agent"
 	"agent/control/components/home"
 	"agent/process"
 	"agent/ssh"
 
 	"github.com/a-h/templ"
-	"github.com/google/uuid"
 )
 
+// Agent reports what the agent is doing, see agent.Agent.
+type Agent interface {
+	Status() agent.Status
+}
+
+type Config struct {
+	// Addr is the address the server listens on, eg: ":8080".
+	Addr string
+
+	// Auth checks every request. It is required.
+	Auth Authenticator
+
+	// SSH is the break-glass SSH server, whose state is reported.
+	SSH *ssh.Server
+
+	// Access, if set, lets operators approve, deny and revoke shell access.
+	Access *access.Manager
+
+	Agent      Agent
+	Supervisor *process.Supervisor
+}
+
 type Server struct {
-	sshMu   sync.RWMutex
-	SshSrv  *ssh.Server
-	Process *process.Process
+	addr string
+	auth Authenticator
+
+	SshSrv     *ssh.Server
+	Access     *access.Manager
+	Agent      Agent
+	Supervisor *process.Supervisor
 }
 
 func (s *Server) Start(ctx context.Context) error {
+	httpSrv := &http.Server{
+		Addr:              s.addr,
+		Handler:           s.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		httpSrv.Close()
+	}()
+
+	log.Printf("Control server listening on %s", s.addr)
+	if err := httpSrv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) handler() http.Handler {
 	srv := http.NewServeMux()
 
 	srv.HandleFunc("GET /static/", func(w http.ResponseWriter, r *http.Request) {
@@ -27,43 +77,94 @@ func (s *Server) Start(ctx context.Context) error {
 		http.FileServer(http.Dir("./build")).ServeHTTP(w, r)
 	})
 
-	srv.HandleFunc("PATCH /ssh", s.toggleSsh)
 	srv.HandleFunc("GET /", s.index)
 
-	return http.ListenAndServe(":8080", srv)
+	// The page's forms post to /access, and API clients to /api/access.
+	for _, prefix := range []string{"", "/api"} {
+		srv.HandleFunc("POST "+prefix+"/access/requests/{id}/approve", s.approveAccess)
+		srv.HandleFunc("POST "+prefix+"/access/requests/{id}/deny", s.denyAccess)
+		srv.HandleFunc("POST "+prefix+"/access/revoke", s.revokeAccess)
+	}
+
+	srv.HandleFunc("GET /api/status", s.status)
+	srv.HandleFunc("GET /api/logs", s.logs)
+	srv.HandleFunc("GET /api/access", s.accessStatus)
+	srv.HandleFunc("POST /api/process/restart", s.restartProcess)
+
+	return s.authenticate(sameOrigin(srv))
 }
 
-func (s *Server) Close() error {
-	return s.SshSrv.Close()
+type identityKey struct{}
+
+// identity returns who made an authenticated request.
+func identity(r *http.Request) string {
+	id, _ := r.Context().Value(identityKey{}).(string)
+	return id
 }
 
-func (s *Server) index(w http.ResponseWriter, r *http.Request) {
-	renderComponent(home.Index(home.IndexProps{
-		SSHRunning: s.SshSrv.Running(),
-		Process:    s.Process,
-	}))(w, r)
+// authenticate rejects requests without a valid token. Browsers are asked for the token as the
+// password of basic auth.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := s.auth.Authenticate(r.Context(), bearerToken(r))
+		if err == nil {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, id)))
+			return
+		}
+
+		code := http.StatusUnauthorized
+		if !errors.Is(err, errUnauthenticated) {
+			log.Printf("Control server authentication error: %v", err)
+			code = http.StatusServiceUnavailable
+		} else if isAPI(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="shepherd agent"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", `Basic realm="shepherd agent"`)
+		}
+
+		if isAPI(r) {
+			writeError(w, code, err)
+		} else {
+			http.Error(w, err.Error(), code)
+		}
+	})
 }
 
-func (s *Server) toggleSsh(w http.ResponseWriter, r *http.Request) {
-	s.sshMu.Lock()
-	defer s.sshMu.Unlock()
+// sameOrigin rejects cross-site requests that change state, which a browser holding the basic auth
+// credentials would otherwise send on another site's behalf.
+func sameOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
 
-	if s.SshSrv == nil {
-		http.Error(w, "SSH server not initialized", http.StatusInternalServerError)
-		return
-	}
+		crossSite := false
+		if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+			crossSite = site != "same-origin" && site != "none"
+		} else if origin := r.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			crossSite = err != nil || u.Host != r.Host
+		}
 
-	if s.SshSrv.Running() {
-		if err := s.SshSrv.Close(); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if crossSite {
+			http.Error(w, "cross-origin request rejected", http.StatusForbidden)
 			return
 		}
-	}
+		next.ServeHTTP(w, r)
+	})
+}
 
-	if err := s.SshSrv.Start(r.Context()); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+func isAPI(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/")
+}
+
+func (s *Server) index(w http.ResponseWriter, r *http.Request) {
+	renderComponent(home.Index(home.IndexProps{
+		SSHRunning: s.SshSrv != nil && s.SshSrv.Running(),
+		Access:     s.Access,
+		Supervisor: s.Supervisor,
+	}))(w, r)
 }
 
 func renderComponent(component templ.Component) func(w http.ResponseWriter, r *http.Request) {
@@ -73,14 +174,19 @@ func renderComponent(component templ.Component) func(w http.ResponseWriter, r *h
 	}
 }
 
-func New(authKey string, p *process.Process) (*Server, error) {
-	id, err := uuid.NewV7()
-	if err != nil {
-		return nil, err
+var errNoAuth = errors.New("the control server requires an authenticator")
+
+func New(cfg Config) (*Server, error) {
+	if cfg.Auth == nil {
+		return nil, errNoAuth
 	}
 
 	return &Server{
-		SshSrv:  ssh.NewServer(authKey, id.String()),
-		Process: p,
+		addr:       cfg.Addr,
+		auth:       cfg.Auth,
+		SshSrv:     cfg.SSH,
+		Access:     cfg.Access,
+		Agent:      cfg.Agent,
+		Supervisor: cfg.Supervisor,
 	}, nil
 }
@@ -0,0 +1,271 @@
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"agent/agent"
+	"agent/process"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+type fakeAgent struct {
+	status agent.Status
+}
+
+func (a fakeAgent) Status() agent.Status {
+	return a.status
+}
+
+func newTestServer(t *testing.T, supervisor *process.Supervisor) *httptest.Server {
+	t.Helper()
+
+	return serve(t, newServer(supervisor))
+}
+
+func newServer(supervisor *process.Supervisor) *Server {
+	return &Server{
+		auth: &TokenAuthenticator{Token: "secret"},
+		Agent: fakeAgent{agent.Status{
+			Name:          "test-agent",
+			LastHeartbeat: agent.Delivery{Time: time.Now(), Error: "unavailable"},
+			LastAction:    &agent.ActionStatus{ID: "action-1", State: "succeeded"},
+		}},
+		Supervisor: supervisor,
+	}
+}
+
+func serve(t *testing.T, s *Server) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(s.handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func request(t *testing.T, method, url, token string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestAuthentication(t *testing.T) {
+	srv := newTestServer(t, nil)
+
+	tests := []struct {
+		name  string
+		path  string
+		token string
+		code  int
+	}{
+		{"no token", "/api/status", "", http.StatusUnauthorized},
+		{"wrong token", "/api/status", "wrong", http.StatusUnauthorized},
+		{"token", "/api/status", "secret", http.StatusOK},
+		{"page without token", "/", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resp := request(t, http.MethodGet, srv.URL+tt.path, tt.token); resp.StatusCode != tt.code {
+				t.Errorf("Expected status %d, got %d", tt.code, resp.StatusCode)
+			}
+		})
+	}
+
+	// Browsers can send the token as the password of basic auth.
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/status", nil)
+	req.SetBasicAuth("", "secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected basic auth to be accepted, got %d", resp.StatusCode)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	srv := newTestServer(t, nil)
+
+	resp := request(t, http.MethodGet, srv.URL+"/api/status", "secret")
+
+	var status statusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode status: %v", err)
+	}
+	if status.Agent.Name != "test-agent" || status.LastHeartbeat.Error != "unavailable" || status.LastAction.ID != "action-1" {
+		t.Errorf("Unexpected status %+v", status)
+	}
+	if status.Process != nil {
+		t.Errorf("Expected no process, got %+v", status.Process)
+	}
+}
+
+func TestLogsAndRestart(t *testing.T) {
+	supervisor := process.NewSupervisor(process.SupervisorConfig{
+		Command:       "sh",
+		Args:          []string{"-c", `echo started; echo oops >&2; while true; do sleep 0.01; done`},
+		RestartPolicy: process.RestartNever,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- supervisor.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	srv := newTestServer(t, supervisor)
+
+	// Follow the logs: the backlog and the output of the restarted process arrive as they are written.
+	followCtx, stopFollowing := context.WithCancel(context.Background())
+	defer stopFollowing()
+	req, _ := http.NewRequestWithContext(followCtx, http.MethodGet, srv.URL+"/api/logs?follow=true&stream=stdout", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp := request(t, http.MethodPost, srv.URL+"/api/process/restart", "secret"); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected restart to be accepted, got %d", resp.StatusCode)
+	}
+
+	lines := make(chan logLine)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			var l logLine
+			if err := json.Unmarshal(scanner.Bytes(), &l); err == nil {
+				lines <- l
+			}
+		}
+		close(lines)
+	}()
+
+	started := 0
+	for started < 2 {
+		select {
+		case l := <-lines:
+			if l.Stream != "stdout" || l.Text != "started" {
+				t.Errorf("Expected only stdout lines, got %+v", l)
+			}
+			started++
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected the output of both runs, got %d lines", started)
+		}
+	}
+
+	resp = request(t, http.MethodGet, srv.URL+"/api/logs?stream=stderr&tail=1", "secret")
+	var tail []logLine
+	if err := json.NewDecoder(resp.Body).Decode(&tail); err != nil {
+		t.Fatalf("Failed to decode logs: %v", err)
+	}
+	if len(tail) != 1 || tail[0].Text != "oops" {
+		t.Errorf("Expected the last stderr line, got %+v", tail)
+	}
+
+	if resp := request(t, http.MethodGet, srv.URL+"/api/logs?match=(", "secret"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected an invalid pattern to be rejected, got %d", resp.StatusCode)
+	}
+}
+
+func TestCrossOriginRejected(t *testing.T) {
+	srv := newTestServer(t, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/process/restart", strings.NewReader(""))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Origin", "https://evil.example")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected cross-origin request to be rejected, got %d", resp.StatusCode)
+	}
+}
+
+func TestTokenReviewAuthenticator(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	reviews := 0
+	client.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		reviews++
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		switch review.Spec.Token {
+		case "operator-token":
+			review.Status = authenticationv1.TokenReviewStatus{Authenticated: true, User: authenticationv1.UserInfo{Username: "system:serviceaccount:ops:operator"}}
+		case "other-token":
+			review.Status = authenticationv1.TokenReviewStatus{Authenticated: true, User: authenticationv1.UserInfo{Username: "system:serviceaccount:default:other"}}
+		case "other-audience-token":
+			review.Status = authenticationv1.TokenReviewStatus{Authenticated: true, User: authenticationv1.UserInfo{Username: "system:serviceaccount:ops:operator"}, Audiences: []string{"other"}}
+		}
+		if review.Status.Authenticated && review.Status.Audiences == nil {
+			review.Status.Audiences = review.Spec.Audiences
+		}
+		return true, review, nil
+	})
+
+	a := NewTokenReviewAuthenticator(client, []string{"ops:operator"}, nil)
+	ctx := context.Background()
+
+	if username, err := a.Authenticate(ctx, "operator-token"); err != nil || username != "system:serviceaccount:ops:operator" {
+		t.Errorf("Expected the allowed service account to be accepted, got %q and %v", username, err)
+	}
+	if _, err := a.Authenticate(ctx, "other-token"); err == nil {
+		t.Error("Expected a service account that isn't allowed to be rejected")
+	}
+	if _, err := a.Authenticate(ctx, "invalid-token"); err == nil {
+		t.Error("Expected an invalid token to be rejected")
+	}
+
+	// Accepted tokens are cached, rejected ones are reviewed again.
+	if username, _ := a.Authenticate(ctx, "operator-token"); username != "system:serviceaccount:ops:operator" {
+		t.Errorf("Expected the cached review to identify the service account, got %q", username)
+	}
+	if _, err := a.Authenticate(ctx, "invalid-token"); err == nil {
+		t.Error("Expected an invalid token to be rejected again")
+	}
+	if reviews != 4 {
+		t.Errorf("Expected 4 reviews, got %d", reviews)
+	}
+	if len(a.cache) != 1 {
+		t.Errorf("Expected only the accepted token to be cached, got %d", len(a.cache))
+	}
+
+	// Tokens authenticated for other audiences than those asked for are rejected.
+	a = NewTokenReviewAuthenticator(client, []string{"ops:operator"}, []string{"shepherd"})
+	if username, err := a.Authenticate(ctx, "operator-token"); err != nil || username != "system:serviceaccount:ops:operator" {
+		t.Errorf("Expected a token for the audience to be accepted, got %q and %v", username, err)
+	}
+	if _, err := a.Authenticate(ctx, "other-audience-token"); err == nil {
+		t.Error("Expected a token for another audience to be rejected")
+	}
+}
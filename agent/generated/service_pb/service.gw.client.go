@@ -12,6 +12,17 @@ import (
 type OnPremGatewayClient interface {
 	Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error)
 	Apply(context.Context, *ApplyRequest) (*ApplyResponse, error)
+	ReportActionResult(context.Context, *ReportActionResultRequest) (*ReportActionResultResponse, error)
+	// Trades the bootstrap token the agent was installed with, sent as its bearer token, for a
+	// short-lived access token used for every other call.
+	ExchangeToken(context.Context, *ExchangeTokenRequest) (*ExchangeTokenResponse, error)
+	// Uploads the output of the process the agent supervises, in batches.
+	UploadLogs(context.Context, *UploadLogsRequest) (*UploadLogsResponse, error)
+	// Uploads the recording of an SSH session once it has ended.
+	UploadSessionRecording(context.Context, *UploadSessionRecordingRequest) (*UploadSessionRecordingResponse, error)
+	// Delivers actions to the agent as soon as they are available, as an alternative to polling
+	// Apply. Over HTTP the stream is served as server-sent events.
+	WatchActions(context.Context, *WatchActionsRequest) (<-chan *WatchActionsResponse, <-chan error, error)
 }
 
 func NewOnPremGatewayClient(c gateway.Client) OnPremGatewayClient {
@@ -35,3 +46,33 @@ func (c *onPremGatewayClient) Apply(ctx context.Context, req *ApplyRequest) (*Ap
 	gwReq.SetBody(req)
 	return gateway.DoRequest[ApplyResponse](ctx, gwReq)
 }
+
+func (c *onPremGatewayClient) ReportActionResult(ctx context.Context, req *ReportActionResultRequest) (*ReportActionResultResponse, error) {
+	gwReq := c.gwc.NewRequest("POST", "/action_result")
+	gwReq.SetBody(req)
+	return gateway.DoRequest[ReportActionResultResponse](ctx, gwReq)
+}
+
+func (c *onPremGatewayClient) ExchangeToken(ctx context.Context, req *ExchangeTokenRequest) (*ExchangeTokenResponse, error) {
+	gwReq := c.gwc.NewRequest("POST", "/exchange_token")
+	gwReq.SetBody(req)
+	return gateway.DoRequest[ExchangeTokenResponse](ctx, gwReq)
+}
+
+func (c *onPremGatewayClient) UploadLogs(ctx context.Context, req *UploadLogsRequest) (*UploadLogsResponse, error) {
+	gwReq := c.gwc.NewRequest("POST", "/logs")
+	gwReq.SetBody(req)
+	return gateway.DoRequest[UploadLogsResponse](ctx, gwReq)
+}
+
+func (c *onPremGatewayClient) UploadSessionRecording(ctx context.Context, req *UploadSessionRecordingRequest) (*UploadSessionRecordingResponse, error) {
+	gwReq := c.gwc.NewRequest("POST", "/ssh_sessions")
+	gwReq.SetBody(req)
+	return gateway.DoRequest[UploadSessionRecordingResponse](ctx, gwReq)
+}
+
+func (c *onPremGatewayClient) WatchActions(ctx context.Context, req *WatchActionsRequest) (<-chan *WatchActionsResponse, <-chan error, error) {
+	gwReq := c.gwc.NewRequest("POST", "/watch_actions")
+	gwReq.SetBody(req)
+	return gateway.DoStreamingRequest[WatchActionsResponse](ctx, c.gwc, gwReq)
+}
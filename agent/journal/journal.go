@@ -0,0 +1,208 @@
+// Package journal records the actions the agent receives and what became of them in an
+// append-only file, so that an agent restarted mid-action knows what was in flight.
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	directoryPermissions = 0755
+	filePermissions      = 0644
+
+	// maxActions bounds how many actions are kept when the journal is compacted on open.
+	maxActions = 1000
+)
+
+type State string
+
+const (
+	StateReceived  State = "received"
+	StateStarted   State = "started"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+)
+
+// Done reports whether the action reached an outcome.
+func (s State) Done() bool {
+	return s == StateSucceeded || s == StateFailed
+}
+
+// Entry is a state transition of an action.
+type Entry struct {
+	ActionID string    `json:"actionId"`
+	State    State     `json:"state"`
+	Time     time.Time `json:"time"`
+
+	// Error and ReleaseRevision are the outcome of a finished action.
+	Error           string `json:"error,omitempty"`
+	ReleaseRevision int    `json:"releaseRevision,omitempty"`
+
+	// Action is the serialized action, recorded when it is received so that an action still waiting
+	// to be applied, eg: held by policy, can be resumed after a restart. Later entries drop it.
+	Action []byte `json:"action,omitempty"`
+}
+
+// Journal is an append-only log of action state transitions. It is safe for concurrent use.
+type Journal struct {
+	mu      sync.Mutex
+	file    *os.File
+	actions map[string]Entry // latest entry for each action
+}
+
+// Open reads the journal at path, creating it if it doesn't exist, and compacts it to the latest
+// entry of the most recent actions. A partially written last line, left by a crash, is dropped.
+func Open(path string) (*Journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), directoryPermissions); err != nil {
+		return nil, fmt.Errorf("failed to create journal directory: %w", err)
+	}
+
+	actions, err := read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := compact(path, actions); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, filePermissions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+
+	return &Journal{file: file, actions: actions}, nil
+}
+
+func read(path string) (map[string]Entry, error) {
+	actions := map[string]Entry{}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return actions, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			log.Printf("Skipping unreadable journal entry on line %d: %v", line, err)
+			continue
+		}
+		actions[e.ActionID] = e
+	}
+
+	return actions, scanner.Err()
+}
+
+// compact rewrites the journal with the latest entry of each action, keeping the most recent
+// maxActions. actions is trimmed to match.
+func compact(path string, actions map[string]Entry) error {
+	entries := make([]Entry, 0, len(actions))
+	for _, e := range actions {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+
+	if len(entries) > maxActions {
+		for _, e := range entries[:len(entries)-maxActions] {
+			delete(actions, e.ActionID)
+		}
+		entries = entries[len(entries)-maxActions:]
+	}
+
+	var buf bytes.Buffer
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(line, '\n'))
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), filePermissions); err != nil {
+		return fmt.Errorf("failed to compact journal: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to compact journal: %w", err)
+	}
+
+	return nil
+}
+
+// Record appends the entry and syncs it to disk before returning.
+func (j *Journal) Record(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal entry: %w", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync journal: %w", err)
+	}
+
+	j.actions[e.ActionID] = e
+
+	return nil
+}
+
+// Get returns the latest entry for the action.
+func (j *Journal) Get(actionID string) (Entry, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	e, ok := j.actions[actionID]
+	return e, ok
+}
+
+// Interrupted returns the actions that were started but never finished, oldest first.
+func (j *Journal) Interrupted() []Entry {
+	return j.inState(StateStarted)
+}
+
+// Pending returns the actions that were received but never started, oldest first.
+func (j *Journal) Pending() []Entry {
+	return j.inState(StateReceived)
+}
+
+func (j *Journal) inState(state State) []Entry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var entries []Entry
+	for _, e := range j.actions {
+		if e.State == state {
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+
+	return entries
+}
+
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
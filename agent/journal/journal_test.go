@@ -0,0 +1,95 @@
+package journal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "action_journal")
+
+	j, err := Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, e := range []Entry{
+		{ActionID: "a", State: StateReceived},
+		{ActionID: "a", State: StateStarted},
+		{ActionID: "a", State: StateSucceeded, ReleaseRevision: 4},
+		{ActionID: "b", State: StateReceived},
+		{ActionID: "b", State: StateStarted},
+		{ActionID: "c", State: StateReceived, Action: []byte("payload")},
+	} {
+		if err := j.Record(e); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	j.Close()
+
+	// Simulate a crash part way through writing an entry.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	f.WriteString(`{"actionId":"b","sta`)
+	f.Close()
+
+	j, err = Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer j.Close()
+
+	a, ok := j.Get("a")
+	if !ok || a.State != StateSucceeded || a.ReleaseRevision != 4 {
+		t.Errorf("Expected a to have succeeded at revision 4, got %+v", a)
+	}
+
+	interrupted := j.Interrupted()
+	if len(interrupted) != 1 || interrupted[0].ActionID != "b" {
+		t.Errorf("Expected b to be interrupted, got %+v", interrupted)
+	}
+
+	pending := j.Pending()
+	if len(pending) != 1 || pending[0].ActionID != "c" || string(pending[0].Action) != "payload" {
+		t.Errorf("Expected c to be pending with its payload, got %+v", pending)
+	}
+
+	if _, ok := j.Get("d"); ok {
+		t.Error("Expected no entry for unknown action")
+	}
+}
+
+func TestJournalCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "action_journal")
+
+	j, err := Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	start := time.Now()
+	for i := 0; i < maxActions+10; i++ {
+		if err := j.Record(Entry{ActionID: fmt.Sprintf("action-%d", i), State: StateSucceeded, Time: start.Add(time.Duration(i) * time.Second)}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	j.Close()
+
+	j, err = Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer j.Close()
+
+	if len(j.actions) != maxActions {
+		t.Errorf("Expected %d actions after compaction, got %d", maxActions, len(j.actions))
+	}
+	if _, ok := j.Get("action-0"); ok {
+		t.Error("Expected the oldest action to be compacted away")
+	}
+}
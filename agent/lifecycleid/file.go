@@ -0,0 +1,65 @@
+package lifecycleid
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	directoryPermissions = 0755 // Owner can read/write/execute, others can read/execute
+	filePermissions      = 0644 // Owner can read/write, others can read only
+)
+
+// FileStore stores the lifecycle ID in a file. It survives restarts only if the file is on a
+// persistent volume.
+type FileStore struct {
+	Path string
+}
+
+func (s *FileStore) Load(ctx context.Context) (string, error) {
+	content, err := os.ReadFile(s.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", ErrNotStored
+	}
+	if err != nil {
+		return "", err
+	}
+
+	id := strings.TrimSpace(string(content))
+	if id == "" {
+		return "", ErrNotStored
+	}
+	return id, nil
+}
+
+func (s *FileStore) Store(ctx context.Context, id string) error {
+	if err := os.MkdirAll(filepath.Dir(s.Path), directoryPermissions); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, filePermissions)
+	if errors.Is(err, fs.ErrExist) {
+		if _, loadErr := s.Load(ctx); !errors.Is(loadErr, ErrNotStored) {
+			return ErrConflict
+		}
+		// The file was left empty by an earlier failure.
+		return os.WriteFile(s.Path, []byte(id), filePermissions)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.WriteString(id); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *FileStore) String() string {
+	return "file " + s.Path
+}
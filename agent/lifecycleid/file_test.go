@@ -0,0 +1,75 @@
+package lifecycleid
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	store := &FileStore{Path: filepath.Join(t.TempDir(), "newdir", "lifecycle_id")}
+
+	if _, err := store.Load(ctx); !errors.Is(err, ErrNotStored) {
+		t.Fatalf("Expected ErrNotStored, got %v", err)
+	}
+
+	id1, err := Get(ctx, store)
+	if err != nil || id1 == "" {
+		t.Fatalf("Get() returned %q and %v", id1, err)
+	}
+
+	id2, err := Get(ctx, store)
+	if err != nil || id2 != id1 {
+		t.Errorf("Expected the same ID on the second call, got %q and %v", id2, err)
+	}
+
+	if err := store.Store(ctx, "other"); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict, got %v", err)
+	}
+}
+
+func TestFileStoreEmpty(t *testing.T) {
+	ctx := context.Background()
+	store := &FileStore{Path: filepath.Join(t.TempDir(), "lifecycle_id")}
+
+	if err := os.WriteFile(store.Path, nil, filePermissions); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Store(ctx, "id"); err != nil {
+		t.Fatalf("Expected an empty file to be replaced, got %v", err)
+	}
+	if id, _ := store.Load(ctx); id != "id" {
+		t.Errorf("Expected id, got %q", id)
+	}
+}
+
+func TestFileStoreUnwritable(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file"), nil, filePermissions); err != nil {
+		t.Fatal(err)
+	}
+
+	// The ID can't be stored below a file, which is reported rather than returning an ID that would
+	// change on every restart.
+	if _, err := Get(context.Background(), &FileStore{Path: filepath.Join(dir, "file", "lifecycle_id")}); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func TestGetCarriesOver(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	legacy := &FileStore{Path: filepath.Join(dir, "legacy")}
+	if err := legacy.Store(ctx, "legacy-id"); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := Get(ctx, &FileStore{Path: filepath.Join(dir, "new")}, &FileStore{Path: filepath.Join(dir, "missing")}, legacy)
+	if err != nil || id != "legacy-id" {
+		t.Errorf("Expected the legacy ID to be carried over, got %q and %v", id, err)
+	}
+}
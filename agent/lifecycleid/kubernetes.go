@@ -0,0 +1,150 @@
+package lifecycleid
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// dataKey is the key the ID is stored under in a ConfigMap or Secret.
+const dataKey = "lifecycle_id"
+
+// ObjectStore stores the lifecycle ID in a ConfigMap or Secret, so that it survives the agent's pod
+// being rescheduled without a persistent volume. Concurrent agents can't overwrite each other's ID:
+// the object is created only if it doesn't exist, and updated only at the version it was read at.
+//
+// The object has no owner, so that it isn't garbage collected with the workload running the agent,
+// eg: when its Deployment is renamed or replaced by a StatefulSet. It is also kept when the release
+// is uninstalled, and must be deleted by hand to give a reinstalled agent a new identity.
+type ObjectStore struct {
+	client    kubernetes.Interface
+	secret    bool
+	namespace string
+	name      string
+}
+
+// NewConfigMapStore stores the ID in a ConfigMap.
+func NewConfigMapStore(client kubernetes.Interface, namespace, name string) *ObjectStore {
+	return &ObjectStore{client: client, namespace: namespace, name: name}
+}
+
+// NewSecretStore stores the ID in a Secret, see NewConfigMapStore.
+func NewSecretStore(client kubernetes.Interface, namespace, name string) *ObjectStore {
+	return &ObjectStore{client: client, secret: true, namespace: namespace, name: name}
+}
+
+func (s *ObjectStore) Load(ctx context.Context) (string, error) {
+	var id string
+	if s.secret {
+		secret, err := s.client.CoreV1().Secrets(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+		if err != nil {
+			return "", s.loadError(err)
+		}
+		id = string(secret.Data[dataKey])
+	} else {
+		configMap, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+		if err != nil {
+			return "", s.loadError(err)
+		}
+		id = configMap.Data[dataKey]
+	}
+
+	if id == "" {
+		return "", ErrNotStored
+	}
+	return id, nil
+}
+
+func (s *ObjectStore) loadError(err error) error {
+	if apierrors.IsNotFound(err) {
+		return ErrNotStored
+	}
+	return err
+}
+
+func (s *ObjectStore) Store(ctx context.Context, id string) error {
+	var err error
+	if s.secret {
+		err = s.storeSecret(ctx, id)
+	} else {
+		err = s.storeConfigMap(ctx, id)
+	}
+
+	if apierrors.IsAlreadyExists(err) || apierrors.IsConflict(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+// storeConfigMap creates the ConfigMap, or adds the ID to a ConfigMap created without one, eg: by
+// hand. The update fails with a conflict if the ConfigMap changed since it was read.
+func (s *ObjectStore) storeConfigMap(ctx context.Context, id string) error {
+	configMap, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = s.client.CoreV1().ConfigMaps(s.namespace).Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: s.objectMeta(),
+			Data:       map[string]string{dataKey: id},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if configMap.Data[dataKey] != "" {
+		return ErrConflict
+	}
+	if configMap.Data == nil {
+		configMap.Data = map[string]string{}
+	}
+	configMap.Data[dataKey] = id
+
+	_, err = s.client.CoreV1().ConfigMaps(s.namespace).Update(ctx, configMap, metav1.UpdateOptions{})
+	return err
+}
+
+// storeSecret is storeConfigMap for a Secret.
+func (s *ObjectStore) storeSecret(ctx context.Context, id string) error {
+	secret, err := s.client.CoreV1().Secrets(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = s.client.CoreV1().Secrets(s.namespace).Create(ctx, &corev1.Secret{
+			ObjectMeta: s.objectMeta(),
+			Data:       map[string][]byte{dataKey: []byte(id)},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(secret.Data[dataKey]) > 0 {
+		return ErrConflict
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[dataKey] = []byte(id)
+
+	_, err = s.client.CoreV1().Secrets(s.namespace).Update(ctx, secret, metav1.UpdateOptions{})
+	return err
+}
+
+func (s *ObjectStore) objectMeta() metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      s.name,
+		Namespace: s.namespace,
+		Labels:    map[string]string{"app.kubernetes.io/managed-by": "shepherd-agent"},
+	}
+}
+
+func (s *ObjectStore) String() string {
+	kind := "configmap"
+	if s.secret {
+		kind = "secret"
+	}
+	return fmt.Sprintf("%s %s/%s", kind, s.namespace, s.name)
+}
@@ -0,0 +1,115 @@
+package lifecycleid
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestObjectStore(t *testing.T) {
+	ctx := context.Background()
+
+	for _, secret := range []bool{false, true} {
+		client := fake.NewClientset()
+		store := NewConfigMapStore(client, "app", "app-lifecycle-id")
+		if secret {
+			store = NewSecretStore(client, "app", "app-lifecycle-id")
+		}
+
+		id, err := Get(ctx, store)
+		if err != nil || id == "" {
+			t.Fatalf("%s: Get() returned %q and %v", store, id, err)
+		}
+
+		// The ID survives the agent, eg: when its pod is rescheduled.
+		again, err := Get(ctx, NewConfigMapStore(client, "app", "app-lifecycle-id"))
+		if secret {
+			again, err = Get(ctx, NewSecretStore(client, "app", "app-lifecycle-id"))
+		}
+		if err != nil || again != id {
+			t.Errorf("%s: Expected %q again, got %q and %v", store, id, again, err)
+		}
+
+		if err := store.Store(ctx, "other"); !errors.Is(err, ErrConflict) {
+			t.Errorf("%s: Expected ErrConflict, got %v", store, err)
+		}
+
+		var meta metav1.ObjectMeta
+		if secret {
+			s, _ := client.CoreV1().Secrets("app").Get(ctx, "app-lifecycle-id", metav1.GetOptions{})
+			meta = s.ObjectMeta
+		} else {
+			cm, _ := client.CoreV1().ConfigMaps("app").Get(ctx, "app-lifecycle-id", metav1.GetOptions{})
+			meta = cm.ObjectMeta
+		}
+		// An owner would garbage collect the ID when the agent's workload is replaced.
+		if len(meta.OwnerReferences) != 0 {
+			t.Errorf("%s: Expected the object to have no owner, got %+v", store, meta.OwnerReferences)
+		}
+	}
+}
+
+func TestObjectStoreExistingObject(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-lifecycle-id", Namespace: "app", ResourceVersion: "1"},
+		Data:       map[string]string{"other": "value"},
+	})
+	store := NewConfigMapStore(client, "app", "app-lifecycle-id")
+
+	if _, err := store.Load(ctx); !errors.Is(err, ErrNotStored) {
+		t.Fatalf("Expected ErrNotStored, got %v", err)
+	}
+
+	id, err := Get(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cm, _ := client.CoreV1().ConfigMaps("app").Get(ctx, "app-lifecycle-id", metav1.GetOptions{})
+	if cm.Data[dataKey] != id || cm.Data["other"] != "value" {
+		t.Errorf("Expected the ID to be added to the ConfigMap, got %v", cm.Data)
+	}
+}
+
+func TestObjectStoreConcurrent(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewClientset()
+	store := NewConfigMapStore(client, "app", "app-lifecycle-id")
+
+	// Another agent creates the ConfigMap between this agent's read and its create.
+	client.PrependReactor("create", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		client.PrependReactor("create", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return false, nil, nil
+		})
+		client.Tracker().Add(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "app-lifecycle-id", Namespace: "app"},
+			Data:       map[string]string{dataKey: "winner"},
+		})
+		return true, nil, apierrors.NewAlreadyExists(schema.GroupResource{Resource: "configmaps"}, "app-lifecycle-id")
+	})
+
+	id, err := Get(ctx, store)
+	if err != nil || id != "winner" {
+		t.Errorf("Expected the concurrently stored ID, got %q and %v", id, err)
+	}
+}
+
+func TestObjectStoreError(t *testing.T) {
+	client := fake.NewClientset()
+	client.PrependReactor("get", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, "app-lifecycle-id", errors.New("RBAC"))
+	})
+
+	if _, err := Get(context.Background(), NewConfigMapStore(client, "app", "app-lifecycle-id")); err == nil {
+		t.Error("Expected an error rather than an ID that isn't stored")
+	}
+}
@@ -0,0 +1,83 @@
+// Package lifecycleid persists the ID that identifies a deployment of the agent to the backend for
+// as long as it is installed, across restarts and rescheduling.
+package lifecycleid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotStored is returned by LifecycleIDStore.Load if no ID has been stored yet.
+	ErrNotStored = errors.New("no lifecycle ID stored")
+
+	// ErrConflict is returned by LifecycleIDStore.Store if another ID was stored first.
+	ErrConflict = errors.New("another lifecycle ID was stored concurrently")
+)
+
+// LifecycleIDStore persists the lifecycle ID.
+type LifecycleIDStore interface {
+	// Load returns the stored ID, or ErrNotStored.
+	Load(ctx context.Context) (string, error)
+
+	// Store stores id if no ID is stored yet, or returns ErrConflict.
+	Store(ctx context.Context, id string) error
+
+	// String describes where the ID is stored, eg: "configmap app/shepherd-lifecycle-id".
+	String() string
+}
+
+// maxStoreAttempts bounds how often Get loads the ID again after losing a race to store it.
+const maxStoreAttempts = 3
+
+// Get returns the lifecycle ID in store, storing a new one if there is none. If store is empty the
+// first ID found in previous is stored instead, so that an agent moving to a new store keeps its
+// identity. An error is returned rather than an ID that wasn't stored, which would make the agent
+// look like a new deployment each time it restarts.
+func Get(ctx context.Context, store LifecycleIDStore, previous ...LifecycleIDStore) (string, error) {
+	for range maxStoreAttempts {
+		id, err := store.Load(ctx)
+		if err == nil {
+			log.Printf("Found existing lifecycle ID %s in %s", id, store)
+			return id, nil
+		}
+		if !errors.Is(err, ErrNotStored) {
+			return "", fmt.Errorf("failed to load lifecycle ID from %s: %w", store, err)
+		}
+
+		id = carriedOver(ctx, previous)
+		if id == "" {
+			id = uuid.New().String()
+		}
+
+		err = store.Store(ctx, id)
+		if err == nil {
+			log.Printf("Stored lifecycle ID %s in %s", id, store)
+			return id, nil
+		}
+		if !errors.Is(err, ErrConflict) {
+			return "", fmt.Errorf("failed to store lifecycle ID in %s: %w", store, err)
+		}
+	}
+
+	return "", fmt.Errorf("failed to store lifecycle ID in %s: %w", store, ErrConflict)
+}
+
+// carriedOver returns the first ID found in stores, or "" if there is none.
+func carriedOver(ctx context.Context, stores []LifecycleIDStore) string {
+	for _, s := range stores {
+		id, err := s.Load(ctx)
+		if err == nil {
+			log.Printf("Carrying over lifecycle ID %s from %s", id, s)
+			return id
+		}
+		if !errors.Is(err, ErrNotStored) {
+			log.Printf("Not carrying over the lifecycle ID from %s: %v", s, err)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,315 @@
+// Package logship batches the supervised process's output and uploads it to the backend.
+package logship
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"agent/retry"
+)
+
+type Stream string
+
+const (
+	Stdout Stream = "stdout"
+	Stderr Stream = "stderr"
+)
+
+type Line struct {
+	Time   time.Time
+	Stream Stream
+	Text   string
+}
+
+// Redacted replaces the text matched by a redaction pattern.
+const Redacted = "[REDACTED]"
+
+const (
+	defaultMaxLineBytes   = 16 << 10
+	defaultBatchBytes     = 256 << 10
+	defaultMaxBufferBytes = 8 << 20
+	defaultFlushInterval  = 5 * time.Second
+	defaultBudgetInterval = time.Hour
+
+	uploadInitialBackoff = time.Second
+	uploadMaxBackoff     = time.Minute
+)
+
+type Config struct {
+	// Redactions are replaced with Redacted in every line before it is buffered.
+	Redactions []*regexp.Regexp
+
+	// MaxLineBytes is the length lines are truncated to. The rest of a longer line is dropped.
+	MaxLineBytes int
+
+	// Lines are uploaded every FlushInterval, or as soon as BatchBytes of them are buffered, in
+	// batches of at most BatchBytes.
+	BatchBytes    int
+	FlushInterval time.Duration
+
+	// MaxBufferBytes bounds the lines waiting to be uploaded. Once it is reached the oldest lines are
+	// dropped, so that a slow or unreachable backend never blocks the process.
+	MaxBufferBytes int
+
+	// BudgetBytes is how much may be uploaded per BudgetInterval. Lines over the budget are dropped.
+	// There is no budget if BudgetBytes is 0.
+	BudgetBytes    int
+	BudgetInterval time.Duration
+}
+
+// ParseRedactions compiles newline-separated regular expressions, ignoring blank lines.
+func ParseRedactions(s string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, pattern := range strings.Split(s, "\n") {
+		if strings.TrimSpace(pattern) == "" {
+			continue
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern: %w", err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// Upload sends a batch of lines to the backend. dropped is how many lines were dropped since the
+// previous successful upload.
+type Upload func(ctx context.Context, lines []Line, dropped int64) error
+
+// Shipper buffers lines written to its stream writers and uploads them.
+type Shipper struct {
+	cfg Config
+	now func() time.Time
+
+	mu          sync.Mutex
+	lines       []Line
+	head        uint64 // the sequence number of lines[0]
+	bufferBytes int
+	dropped     int64
+
+	budgetUsed   int
+	budgetStart  time.Time
+	budgetWarned bool
+
+	ready chan struct{}
+}
+
+func New(cfg Config) *Shipper {
+	if cfg.MaxLineBytes <= 0 {
+		cfg.MaxLineBytes = defaultMaxLineBytes
+	}
+	if cfg.BatchBytes <= 0 {
+		cfg.BatchBytes = defaultBatchBytes
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+	if cfg.MaxBufferBytes <= 0 {
+		cfg.MaxBufferBytes = defaultMaxBufferBytes
+	}
+	if cfg.BudgetInterval <= 0 {
+		cfg.BudgetInterval = defaultBudgetInterval
+	}
+
+	return &Shipper{
+		cfg:   cfg,
+		now:   time.Now,
+		ready: make(chan struct{}, 1),
+	}
+}
+
+// Writer returns a writer whose output is shipped as lines of the given stream. Writes never block
+// on the backend.
+func (s *Shipper) Writer(stream Stream) *Writer {
+	return &Writer{shipper: s, stream: stream}
+}
+
+// Add redacts, truncates and buffers a line.
+func (s *Shipper) Add(stream Stream, text string) {
+	for _, re := range s.cfg.Redactions {
+		text = re.ReplaceAllLiteralString(text, Redacted)
+	}
+	if len(text) > s.cfg.MaxLineBytes {
+		text = text[:s.cfg.MaxLineBytes]
+	}
+	// Lines are sent as protobuf strings, which must be valid UTF-8.
+	text = strings.ToValidUTF8(text, "\uFFFD")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lines = append(s.lines, Line{Time: s.now(), Stream: stream, Text: text})
+	s.bufferBytes += len(text)
+
+	for s.bufferBytes > s.cfg.MaxBufferBytes && len(s.lines) > 0 {
+		s.bufferBytes -= len(s.lines[0].Text)
+		s.lines = s.lines[1:]
+		s.head++
+		s.dropped++
+	}
+
+	if s.bufferBytes >= s.cfg.BatchBytes {
+		select {
+		case s.ready <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run uploads buffered lines until ctx is done. Failed uploads are retried with backoff, while new
+// lines keep being buffered.
+func (s *Shipper) Run(ctx context.Context, upload Upload) {
+	ticker := time.NewTicker(s.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.ready:
+		}
+
+		fn := func() error {
+			err := s.flush(ctx, upload)
+			if err != nil {
+				log.Printf("Failed to upload logs: %v", err)
+			}
+			return err
+		}
+
+		if err := retry.RetryExponential(ctx, fn, uploadInitialBackoff, uploadMaxBackoff); err != nil && ctx.Err() == nil {
+			log.Printf("Log upload error: %v", err)
+		}
+	}
+}
+
+// flush uploads the buffered lines in batches.
+func (s *Shipper) flush(ctx context.Context, upload Upload) error {
+	for {
+		batch, head, dropped := s.batch()
+		if len(batch) == 0 && dropped == 0 {
+			return nil
+		}
+
+		if err := upload(ctx, batch, dropped); err != nil {
+			return err
+		}
+
+		s.commit(batch, head, dropped)
+	}
+}
+
+// batch returns the oldest lines that fit in a batch and the budget, the sequence number of the
+// first of them, and how many lines have been dropped. Lines over the budget are dropped.
+func (s *Shipper) batch() ([]Line, uint64, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now := s.now(); s.budgetStart.IsZero() || now.Sub(s.budgetStart) >= s.cfg.BudgetInterval {
+		s.budgetStart, s.budgetUsed, s.budgetWarned = now, 0, false
+	}
+
+	size, n := 0, 0
+	for ; n < len(s.lines); n++ {
+		lineSize := len(s.lines[n].Text)
+		if n > 0 && size+lineSize > s.cfg.BatchBytes {
+			break
+		}
+
+		if s.cfg.BudgetBytes > 0 && s.budgetUsed+size+lineSize > s.cfg.BudgetBytes {
+			if !s.budgetWarned {
+				log.Printf("Log budget of %d bytes per %s used up, dropping logs", s.cfg.BudgetBytes, s.cfg.BudgetInterval)
+				s.budgetWarned = true
+			}
+
+			// Drop the rest of the buffer, keeping the lines that still fit.
+			for _, l := range s.lines[n:] {
+				s.bufferBytes -= len(l.Text)
+			}
+			s.dropped += int64(len(s.lines) - n)
+			s.lines = s.lines[:n]
+			break
+		}
+
+		size += lineSize
+	}
+
+	return append([]Line(nil), s.lines[:n]...), s.head, s.dropped
+}
+
+// commit removes an uploaded batch, which started at sequence number head, from the buffer.
+func (s *Shipper) commit(batch []Line, head uint64, dropped int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, l := range batch {
+		s.budgetUsed += len(l.Text)
+	}
+
+	// Lines may have been dropped from the front of the buffer during the upload.
+	end := head + uint64(len(batch))
+	for s.head < end && len(s.lines) > 0 {
+		s.bufferBytes -= len(s.lines[0].Text)
+		s.lines = s.lines[1:]
+		s.head++
+	}
+
+	s.dropped -= dropped
+}
+
+// Writer splits its output into lines and adds them to the shipper.
+type Writer struct {
+	shipper *Shipper
+	stream  Stream
+
+	mu      sync.Mutex
+	partial bytes.Buffer
+
+	// truncated is set once the line being written has been shipped, so that the rest of it is
+	// dropped up to its end.
+	truncated bool
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n := len(p)
+	for len(p) > 0 {
+		text, rest, ended := bytes.Cut(p, []byte{'\n'})
+		p = rest
+
+		if !w.truncated {
+			w.partial.Write(text)
+		}
+
+		if ended {
+			if !w.truncated {
+				w.shipper.Add(w.stream, strings.TrimSuffix(w.partial.String(), "\r"))
+			}
+			w.partial.Reset()
+			w.truncated = false
+			continue
+		}
+
+		// A line with no end is shipped, truncated, once it is too long rather than buffered
+		// forever. Twice as much as is shipped is buffered and redacted, so that a secret crossing
+		// the cut is still matched whole.
+		if !w.truncated && w.partial.Len() >= 2*w.shipper.cfg.MaxLineBytes {
+			w.shipper.Add(w.stream, w.partial.String())
+			w.partial.Reset()
+			w.truncated = true
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,181 @@
+package logship
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+type uploads struct {
+	batches [][]Line
+	dropped []int64
+	err     error
+}
+
+func (u *uploads) upload(ctx context.Context, lines []Line, dropped int64) error {
+	if u.err != nil {
+		return u.err
+	}
+	u.batches = append(u.batches, lines)
+	u.dropped = append(u.dropped, dropped)
+	return nil
+}
+
+func (u *uploads) texts() []string {
+	var texts []string
+	for _, batch := range u.batches {
+		for _, l := range batch {
+			texts = append(texts, string(l.Stream)+":"+l.Text)
+		}
+	}
+	return texts
+}
+
+func TestWriter(t *testing.T) {
+	s := New(Config{
+		Redactions:   []*regexp.Regexp{regexp.MustCompile(`password=\S+`)},
+		MaxLineBytes: 10,
+	})
+
+	stdout, stderr := s.Writer(Stdout), s.Writer(Stderr)
+	stdout.Write([]byte("hello\r\nwor"))
+	stderr.Write([]byte("oops\n"))
+	stdout.Write([]byte("ld\npassword=hunter2\n"))
+	stdout.Write([]byte("a line that never ends"))
+
+	u := &uploads{}
+	if err := s.flush(context.Background(), u.upload); err != nil {
+		t.Fatalf("flush() returned error: %v", err)
+	}
+
+	want := []string{"stdout:hello", "stderr:oops", "stdout:world", "stdout:[REDACTED]", "stdout:a line tha"}
+	if got := u.texts(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestWriterTruncatesLongLines(t *testing.T) {
+	s := New(Config{
+		Redactions:   []*regexp.Regexp{regexp.MustCompile(`secret-\w+`)},
+		MaxLineBytes: 16,
+	})
+
+	// The secret crosses the 16th byte, and arrives over several writes without a line end.
+	w := s.Writer(Stdout)
+	for _, chunk := range []string{"the token is secr", "et-abcdefgh and ", "more that is dropped", " until the end\n", "next\n"} {
+		w.Write([]byte(chunk))
+	}
+
+	u := &uploads{}
+	if err := s.flush(context.Background(), u.upload); err != nil {
+		t.Fatalf("flush() returned error: %v", err)
+	}
+
+	want := []string{"stdout:the token is [RE", "stdout:next"}
+	if got := u.texts(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestShipperBackpressure(t *testing.T) {
+	s := New(Config{MaxBufferBytes: 10, BatchBytes: 4})
+
+	for _, text := range []string{"aaaa", "bbbb", "cccc", "dddd"} {
+		s.Add(Stdout, text)
+	}
+
+	// The backend is unavailable, so nothing is removed from the buffer.
+	u := &uploads{err: errors.New("unavailable")}
+	if err := s.flush(context.Background(), u.upload); err == nil {
+		t.Fatal("Expected flush() to fail")
+	}
+
+	u.err = nil
+	if err := s.flush(context.Background(), u.upload); err != nil {
+		t.Fatalf("flush() returned error: %v", err)
+	}
+
+	if want := []string{"stdout:cccc", "stdout:dddd"}; fmt.Sprint(u.texts()) != fmt.Sprint(want) {
+		t.Errorf("Expected the oldest lines to be dropped, got %q", u.texts())
+	}
+	if len(u.batches) != 2 || u.dropped[0] != 2 || u.dropped[1] != 0 {
+		t.Errorf("Expected 2 batches reporting 2 dropped lines once, got %d batches and %v", len(u.batches), u.dropped)
+	}
+}
+
+func TestShipperBudget(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := New(Config{BudgetBytes: 10, BudgetInterval: time.Hour})
+	s.now = func() time.Time { return now }
+
+	for _, text := range []string{"aaaa", "bbbb", "cccc"} {
+		s.Add(Stdout, text)
+	}
+
+	u := &uploads{}
+	if err := s.flush(context.Background(), u.upload); err != nil {
+		t.Fatalf("flush() returned error: %v", err)
+	}
+
+	s.Add(Stdout, "dddd")
+	if err := s.flush(context.Background(), u.upload); err != nil {
+		t.Fatalf("flush() returned error: %v", err)
+	}
+
+	now = now.Add(time.Hour)
+	s.Add(Stdout, "eeee")
+	if err := s.flush(context.Background(), u.upload); err != nil {
+		t.Fatalf("flush() returned error: %v", err)
+	}
+
+	want := []string{"stdout:aaaa", "stdout:bbbb", "stdout:eeee"}
+	if got := u.texts(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if fmt.Sprint(u.dropped) != "[1 1 0]" {
+		t.Errorf("Expected dropped lines to be reported, got %v", u.dropped)
+	}
+}
+
+func TestShipperRun(t *testing.T) {
+	s := New(Config{BatchBytes: 8, FlushInterval: time.Hour})
+
+	uploaded := make(chan []Line, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go s.Run(ctx, func(ctx context.Context, lines []Line, dropped int64) error {
+		uploaded <- lines
+		return nil
+	})
+
+	// Filling a batch uploads it without waiting for the flush interval.
+	s.Add(Stderr, strings.Repeat("x", 8))
+
+	select {
+	case lines := <-uploaded:
+		if len(lines) != 1 || lines[0].Stream != Stderr {
+			t.Errorf("Expected the stderr line, got %v", lines)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a full batch to be uploaded")
+	}
+}
+
+func TestParseRedactions(t *testing.T) {
+	res, err := ParseRedactions("token=\\w+\n\n(?i)bearer \\S+\n")
+	if err != nil {
+		t.Fatalf("ParseRedactions() returned error: %v", err)
+	}
+	if len(res) != 2 {
+		t.Errorf("Expected 2 patterns, got %d", len(res))
+	}
+
+	if _, err := ParseRedactions("("); err == nil {
+		t.Error("Expected error for invalid pattern")
+	}
+}
@@ -4,10 +4,23 @@ import (
 	"context"
 	"log"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"agent/agent"
+	"agent/backend"
+	"agent/backup"
+	"agent/cluster"
 	"agent/config"
+	"agent/control"
+	"agent/lifecycleid"
+	"agent/logship"
+	"agent/process"
+	"agent/ssh"
+
+	"github.com/google/uuid"
 )
 
 var (
@@ -21,12 +34,42 @@ var (
 			"bearer-token",
 			"",
 			"The bearer token to authenticate with the backend",
+		).Secret(),
+		BearerTokenFile: config.Define(
+			"bearer-token-file",
+			"",
+			"A file to read the bearer token from instead of bearer-token, eg: a mounted Secret. The file is read again when it changes",
 		),
 		BackendAddr: config.Define(
 			"backend-addr",
 			"",
 			"The address of the backend",
 		),
+		BackendProxyURL: config.Define(
+			"backend-proxy-url",
+			"",
+			"The HTTP(S) proxy to reach the backend through, with optional credentials as userinfo. Defaults to the standard proxy environment variables",
+		).Secret(),
+		BackendCAFile: config.Define(
+			"backend-ca-file",
+			"",
+			"A PEM bundle of CAs to trust for the backend in addition to the system's",
+		),
+		BackendClientCertFile: config.Define(
+			"backend-client-cert-file",
+			"",
+			"The PEM client certificate presented to the backend for mutual TLS",
+		),
+		BackendClientKeyFile: config.Define(
+			"backend-client-key-file",
+			"",
+			"The PEM key of the client certificate",
+		),
+		BackendPinnedFingerprints: config.Define(
+			"backend-pinned-fingerprints",
+			"",
+			"Comma-separated SHA-256 fingerprints of certificates, one of which the backend's chain must contain",
+		),
 		HeartbeatInterval: config.Define(
 			"heartbeat-interval",
 			30*time.Second,
@@ -47,38 +90,490 @@ var (
 			"/mnt/data/lifecycle_id",
 			"The file path to store the life cycle id",
 		),
+		LifecycleIDStore: config.Define(
+			"lifecycle-id-store",
+			"configmap",
+			"Where the lifecycle ID is stored: configmap, secret, or file (life-cycle-id-file-path, which must be on a persistent volume to survive restarts). An ID already in the file is carried over to a ConfigMap or Secret, which is kept when the release is uninstalled",
+		),
+		LifecycleIDObject: config.Define(
+			"lifecycle-id-object",
+			"",
+			"The name of the ConfigMap or Secret the lifecycle ID is stored in. Defaults to the release name followed by -lifecycle-id",
+		),
+		ActionJournalFilePath: config.Define(
+			"action-journal-file-path",
+			"/mnt/data/action_journal",
+			"The file path to record received actions and their outcomes",
+		),
+		OutboxDir: config.Define(
+			"outbox-dir",
+			"/mnt/data/outbox",
+			"The directory to queue heartbeats and action results in until the backend receives them",
+		),
+		OutboxMaxRecords: config.Define(
+			"outbox-max-records",
+			10000,
+			"How many requests may be queued for the backend before the oldest heartbeats are dropped",
+		),
+		OutboxMaxBytes: config.Define(
+			"outbox-max-bytes",
+			int64(256<<20),
+			"How many bytes of requests, including session recordings, may be queued for the backend before the oldest heartbeats, then recordings, are dropped",
+		),
+		ReadyTimeout: config.Define(
+			"upgrade-ready-timeout",
+			5*time.Minute,
+			"How long to wait for workloads to become ready after an upgrade before rolling back",
+		),
+		BackupJobImage: config.Define(
+			"backup-job-image",
+			"",
+			"The image of the Job that backs up the release before an upgrade. The Job backup is disabled if empty",
+		),
+		BackupJobCommand: config.Define(
+			"backup-job-command",
+			"",
+			"The shell command the backup Job runs, required if backup-job-image is set",
+		),
+		BackupJobServiceAccount: config.Define(
+			"backup-job-service-account",
+			"",
+			"The service account the backup Job runs as",
+		),
+		BackupVolumeSnapshots: config.Define(
+			"backup-volume-snapshots",
+			false,
+			"Whether to take CSI volume snapshots of the release's persistent volume claims before an upgrade",
+		),
+		BackupVolumeSnapshotClass: config.Define(
+			"backup-volume-snapshot-class",
+			"",
+			"The VolumeSnapshotClass used for volume snapshots",
+		),
+		BackupTimeout: config.Define(
+			"backup-timeout",
+			30*time.Minute,
+			"How long each pre-upgrade backup may take to complete",
+		),
+		ChartSigningKey: config.Define(
+			"chart-signing-public-key",
+			"",
+			"The ed25519 public key (PEM or base64) charts must be signed with before they are applied. Charts are not verified if empty",
+		),
+		MaintenanceWindows: config.Define(
+			"maintenance-windows",
+			"",
+			"Semicolon-separated windows charts may be applied in, e.g. \"Sat 02:00-04:00 UTC\". Charts may be applied at any time if empty",
+		).ListSeparator(";"),
+		ApprovalPolicy: config.Define(
+			"upgrade-approval-policy",
+			"auto",
+			"How chart upgrades are approved: auto, annotation (approved with an annotation in the cluster) or never",
+		),
+		ManagedReleases: config.Define(
+			"managed-releases",
+			"",
+			"Comma-separated releases, as namespace/name or namespace/* for every release in a namespace, that charts may be applied to besides the agent's own. The agent's service account needs permission to upgrade them, see the chart's managedNamespaces value",
+		),
+		RestartPolicy: config.Define(
+			"restart-policy",
+			"always",
+			"When the process given after the flags is restarted after it exits: always, on-failure or never",
+		),
+		RestartMaxBackoff: config.Define(
+			"restart-max-backoff",
+			5*time.Minute,
+			"The longest delay before restarting the process, which doubles after each run that fails quickly",
+		),
+		ShutdownGracePeriod: config.Define(
+			"shutdown-grace-period",
+			30*time.Second,
+			"How long the process has to exit after SIGTERM before it is killed",
+		),
+		CrashLoopRestarts: config.Define(
+			"crash-loop-restarts",
+			5,
+			"How many failures within crash-loop-window are reported as a crash loop",
+		),
+		CrashLoopWindow: config.Define(
+			"crash-loop-window",
+			10*time.Minute,
+			"The window failures are counted in to detect crash loops",
+		),
+		ShipLogs: config.Define(
+			"ship-logs",
+			true,
+			"Whether to upload the process's output to the backend",
+		),
+		LogRedactionPatterns: config.Define(
+			"log-redaction-patterns",
+			"",
+			"Newline-separated regular expressions whose matches are redacted from the process's output before it is uploaded",
+		).ListSeparator("\n"),
+		LogBudgetBytes: config.Define(
+			"log-budget-bytes",
+			100<<20,
+			"How many bytes of output may be uploaded per hour. Output over the budget is dropped",
+		),
+		ControlAddr: config.Define(
+			"control-addr",
+			":8080",
+			"The address the control server listens on. The control server is disabled if empty",
+		),
+		ControlAuth: config.Define(
+			"control-auth",
+			"token",
+			"How requests to the control server are authenticated: token (a shared token, see control-token) or tokenreview (the callers' Kubernetes service account tokens)",
+		),
+		ControlToken: config.Define(
+			"control-token",
+			"",
+			"The shared token requests to the control server must carry, eg: from a Secret",
+		).Secret(),
+		ControlTokenFile: config.Define(
+			"control-token-file",
+			"",
+			"A file to read the control server's shared token from instead of control-token, eg: a mounted Secret. The file is read again when it changes",
+		),
+		ControlServiceAccounts: config.Define(
+			"control-allowed-service-accounts",
+			"",
+			"Comma-separated service accounts, as namespace:name, allowed to call the control server with tokenreview authentication",
+		),
+		ControlTokenAudiences: config.Define(
+			"control-token-audiences",
+			"",
+			"Comma-separated audiences service account tokens must be valid for with tokenreview authentication. Defaults to the API server's",
+		),
+		TailscaleAuthKey: config.Define(
+			"tailscale-auth-key",
+			"",
+			"The Tailscale auth key the SSH break-glass server joins the tailnet with",
+		).Secret(),
+		AccessMaxDuration: config.Define(
+			"access-max-duration",
+			4*time.Hour,
+			"The longest an operator may grant shell access for",
+		),
+		AccessRequestTTL: config.Define(
+			"access-request-ttl",
+			time.Hour,
+			"How long a request for shell access waits for an operator before it lapses",
+		),
 	}
 )
 
 func main() {
 	config.Init(os.Args[1:])
 
+	if config.PrintRequested() {
+		if err := config.Print(os.Stdout); err != nil {
+			log.Fatalf("Failed to print config: %s", err)
+		}
+		return
+	}
+
 	log.Printf("Starting agent with name %s", cfg.Name.MustValue())
 
-	agent, err := agent.NewAgent(agent.AgentConfig{
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	agentCfg := agentConfig()
+	agentCfg.LifecycleIDStore = newLifecycleIDStore(ctx)
+	if args := config.Args(); len(args) > 0 {
+		if cfg.ShipLogs.MustValue() {
+			agentCfg.Logs = newLogShipper()
+		}
+		agentCfg.Supervisor = newSupervisor(args, agentCfg.Logs)
+	}
+
+	sshSrv, err := newSSHServer()
+	if err != nil {
+		log.Fatalf("Failed to create SSH server: %s", err)
+	}
+	agentCfg.SSH = sshSrv
+
+	agent, err := agent.NewAgent(agentCfg)
+	if err != nil {
+		log.Fatalf("Failed to create agent: %s", err)
+	}
+
+	// The agent keeps running after the restart policy stops restarting the supervised process, so
+	// that it still reports the process's exits. On shutdown it waits for the process to stop.
+	supervised := make(chan struct{})
+	if s := agentCfg.Supervisor; s != nil {
+		go s.ForwardSignals(ctx, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2)
+		go func() {
+			defer close(supervised)
+			if err := s.Run(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Supervisor error: %s", err)
+			}
+		}()
+	} else {
+		close(supervised)
+	}
+
+	go config.Watch(ctx, configWatchInterval, func() {
+		if err := agent.Reload(agentConfig()); err != nil {
+			log.Printf("Failed to reload config: %s", err)
+		}
+	})
+
+	if srv := newControlServer(ctx, agent, agentCfg.Supervisor, sshSrv); srv != nil {
+		go func() {
+			if err := srv.Start(ctx); err != nil {
+				log.Printf("Control server error: %s", err)
+			}
+		}()
+	}
+
+	log.Println("Agent created, starting heartbeat")
+
+	agent.Start(ctx)
+	<-supervised
+}
+
+func newSupervisor(args []string, logs *logship.Shipper) *process.Supervisor {
+	restartPolicy, err := process.ParseRestartPolicy(cfg.RestartPolicy.MustValue())
+	if err != nil {
+		log.Fatalf("Invalid restart policy: %s", err)
+	}
+
+	supervisorCfg := process.SupervisorConfig{
+		Command:           args[0],
+		Args:              args[1:],
+		RestartPolicy:     restartPolicy,
+		MaxBackoff:        cfg.RestartMaxBackoff.MustValue(),
+		GracePeriod:       cfg.ShutdownGracePeriod.MustValue(),
+		CrashLoopRestarts: cfg.CrashLoopRestarts.MustValue(),
+		CrashLoopWindow:   cfg.CrashLoopWindow.MustValue(),
+	}
+	if logs != nil {
+		supervisorCfg.Stdout = logs.Writer(logship.Stdout)
+		supervisorCfg.Stderr = logs.Writer(logship.Stderr)
+	}
+
+	return process.NewSupervisor(supervisorCfg)
+}
+
+func newLogShipper() *logship.Shipper {
+	redactions, err := logship.ParseRedactions(cfg.LogRedactionPatterns.MustValue())
+	if err != nil {
+		log.Fatalf("Invalid log redaction patterns: %s", err)
+	}
+
+	return logship.New(logship.Config{
+		Redactions:     redactions,
+		BudgetBytes:    cfg.LogBudgetBytes.MustValue(),
+		BudgetInterval: time.Hour,
+	})
+}
+
+// newControlServer returns the control server, or nil if it is disabled or its authentication is
+// not configured.
+func newControlServer(ctx context.Context, a *agent.Agent, supervisor *process.Supervisor, sshSrv *ssh.Server) *control.Server {
+	addr := cfg.ControlAddr.MustValue()
+	if addr == "" {
+		return nil
+	}
+
+	var auth control.Authenticator
+	switch mode := cfg.ControlAuth.MustValue(); mode {
+	case "token":
+		token, tokenFile := cfg.ControlToken.MustValue(), cfg.ControlTokenFile.MustValue()
+		if token == "" && tokenFile == "" {
+			log.Printf("Not starting the control server: neither control-token nor control-token-file is set")
+			return nil
+		}
+		auth = &control.TokenAuthenticator{Token: token, File: tokenFile}
+	case "tokenreview":
+		allowed := splitList(cfg.ControlServiceAccounts.MustValue())
+		if len(allowed) == 0 {
+			log.Printf("Not starting the control server: control-allowed-service-accounts is empty")
+			return nil
+		}
+
+		c, err := cluster.Self(ctx)
+		if err != nil {
+			log.Printf("Not starting the control server: %s", err)
+			return nil
+		}
+		client, err := c.Clientset()
+		if err != nil {
+			log.Printf("Not starting the control server: %s", err)
+			return nil
+		}
+		auth = control.NewTokenReviewAuthenticator(client, allowed, splitList(cfg.ControlTokenAudiences.MustValue()))
+	default:
+		log.Fatalf("Invalid control-auth %q, expected token or tokenreview", mode)
+	}
+
+	srv, err := control.New(control.Config{
+		Addr:       addr,
+		Auth:       auth,
+		SSH:        sshSrv,
+		Access:     a.Access(),
+		Agent:      a,
+		Supervisor: supervisor,
+	})
+	if err != nil {
+		log.Printf("Not starting the control server: %s", err)
+		return nil
+	}
+	return srv
+}
+
+// newLifecycleIDStore returns the store for the lifecycle ID, or nil to store it in
+// life-cycle-id-file-path. Outside a cluster the ID is always stored in the file.
+func newLifecycleIDStore(ctx context.Context) lifecycleid.LifecycleIDStore {
+	mode := cfg.LifecycleIDStore.MustValue()
+	switch mode {
+	case "file":
+		return nil
+	case "configmap", "secret":
+	default:
+		log.Fatalf("Invalid lifecycle-id-store %q, expected configmap, secret or file", mode)
+	}
+
+	c, err := cluster.Self(ctx)
+	if err != nil {
+		log.Printf("Not running in a cluster, storing the lifecycle ID in %s: %s", cfg.LifecycleIDFilePath.MustValue(), err)
+		return nil
+	}
+
+	client, err := c.Clientset()
+	if err != nil {
+		log.Fatalf("Failed to create Kubernetes client: %s", err)
+	}
+
+	name := cfg.LifecycleIDObject.MustValue()
+	if name == "" {
+		name = cluster.CurrentReleaseName() + "-lifecycle-id"
+	}
+
+	if mode == "secret" {
+		return lifecycleid.NewSecretStore(client, cluster.CurrentNamespace(), name)
+	}
+	return lifecycleid.NewConfigMapStore(client, cluster.CurrentNamespace(), name)
+}
+
+// newSSHServer returns the break-glass SSH server, which only accepts keys the backend authorizes
+// and only runs while an operator grants access.
+func newSSHServer() (*ssh.Server, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	return ssh.NewServer(cfg.TailscaleAuthKey.MustValue(), id.String()), nil
+}
+
+// configWatchInterval is how often the config file is checked for changes.
+const configWatchInterval = 30 * time.Second
+
+func agentConfig() agent.AgentConfig {
+	return agent.AgentConfig{
 		Name:                cfg.Name.MustValue(),
 		BackendAddr:         cfg.BackendAddr.MustValue(),
 		BearerToken:         cfg.BearerToken.MustValue(),
+		BearerTokenFile:     cfg.BearerTokenFile.MustValue(),
+		Transport: backend.TransportConfig{
+			ProxyURL:           cfg.BackendProxyURL.MustValue(),
+			CAFile:             cfg.BackendCAFile.MustValue(),
+			ClientCertFile:     cfg.BackendClientCertFile.MustValue(),
+			ClientKeyFile:      cfg.BackendClientKeyFile.MustValue(),
+			PinnedFingerprints: splitList(cfg.BackendPinnedFingerprints.MustValue()),
+		},
 		HeartbeatInterval:   cfg.HeartbeatInterval.MustValue(),
 		PlanInterval:        cfg.PlanInterval.MustValue(),
 		VersionID:         	 cfg.Version.MustValue(),
 		LifecycleIDFilePath: cfg.LifecycleIDFilePath.MustValue(),
-	})
-	if err != nil {
-		log.Fatalf("Failed to create agent: %s", err)
+		ReadyTimeout:        cfg.ReadyTimeout.MustValue(),
+		Backup: backup.Config{
+			JobImage:                cfg.BackupJobImage.MustValue(),
+			JobCommand:              cfg.BackupJobCommand.MustValue(),
+			JobServiceAccountName:   cfg.BackupJobServiceAccount.MustValue(),
+			VolumeSnapshots:         cfg.BackupVolumeSnapshots.MustValue(),
+			VolumeSnapshotClassName: cfg.BackupVolumeSnapshotClass.MustValue(),
+			Timeout:                 cfg.BackupTimeout.MustValue(),
+		},
+		ChartSigningKey:       cfg.ChartSigningKey.MustValue(),
+		MaintenanceWindows:    cfg.MaintenanceWindows.MustValue(),
+		ApprovalPolicy:        cfg.ApprovalPolicy.MustValue(),
+		ManagedReleases:       cfg.ManagedReleases.MustValue(),
+		ActionJournalFilePath: cfg.ActionJournalFilePath.MustValue(),
+		OutboxDir:             cfg.OutboxDir.MustValue(),
+		OutboxMaxRecords:      cfg.OutboxMaxRecords.MustValue(),
+		OutboxMaxBytes:        cfg.OutboxMaxBytes.MustValue(),
+		AccessMaxDuration:     cfg.AccessMaxDuration.MustValue(),
+		AccessRequestTTL:      cfg.AccessRequestTTL.MustValue(),
 	}
-
-	log.Println("Agent created, starting heartbeat")
-
-	agent.Start(context.Background())
 }
 
 type Config struct {
 	Name              	*config.ConfigVar[string]
 	BearerToken       	*config.ConfigVar[string]
+	BearerTokenFile     *config.ConfigVar[string]
 	BackendAddr       	*config.ConfigVar[string]
 	HeartbeatInterval 	*config.ConfigVar[time.Duration]
 	PlanInterval      	*config.ConfigVar[time.Duration]
 	Version           	*config.ConfigVar[string]
 	LifecycleIDFilePath *config.ConfigVar[string]
+	LifecycleIDStore    *config.ConfigVar[string]
+	LifecycleIDObject   *config.ConfigVar[string]
+	ReadyTimeout        *config.ConfigVar[time.Duration]
+
+	BackendProxyURL           *config.ConfigVar[string]
+	BackendCAFile             *config.ConfigVar[string]
+	BackendClientCertFile     *config.ConfigVar[string]
+	BackendClientKeyFile      *config.ConfigVar[string]
+	BackendPinnedFingerprints *config.ConfigVar[string]
+
+	BackupJobImage            *config.ConfigVar[string]
+	BackupJobCommand          *config.ConfigVar[string]
+	BackupJobServiceAccount   *config.ConfigVar[string]
+	BackupVolumeSnapshots     *config.ConfigVar[bool]
+	BackupVolumeSnapshotClass *config.ConfigVar[string]
+	BackupTimeout             *config.ConfigVar[time.Duration]
+
+	ChartSigningKey       *config.ConfigVar[string]
+	MaintenanceWindows    *config.ConfigVar[string]
+	ApprovalPolicy        *config.ConfigVar[string]
+	ManagedReleases       *config.ConfigVar[string]
+	ActionJournalFilePath *config.ConfigVar[string]
+	OutboxDir             *config.ConfigVar[string]
+	OutboxMaxRecords      *config.ConfigVar[int]
+	OutboxMaxBytes        *config.ConfigVar[int64]
+
+	RestartPolicy       *config.ConfigVar[string]
+	RestartMaxBackoff   *config.ConfigVar[time.Duration]
+	ShutdownGracePeriod *config.ConfigVar[time.Duration]
+	CrashLoopRestarts   *config.ConfigVar[int]
+	CrashLoopWindow     *config.ConfigVar[time.Duration]
+
+	ShipLogs             *config.ConfigVar[bool]
+	LogRedactionPatterns *config.ConfigVar[string]
+	LogBudgetBytes       *config.ConfigVar[int]
+
+	ControlAddr            *config.ConfigVar[string]
+	ControlAuth            *config.ConfigVar[string]
+	ControlToken           *config.ConfigVar[string]
+	ControlTokenFile       *config.ConfigVar[string]
+	ControlServiceAccounts *config.ConfigVar[string]
+	ControlTokenAudiences  *config.ConfigVar[string]
+	TailscaleAuthKey       *config.ConfigVar[string]
+
+	AccessMaxDuration *config.ConfigVar[time.Duration]
+	AccessRequestTTL  *config.ConfigVar[time.Duration]
+}
+
+// splitList splits a comma-separated config value, ignoring empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
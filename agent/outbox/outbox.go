@@ -0,0 +1,326 @@
+// Package outbox queues records for the backend on disk, so that telemetry collected while the
+// backend is unreachable is delivered, in order, once it is reachable again.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	directoryPermissions = 0755
+	filePermissions      = 0644
+
+	// rejectedDir is the subdirectory records the backend rejected are set aside in.
+	rejectedDir = "rejected"
+)
+
+// ErrRejected is returned, wrapped, by a Drain send function for a record the backend refuses but
+// that mustn't be lost. Drain sets the record aside on disk rather than removing it, and it is
+// queued again the next time the outbox is opened, eg: once the agent restarts after the backend
+// was upgraded to accept it.
+var ErrRejected = errors.New("record rejected")
+
+type Kind string
+
+const (
+	Heartbeat        Kind = "heartbeat"
+	ActionResult     Kind = "action_result"
+	SessionRecording Kind = "session_recording"
+)
+
+// Record is a queued message. Data is opaque to the outbox.
+type Record struct {
+	Seq  uint64
+	Kind Kind
+	Data []byte
+}
+
+type entry struct {
+	seq  uint64
+	kind Kind
+	size int64
+}
+
+// Outbox is a queue of records stored one file per record in a directory, bounded by both the
+// number of records and their total size. When it is full the oldest heartbeat is dropped to make
+// room, then the oldest session recording, so that action results are kept for longest. It is safe
+// for concurrent use, but only one goroutine may Drain it at a time.
+type Outbox struct {
+	dir        string
+	maxRecords int
+	maxBytes   int64
+
+	mu      sync.Mutex
+	entries []entry // oldest first
+	bytes   int64
+	nextSeq uint64
+
+	ready chan struct{}
+}
+
+// Open loads the records queued in dir, creating it if it doesn't exist, and queues again the
+// records that were rejected.
+func Open(dir string, maxRecords int, maxBytes int64) (*Outbox, error) {
+	if maxRecords < 1 {
+		return nil, fmt.Errorf("outbox must hold at least one record, got %d", maxRecords)
+	}
+	if maxBytes < 1 {
+		return nil, fmt.Errorf("outbox must hold at least one byte, got %d", maxBytes)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, rejectedDir), directoryPermissions); err != nil {
+		return nil, fmt.Errorf("failed to create outbox directory: %w", err)
+	}
+
+	if err := requeueRejected(dir); err != nil {
+		return nil, err
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outbox: %w", err)
+	}
+
+	o := &Outbox{
+		dir:        dir,
+		maxRecords: maxRecords,
+		maxBytes:   maxBytes,
+		nextSeq:    1,
+		ready:      make(chan struct{}, 1),
+	}
+
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+
+		e, ok := parseFileName(f.Name())
+		info, err := f.Info()
+		if !ok || err != nil {
+			// Left behind by a crash part way through Push.
+			os.Remove(filepath.Join(dir, f.Name()))
+			continue
+		}
+		e.size = info.Size()
+
+		o.entries = append(o.entries, e)
+		o.bytes += e.size
+	}
+
+	sort.Slice(o.entries, func(i, j int) bool { return o.entries[i].seq < o.entries[j].seq })
+	if n := len(o.entries); n > 0 {
+		o.nextSeq = o.entries[n-1].seq + 1
+		o.signal()
+	}
+
+	// The limits may have been lowered since the records were queued.
+	for o.full() {
+		o.evict()
+	}
+
+	return o, nil
+}
+
+// requeueRejected moves the records set aside as rejected back into the queue. They keep their
+// sequence numbers, so they are sent before the records queued after them.
+func requeueRejected(dir string) error {
+	files, err := os.ReadDir(filepath.Join(dir, rejectedDir))
+	if err != nil {
+		return fmt.Errorf("failed to read rejected outbox records: %w", err)
+	}
+
+	for _, f := range files {
+		if err := os.Rename(filepath.Join(dir, rejectedDir, f.Name()), filepath.Join(dir, f.Name())); err != nil {
+			return fmt.Errorf("failed to queue rejected outbox record again: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Push appends a record, dropping the oldest heartbeats or session recordings if the outbox is
+// full. A record larger than the whole outbox is refused.
+func (o *Outbox) Push(kind Kind, data []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if int64(len(data)) > o.maxBytes {
+		return fmt.Errorf("%s record of %d bytes is larger than the outbox's %d bytes", kind, len(data), o.maxBytes)
+	}
+
+	e := entry{seq: o.nextSeq, kind: kind, size: int64(len(data))}
+
+	tmp := filepath.Join(o.dir, fileName(e)+".tmp")
+	if err := os.WriteFile(tmp, data, filePermissions); err != nil {
+		return fmt.Errorf("failed to write outbox record: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(o.dir, fileName(e))); err != nil {
+		return fmt.Errorf("failed to write outbox record: %w", err)
+	}
+
+	o.nextSeq++
+	o.entries = append(o.entries, e)
+	o.bytes += e.size
+
+	for o.full() {
+		o.evict()
+	}
+
+	o.signal()
+
+	return nil
+}
+
+func (o *Outbox) full() bool {
+	return len(o.entries) > o.maxRecords || o.bytes > o.maxBytes
+}
+
+// evict drops the oldest heartbeat, or if there are none the oldest session recording, or else the
+// oldest record.
+func (o *Outbox) evict() {
+	i := o.oldest(Heartbeat)
+	if i < 0 {
+		i = o.oldest(SessionRecording)
+	}
+	if i < 0 {
+		i = 0
+	}
+
+	e := o.entries[i]
+	if e.kind == Heartbeat {
+		log.Printf("Outbox full, dropping %s record %d", e.kind, e.seq)
+	} else {
+		log.Printf("ERROR: Outbox full, dropping %s record %d (%d bytes)", e.kind, e.seq, e.size)
+	}
+
+	os.Remove(filepath.Join(o.dir, fileName(e)))
+	o.entries = append(o.entries[:i], o.entries[i+1:]...)
+	o.bytes -= e.size
+}
+
+// oldest returns the index of the oldest record of the kind, or -1 if there is none.
+func (o *Outbox) oldest(kind Kind) int {
+	for i, e := range o.entries {
+		if e.kind == kind {
+			return i
+		}
+	}
+	return -1
+}
+
+// Drain sends records oldest first, removing each once send succeeds. A record send rejects with
+// ErrRejected is set aside. Drain stops at the first other error, leaving that record at the head
+// of the outbox, and returns nil once the outbox is empty.
+func (o *Outbox) Drain(ctx context.Context, send func(ctx context.Context, r Record) error) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		o.mu.Lock()
+		if len(o.entries) == 0 {
+			o.mu.Unlock()
+			return nil
+		}
+		head := o.entries[0]
+		o.mu.Unlock()
+
+		data, err := os.ReadFile(filepath.Join(o.dir, fileName(head)))
+		if err == nil {
+			err = send(ctx, Record{Seq: head.seq, Kind: head.kind, Data: data})
+			if errors.Is(err, ErrRejected) {
+				o.setAside(head, err)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		} else if !os.IsNotExist(err) {
+			log.Printf("Dropping unreadable outbox record %d: %v", head.seq, err)
+		}
+
+		o.remove(head)
+	}
+}
+
+func (o *Outbox) remove(e entry) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	os.Remove(filepath.Join(o.dir, fileName(e)))
+	o.forget(e)
+}
+
+// setAside moves a rejected record out of the queue, keeping it on disk.
+func (o *Outbox) setAside(e entry, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	path := filepath.Join(o.dir, rejectedDir, fileName(e))
+	if renameErr := os.Rename(filepath.Join(o.dir, fileName(e)), path); renameErr != nil && !os.IsNotExist(renameErr) {
+		log.Printf("ERROR: Failed to set aside rejected %s record %d, dropping it: %v", e.kind, e.seq, renameErr)
+		os.Remove(filepath.Join(o.dir, fileName(e)))
+	} else {
+		log.Printf("ERROR: The backend rejected %s record %d, keeping it in %s until the agent restarts: %v", e.kind, e.seq, path, err)
+	}
+
+	o.forget(e)
+}
+
+func (o *Outbox) forget(e entry) {
+	// The record may have been evicted while it was being sent.
+	for i := range o.entries {
+		if o.entries[i].seq == e.seq {
+			o.bytes -= o.entries[i].size
+			o.entries = append(o.entries[:i], o.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// Len returns the number of queued records.
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return len(o.entries)
+}
+
+// Ready receives a value when records have been pushed since the last receive.
+func (o *Outbox) Ready() <-chan struct{} {
+	return o.ready
+}
+
+func (o *Outbox) signal() {
+	select {
+	case o.ready <- struct{}{}:
+	default:
+	}
+}
+
+func fileName(e entry) string {
+	return fmt.Sprintf("%020d.%s", e.seq, e.kind)
+}
+
+func parseFileName(name string) (entry, bool) {
+	seq, kind, ok := strings.Cut(name, ".")
+	if !ok || strings.Contains(kind, ".") {
+		return entry{}, false
+	}
+
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return entry{}, false
+	}
+
+	return entry{seq: n, kind: Kind(kind)}, true
+}
@@ -0,0 +1,180 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestDrainInOrder(t *testing.T) {
+	dir := t.TempDir()
+
+	o, err := Open(dir, 10, 1<<20)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, data := range []string{"one", "two", "three"} {
+		if err := o.Push(Heartbeat, []byte(data)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	var sent []string
+	errUnreachable := errors.New("backend unreachable")
+	send := func(_ context.Context, r Record) error {
+		if string(r.Data) == "two" && len(sent) == 1 {
+			return errUnreachable
+		}
+		sent = append(sent, string(r.Data))
+		return nil
+	}
+
+	if err := o.Drain(context.Background(), send); !errors.Is(err, errUnreachable) {
+		t.Fatalf("Expected send error, got %v", err)
+	}
+	if o.Len() != 2 {
+		t.Errorf("Expected 2 records left after failed send, got %d", o.Len())
+	}
+
+	// Records survive a restart.
+	o, err = Open(dir, 10, 1<<20)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := o.Push(ActionResult, []byte("four")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	sent = append(sent, "restart")
+	if err := o.Drain(context.Background(), send); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{"one", "restart", "two", "three", "four"}
+	if !reflect.DeepEqual(sent, expected) {
+		t.Errorf("Expected %v, got %v", expected, sent)
+	}
+	if o.Len() != 0 {
+		t.Errorf("Expected empty outbox, got %d records", o.Len())
+	}
+}
+
+func TestPushEvictsHeartbeatsFirst(t *testing.T) {
+	o, err := Open(t.TempDir(), 3, 1<<20)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, r := range []Record{
+		{Kind: ActionResult, Data: []byte("result-1")},
+		{Kind: Heartbeat, Data: []byte("heartbeat-1")},
+		{Kind: Heartbeat, Data: []byte("heartbeat-2")},
+		{Kind: ActionResult, Data: []byte("result-2")},
+	} {
+		if err := o.Push(r.Kind, r.Data); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	var sent []string
+	err = o.Drain(context.Background(), func(_ context.Context, r Record) error {
+		sent = append(sent, string(r.Data))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{"result-1", "heartbeat-2", "result-2"}
+	if !reflect.DeepEqual(sent, expected) {
+		t.Errorf("Expected %v, got %v", expected, sent)
+	}
+}
+
+func TestPushEvictsOverByteBudget(t *testing.T) {
+	o, err := Open(t.TempDir(), 10, 20)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, r := range []Record{
+		{Kind: ActionResult, Data: []byte("result-1")},
+		{Kind: SessionRecording, Data: []byte("recording-1")},
+		{Kind: ActionResult, Data: []byte("result-2")},
+	} {
+		if err := o.Push(r.Kind, r.Data); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if err := o.Push(SessionRecording, make([]byte, 21)); err == nil {
+		t.Error("Expected a record larger than the outbox to be refused")
+	}
+
+	var sent []string
+	err = o.Drain(context.Background(), func(_ context.Context, r Record) error {
+		sent = append(sent, string(r.Data))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{"result-1", "result-2"}
+	if !reflect.DeepEqual(sent, expected) {
+		t.Errorf("Expected %v, got %v", expected, sent)
+	}
+}
+
+func TestDrainSetsAsideRejected(t *testing.T) {
+	dir := t.TempDir()
+
+	o, err := Open(dir, 10, 1<<20)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, r := range []Record{
+		{Kind: SessionRecording, Data: []byte("recording")},
+		{Kind: ActionResult, Data: []byte("result")},
+	} {
+		if err := o.Push(r.Kind, r.Data); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	var sent []string
+	rejecting := func(_ context.Context, r Record) error {
+		if r.Kind == SessionRecording {
+			return fmt.Errorf("%w: unimplemented", ErrRejected)
+		}
+		sent = append(sent, string(r.Data))
+		return nil
+	}
+	if err := o.Drain(context.Background(), rejecting); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(sent, []string{"result"}) || o.Len() != 0 {
+		t.Errorf("Expected the rejected record not to block the queue, sent %v with %d left", sent, o.Len())
+	}
+
+	// The rejected record is queued again once the outbox is reopened.
+	o, err = Open(dir, 10, 1<<20)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sent = nil
+	err = o.Drain(context.Background(), func(_ context.Context, r Record) error {
+		sent = append(sent, string(r.Data))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(sent, []string{"recording"}) {
+		t.Errorf("Expected the rejected record to be sent again, got %v", sent)
+	}
+}
@@ -12,11 +12,17 @@ func Run(ctx context.Context, fn func() error, interval time.Duration) error {
 }
 
 func RunWithJitter(ctx context.Context, fn func() error, interval time.Duration, jitter time.Duration) error {
+	return RunWithJitterFunc(ctx, fn, func() time.Duration { return interval }, jitter)
+}
+
+// RunWithJitterFunc is RunWithJitter with an interval that may change between runs. A new interval
+// takes effect from the next run.
+func RunWithJitterFunc(ctx context.Context, fn func() error, interval func() time.Duration, jitter time.Duration) error {
 	if err := fn(); err != nil {
 		return err
 	}
 
-	tick := time.After(interval)
+	tick := time.After(interval())
 
 	for {
 		select {
@@ -28,7 +34,7 @@ func RunWithJitter(ctx context.Context, fn func() error, interval time.Duration,
 			}
 
 			jitter := time.Duration(rand.Intn(int(jitter))) * time.Duration(rand.Intn(2)-1)
-			tick = time.After(interval + jitter)
+			tick = time.After(interval() + jitter)
 		}
 	}
 }
@@ -0,0 +1,83 @@
+package policy
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	releaseLabel = "app.kubernetes.io/instance"
+
+	// PendingAnnotation holds the id of the action awaiting approval.
+	PendingAnnotation = "shepherd.trustshepherd.com/pending-action"
+
+	// ApprovedAnnotation is set by an operator to the id of the action they approve.
+	ApprovedAnnotation = "shepherd.trustshepherd.com/approved-action"
+)
+
+// AnnotationApprover approves actions through annotations on a ConfigMap next to the release they
+// target. The agent records the pending action on the ConfigMap, and an operator approves it with:
+//
+//	kubectl annotate -n <namespace> configmap <release>-shepherd-approval shepherd.trustshepherd.com/approved-action=<action id>
+//
+// Each release has its own ConfigMap, and the agent holds at most one action per release, so the
+// pending action only changes when a newer action supersedes it.
+type AnnotationApprover struct {
+	client      kubernetes.Interface
+	releaseName string
+	namespace   string
+}
+
+func NewAnnotationApprover(client kubernetes.Interface, releaseName, namespace string) *AnnotationApprover {
+	return &AnnotationApprover{
+		client:      client,
+		releaseName: releaseName,
+		namespace:   namespace,
+	}
+}
+
+// Approved reports whether actionID has been approved, recording it as pending if it hasn't. The
+// ConfigMap is only updated when the pending action changes.
+func (a *AnnotationApprover) Approved(ctx context.Context, actionID string) (bool, error) {
+	configMaps := a.client.CoreV1().ConfigMaps(a.namespace)
+
+	cm, err := configMaps.Get(ctx, a.configMapName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = configMaps.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        a.configMapName(),
+				Namespace:   a.namespace,
+				Labels:      map[string]string{releaseLabel: a.releaseName},
+				Annotations: map[string]string{PendingAnnotation: actionID},
+			},
+		}, metav1.CreateOptions{})
+		return false, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if cm.Annotations[ApprovedAnnotation] == actionID {
+		return true, nil
+	}
+
+	if cm.Annotations[PendingAnnotation] == actionID {
+		return false, nil
+	}
+
+	if cm.Annotations == nil {
+		cm.Annotations = map[string]string{}
+	}
+	cm.Annotations[PendingAnnotation] = actionID
+
+	_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+	return false, err
+}
+
+func (a *AnnotationApprover) configMapName() string {
+	return a.releaseName + "-shepherd-approval"
+}
@@ -0,0 +1,111 @@
+// Package policy decides when the agent may apply an upgrade, based on maintenance windows and an
+// approval policy configured in the cluster, and which releases it may upgrade.
+package policy
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Approval is how upgrades are approved.
+type Approval string
+
+const (
+	// ApprovalAuto applies upgrades without approval.
+	ApprovalAuto Approval = "auto"
+
+	// ApprovalAnnotation holds upgrades until they are approved with an annotation in the cluster.
+	ApprovalAnnotation Approval = "annotation"
+
+	// ApprovalNever holds upgrades indefinitely.
+	ApprovalNever Approval = "never"
+)
+
+func ParseApproval(s string) (Approval, error) {
+	switch a := Approval(s); a {
+	case ApprovalAuto, ApprovalAnnotation, ApprovalNever:
+		return a, nil
+	case "":
+		return ApprovalAuto, nil
+	}
+	return "", fmt.Errorf("unknown approval policy %q, expected one of %q, %q or %q", s, ApprovalAuto, ApprovalAnnotation, ApprovalNever)
+}
+
+// Approver reports whether an action has been approved.
+type Approver interface {
+	Approved(ctx context.Context, actionID string) (bool, error)
+}
+
+// Policy holds upgrades until they are approved and inside a maintenance window.
+type Policy struct {
+	// Windows are the maintenance windows upgrades may run in. Upgrades may run at any time if empty.
+	Windows []Window
+
+	Approval Approval
+
+	// Releases are the releases actions may target, see Manages.
+	Releases []Release
+}
+
+// Decision is the outcome of checking an action against the Policy.
+type Decision struct {
+	Allowed bool
+
+	// Reason explains why the action is held. Empty if it is allowed.
+	Reason string
+
+	// NextWindow is when the next maintenance window opens, if the action is waiting for one.
+	NextWindow time.Time
+}
+
+// Check decides whether the action may be applied at now. approver is only consulted under
+// ApprovalAnnotation.
+func (p Policy) Check(ctx context.Context, now time.Time, approver Approver, actionID string) (Decision, error) {
+	switch p.Approval {
+	case ApprovalNever:
+		return Decision{Reason: "upgrades are disabled by the approval policy"}, nil
+	case ApprovalAnnotation:
+		approved, err := approver.Approved(ctx, actionID)
+		if err != nil {
+			return Decision{}, fmt.Errorf("failed to check approval: %w", err)
+		}
+		if !approved {
+			return Decision{Reason: "awaiting approval"}, nil
+		}
+	}
+
+	if p.InWindow(now) {
+		return Decision{Allowed: true}, nil
+	}
+
+	return Decision{
+		Reason:     "outside maintenance window",
+		NextWindow: p.NextWindow(now),
+	}, nil
+}
+
+// InWindow reports whether now falls inside any maintenance window.
+func (p Policy) InWindow(now time.Time) bool {
+	if len(p.Windows) == 0 {
+		return true
+	}
+
+	for _, w := range p.Windows {
+		if w.Contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextWindow returns when the earliest maintenance window after now opens.
+func (p Policy) NextWindow(now time.Time) time.Time {
+	var next time.Time
+	for _, w := range p.Windows {
+		if t := w.Next(now); next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+	return next
+}
@@ -0,0 +1,221 @@
+package policy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// 2024-06-01 is a Saturday.
+var saturday = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+func TestParseWindows(t *testing.T) {
+	windows, err := ParseWindows("Sat 02:00–04:00 UTC; Mon-Fri 22:00-01:00 Europe/London; daily 12:00-12:30")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(windows) != 3 {
+		t.Fatalf("Expected 3 windows, got %d", len(windows))
+	}
+
+	if !windows[0].Days[time.Saturday] || windows[0].Days[time.Sunday] {
+		t.Errorf("Expected only Saturday, got %v", windows[0].Days)
+	}
+	if windows[0].Start != 2*time.Hour || windows[0].End != 4*time.Hour {
+		t.Errorf("Expected 02:00-04:00, got %v-%v", windows[0].Start, windows[0].End)
+	}
+	if windows[1].Location.String() != "Europe/London" {
+		t.Errorf("Expected Europe/London, got %v", windows[1].Location)
+	}
+	if windows[1].Days[time.Saturday] || !windows[1].Days[time.Wednesday] {
+		t.Errorf("Expected Monday to Friday, got %v", windows[1].Days)
+	}
+
+	for _, invalid := range []string{"Sat", "Someday 02:00-04:00", "Sat 2am-4am", "Sat 02:00-02:00", "Sat 02:00-04:00 Nowhere/Land"} {
+		if _, err := ParseWindows(invalid); err == nil {
+			t.Errorf("Expected error parsing %q", invalid)
+		}
+	}
+}
+
+func TestWindowContains(t *testing.T) {
+	windows, err := ParseWindows("Sat 02:00-04:00; Fri 23:00-01:00")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	p := Policy{Windows: windows}
+
+	tests := []struct {
+		at       time.Time
+		expected bool
+	}{
+		{saturday.Add(3 * time.Hour), true},
+		{saturday.Add(4 * time.Hour), false},
+		{saturday.Add(30 * time.Minute), true},                   // Friday's window past midnight
+		{saturday.Add(-30 * time.Minute), true},                  // Friday 23:30
+		{saturday.Add(24*time.Hour + 30*time.Minute), false},     // Sunday 00:30
+		{saturday.AddDate(0, 0, 7).Add(150 * time.Minute), true}, // the following Saturday
+	}
+
+	for _, tt := range tests {
+		if got := p.InWindow(tt.at); got != tt.expected {
+			t.Errorf("InWindow(%v) = %v, expected %v", tt.at, got, tt.expected)
+		}
+	}
+
+	if next := p.NextWindow(saturday.Add(5 * time.Hour)); !next.Equal(saturday.AddDate(0, 0, 6).Add(23 * time.Hour)) {
+		t.Errorf("Expected next window to open Friday 23:00, got %v", next)
+	}
+}
+
+type staticApprover bool
+
+func (a staticApprover) Approved(context.Context, string) (bool, error) {
+	return bool(a), nil
+}
+
+func TestCheck(t *testing.T) {
+	windows, err := ParseWindows("Sat 02:00-04:00")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	inWindow, outsideWindow := saturday.Add(3*time.Hour), saturday.Add(5*time.Hour)
+
+	tests := []struct {
+		name     string
+		policy   Policy
+		at       time.Time
+		approver Approver
+		allowed  bool
+	}{
+		{"auto without windows", Policy{Approval: ApprovalAuto}, outsideWindow, nil, true},
+		{"auto in window", Policy{Windows: windows, Approval: ApprovalAuto}, inWindow, nil, true},
+		{"auto outside window", Policy{Windows: windows, Approval: ApprovalAuto}, outsideWindow, nil, false},
+		{"never", Policy{Approval: ApprovalNever}, inWindow, nil, false},
+		{"annotation approved", Policy{Approval: ApprovalAnnotation}, inWindow, staticApprover(true), true},
+		{"annotation not approved", Policy{Approval: ApprovalAnnotation}, inWindow, staticApprover(false), false},
+		{"annotation approved outside window", Policy{Windows: windows, Approval: ApprovalAnnotation}, outsideWindow, staticApprover(true), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := tt.policy.Check(context.Background(), tt.at, tt.approver, "action-1")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if decision.Allowed != tt.allowed {
+				t.Errorf("Expected allowed=%v, got %+v", tt.allowed, decision)
+			}
+			if !decision.Allowed && decision.Reason == "" {
+				t.Error("Expected a reason for holding the action")
+			}
+		})
+	}
+}
+
+func TestAnnotationApprover(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewClientset()
+	approver := NewAnnotationApprover(client, "my-release", "default")
+
+	approved, err := approver.Approved(ctx, "action-1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if approved {
+		t.Fatal("Expected action to await approval")
+	}
+
+	configMaps := client.CoreV1().ConfigMaps("default")
+	cm, err := configMaps.Get(ctx, "my-release-shepherd-approval", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cm.Annotations[PendingAnnotation] != "action-1" {
+		t.Errorf("Expected action-1 to be pending, got %v", cm.Annotations)
+	}
+
+	cm.Annotations[ApprovedAnnotation] = "action-1"
+	if _, err := configMaps.Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if approved, err := approver.Approved(ctx, "action-1"); err != nil || !approved {
+		t.Errorf("Expected action-1 to be approved, got %v, %v", approved, err)
+	}
+	if approved, err := approver.Approved(ctx, "action-2"); err != nil || approved {
+		t.Errorf("Expected action-2 to await approval, got %v, %v", approved, err)
+	}
+}
+
+func TestAnnotationApproverPerRelease(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewClientset()
+	web := NewAnnotationApprover(client, "web", "default")
+	worker := NewAnnotationApprover(client, "worker", "default")
+
+	// Checking held actions for two releases repeatedly records each once, on its own ConfigMap.
+	for range 3 {
+		if _, err := web.Approved(ctx, "action-1"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := worker.Approved(ctx, "action-2"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "update" {
+			t.Errorf("Expected the ConfigMaps not to be updated, got %v", action)
+		}
+	}
+
+	for name, pending := range map[string]string{"web-shepherd-approval": "action-1", "worker-shepherd-approval": "action-2"} {
+		cm, err := client.CoreV1().ConfigMaps("default").Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if cm.Annotations[PendingAnnotation] != pending {
+			t.Errorf("Expected %s to be pending on %s, got %v", pending, name, cm.Annotations)
+		}
+	}
+}
+
+func TestParseReleases(t *testing.T) {
+	releases, err := ParseReleases("staging/app, production/*,")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(releases) != 2 || releases[0] != (Release{"staging", "app"}) || releases[1] != (Release{"production", "*"}) {
+		t.Errorf("Unexpected releases %v", releases)
+	}
+
+	for _, invalid := range []string{"app", "/app", "staging/", "staging/app/web"} {
+		if _, err := ParseReleases(invalid); err == nil {
+			t.Errorf("Expected error parsing %q", invalid)
+		}
+	}
+}
+
+func TestManages(t *testing.T) {
+	p := Policy{Releases: []Release{{"staging", "app"}, {"production", "*"}}}
+
+	tests := []struct {
+		namespace, name string
+		want            bool
+	}{
+		{"staging", "app", true},
+		{"staging", "db", false},
+		{"production", "db", true},
+		{"default", "app", false},
+	}
+	for _, tt := range tests {
+		if got := p.Manages(tt.namespace, tt.name); got != tt.want {
+			t.Errorf("Manages(%q, %q) = %v, expected %v", tt.namespace, tt.name, got, tt.want)
+		}
+	}
+}
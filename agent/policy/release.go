@@ -0,0 +1,50 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Release names a Helm release actions may target. A Name of "*" stands for every release in the
+// namespace.
+type Release struct {
+	Namespace string
+	Name      string
+}
+
+func (r Release) String() string {
+	return r.Namespace + "/" + r.Name
+}
+
+// Matches reports whether r is the release, or a wildcard for its namespace.
+func (r Release) Matches(namespace, name string) bool {
+	return r.Namespace == namespace && (r.Name == "*" || r.Name == name)
+}
+
+// ParseReleases parses a comma-separated list of releases such as "staging/app, production/*".
+func ParseReleases(s string) ([]Release, error) {
+	var releases []Release
+	for _, spec := range strings.Split(s, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		namespace, name, ok := strings.Cut(spec, "/")
+		if !ok || namespace == "" || name == "" || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("invalid release %q, expected namespace/name or namespace/*", spec)
+		}
+		releases = append(releases, Release{Namespace: namespace, Name: name})
+	}
+	return releases, nil
+}
+
+// Manages reports whether actions may target the release.
+func (p Policy) Manages(namespace, name string) bool {
+	for _, r := range p.Releases {
+		if r.Matches(namespace, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	// Maintenance windows name their time zone, and the agent image doesn't ship a zoneinfo database.
+	_ "time/tzdata"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Window is a recurring weekly maintenance window. A window whose end is before its start runs
+// past midnight into the following day.
+type Window struct {
+	Days     [7]bool
+	Start    time.Duration // since midnight
+	End      time.Duration // since midnight
+	Location *time.Location
+}
+
+// ParseWindows parses a semicolon-separated list of windows such as
+// "Sat 02:00-04:00 UTC; Mon-Fri 22:00-23:00 Europe/London". Days may be a single day, a range of
+// days or "daily", and the time zone defaults to UTC.
+func ParseWindows(s string) ([]Window, error) {
+	var windows []Window
+	for _, spec := range strings.Split(s, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		w, err := parseWindow(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maintenance window %q: %w", spec, err)
+		}
+		windows = append(windows, w)
+	}
+
+	return windows, nil
+}
+
+func parseWindow(spec string) (Window, error) {
+	fields := strings.Fields(spec)
+	if len(fields) < 2 || len(fields) > 3 {
+		return Window{}, fmt.Errorf("expected \"<days> <start>-<end> [time zone]\"")
+	}
+
+	var w Window
+	days, err := parseDays(fields[0])
+	if err != nil {
+		return Window{}, err
+	}
+	w.Days = days
+
+	start, end, ok := strings.Cut(strings.ReplaceAll(fields[1], "–", "-"), "-")
+	if !ok {
+		return Window{}, fmt.Errorf("expected a time range, got %q", fields[1])
+	}
+	if w.Start, err = parseTimeOfDay(start); err != nil {
+		return Window{}, err
+	}
+	if w.End, err = parseTimeOfDay(end); err != nil {
+		return Window{}, err
+	}
+	if w.Start == w.End {
+		return Window{}, fmt.Errorf("window is empty")
+	}
+
+	w.Location = time.UTC
+	if len(fields) == 3 {
+		if w.Location, err = time.LoadLocation(fields[2]); err != nil {
+			return Window{}, err
+		}
+	}
+
+	return w, nil
+}
+
+func parseDays(s string) ([7]bool, error) {
+	var days [7]bool
+	if strings.EqualFold(s, "daily") {
+		for i := range days {
+			days[i] = true
+		}
+		return days, nil
+	}
+
+	from, to, isRange := strings.Cut(s, "-")
+	first, ok := weekdays[strings.ToLower(from)]
+	if !ok {
+		return days, fmt.Errorf("unknown day %q", from)
+	}
+
+	last := first
+	if isRange {
+		if last, ok = weekdays[strings.ToLower(to)]; !ok {
+			return days, fmt.Errorf("unknown day %q", to)
+		}
+	}
+
+	for d := first; ; d = (d + 1) % 7 {
+		days[d] = true
+		if d == last {
+			break
+		}
+	}
+
+	return days, nil
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains reports whether t falls inside the window.
+func (w Window) Contains(t time.Time) bool {
+	t = t.In(w.Location)
+	sinceMidnight := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+
+	if w.Start < w.End {
+		return w.Days[t.Weekday()] && sinceMidnight >= w.Start && sinceMidnight < w.End
+	}
+
+	// The window runs past midnight, so t is either in its first day or the morning after.
+	yesterday := (t.Weekday() + 6) % 7
+	return (w.Days[t.Weekday()] && sinceMidnight >= w.Start) || (w.Days[yesterday] && sinceMidnight < w.End)
+}
+
+// Next returns the next time the window opens after t.
+func (w Window) Next(t time.Time) time.Time {
+	t = t.In(w.Location)
+	hour, minute := int(w.Start/time.Hour), int(w.Start%time.Hour/time.Minute)
+	for i := 0; i <= 7; i++ {
+		start := time.Date(t.Year(), t.Month(), t.Day()+i, hour, minute, 0, 0, w.Location)
+		if w.Days[start.Weekday()] && start.After(t) {
+			return start
+		}
+	}
+	return time.Time{}
+}
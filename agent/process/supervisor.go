@@ -0,0 +1,428 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"agent/circular"
+)
+
+type RestartPolicy string
+
+const (
+	RestartAlways    RestartPolicy = "always"
+	RestartOnFailure RestartPolicy = "on-failure"
+	RestartNever     RestartPolicy = "never"
+)
+
+func ParseRestartPolicy(s string) (RestartPolicy, error) {
+	switch p := RestartPolicy(s); p {
+	case RestartAlways, RestartOnFailure, RestartNever:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown restart policy %q, expected always, on-failure or never", s)
+}
+
+type State string
+
+const (
+	StateStarting State = "starting"
+	StateRunning  State = "running"
+	// StateBackoff is waiting to restart the process after it exited.
+	StateBackoff State = "backoff"
+	// StateExited is not restarting the process, because of the restart policy or because the
+	// supervisor was stopped.
+	StateExited State = "exited"
+)
+
+const (
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = 5 * time.Minute
+	defaultStableAfter    = time.Minute
+	defaultGracePeriod    = 30 * time.Second
+	defaultHistorySize    = 20
+
+	logLines         = 1024
+	maxLogLineLength = 16 << 10
+)
+
+type SupervisorConfig struct {
+	Command string
+	Args    []string
+
+	RestartPolicy RestartPolicy
+
+	// InitialBackoff is the delay before the first restart, doubling with each restart after a run
+	// shorter than StableAfter up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	StableAfter    time.Duration
+
+	// GracePeriod is how long the process has to exit after SIGTERM before it is killed.
+	GracePeriod time.Duration
+
+	// The process is crash looping once it has failed CrashLoopRestarts times within
+	// CrashLoopWindow. Crash loops are not detected if CrashLoopRestarts is 0.
+	CrashLoopRestarts int
+	CrashLoopWindow   time.Duration
+
+	// HistorySize is how many exits are kept.
+	HistorySize int
+
+	// Stdout and Stderr, if set, also receive the process's output, eg: to ship it elsewhere.
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Exit records how a run of the process ended.
+type Exit struct {
+	StartedAt time.Time
+	ExitedAt  time.Time
+
+	// ExitCode is -1 if the process was killed by a signal or could not be started.
+	ExitCode int
+
+	// Signal is the signal that killed the process, eg: "killed". Empty if it exited by itself.
+	Signal string
+
+	// Error is set if the process could not be started.
+	Error string
+
+	// Requested is set if the process was stopped by Restart. Requested exits aren't failures of
+	// the process, so they don't count towards a crash loop.
+	Requested bool
+}
+
+func (e Exit) Failed() bool {
+	return e.ExitCode != 0
+}
+
+func (e Exit) String() string {
+	switch {
+	case e.Error != "":
+		return e.Error
+	case e.Signal != "":
+		return "signal: " + e.Signal
+	default:
+		return fmt.Sprintf("exit code %d", e.ExitCode)
+	}
+}
+
+type Status struct {
+	State State
+
+	// PID and StartedAt describe the current run. PID is 0 if the process is not running.
+	PID       int
+	StartedAt time.Time
+
+	Restarts     int
+	CrashLooping bool
+
+	// NextStart is when the process will be restarted while in StateBackoff.
+	NextStart time.Time
+
+	// Exits are the most recent exits, oldest first.
+	Exits []Exit
+}
+
+// Supervisor runs a command and restarts it according to its restart policy.
+type Supervisor struct {
+	cfg SupervisorConfig
+
+	logs *circular.Buffer
+
+	mu       sync.Mutex
+	cmd      *exec.Cmd
+	stop     context.CancelFunc // stops the current run
+	status   Status
+	failures int // consecutive runs shorter than cfg.StableAfter
+
+	// restartRequested is set when the current run is stopped by Restart, and restart wakes Run from
+	// its backoff.
+	restartRequested bool
+	restart          chan struct{}
+}
+
+func NewSupervisor(cfg SupervisorConfig) *Supervisor {
+	if cfg.RestartPolicy == "" {
+		cfg.RestartPolicy = RestartAlways
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = defaultInitialBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaultMaxBackoff
+	}
+	if cfg.StableAfter <= 0 {
+		cfg.StableAfter = defaultStableAfter
+	}
+	if cfg.GracePeriod <= 0 {
+		cfg.GracePeriod = defaultGracePeriod
+	}
+	if cfg.HistorySize <= 0 {
+		cfg.HistorySize = defaultHistorySize
+	}
+
+	return &Supervisor{
+		cfg:     cfg,
+		logs:    circular.NewBuffer(logLines, circular.WithMaxLineLength(maxLogLineLength)),
+		status:  Status{State: StateStarting},
+		restart: make(chan struct{}, 1),
+	}
+}
+
+func (s *Supervisor) Args() []string {
+	return append([]string{s.cfg.Command}, s.cfg.Args...)
+}
+
+// RecentLogs returns the last n lines the process wrote to stdout or stderr, oldest first.
+func (s *Supervisor) RecentLogs(n int) []circular.Line {
+	return s.logs.Lines(n)
+}
+
+// Logs returns the buffer holding the process's recent output, tagged by stream.
+func (s *Supervisor) Logs() *circular.Buffer {
+	return s.logs
+}
+
+// Run runs the process until the restart policy stops restarting it or ctx is done. When ctx is
+// done the process is sent SIGTERM, and killed if it hasn't exited after the grace period.
+func (s *Supervisor) Run(ctx context.Context) error {
+	for {
+		exit := s.runOnce(ctx)
+		if ctx.Err() != nil {
+			s.setState(StateExited)
+			return ctx.Err()
+		}
+
+		delay, restart := s.recordExit(exit)
+		if !restart {
+			log.Printf("Process exited (%s), not restarting with restart policy %s", exit, s.cfg.RestartPolicy)
+			return nil
+		}
+
+		if delay == 0 {
+			log.Printf("Process exited (%s), restarting as requested", exit)
+			continue
+		}
+		log.Printf("Process exited (%s), restarting in %s", exit, delay)
+
+		select {
+		case <-ctx.Done():
+			s.setState(StateExited)
+			return ctx.Err()
+		case <-time.After(delay):
+		case <-s.restart:
+		}
+	}
+}
+
+func (s *Supervisor) runOnce(ctx context.Context) Exit {
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	cmd := exec.CommandContext(ctx, s.cfg.Command, s.cfg.Args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = io.MultiWriter(outputs(os.Stdout, s.logs.Writer(circular.Stdout), s.cfg.Stdout)...)
+	cmd.Stderr = io.MultiWriter(outputs(os.Stderr, s.logs.Writer(circular.Stderr), s.cfg.Stderr)...)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	// Once cancelled, the process is killed if it hasn't exited after the grace period.
+	cmd.WaitDelay = s.cfg.GracePeriod
+
+	startedAt := time.Now()
+	if err := cmd.Start(); err != nil {
+		return Exit{StartedAt: startedAt, ExitedAt: time.Now(), ExitCode: -1, Error: err.Error()}
+	}
+
+	s.mu.Lock()
+	s.cmd, s.stop = cmd, stop
+	// A restart requested while the process was starting is satisfied by this run.
+	select {
+	case <-s.restart:
+	default:
+	}
+	s.status.State = StateRunning
+	s.status.PID = cmd.Process.Pid
+	s.status.StartedAt = startedAt
+	s.mu.Unlock()
+
+	err := cmd.Wait()
+
+	s.mu.Lock()
+	s.cmd, s.stop = nil, nil
+	s.status.PID = 0
+	s.mu.Unlock()
+
+	exit := Exit{StartedAt: startedAt, ExitedAt: time.Now(), ExitCode: cmd.ProcessState.ExitCode()}
+	if ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		exit.Signal = ws.Signal().String()
+	}
+	if exit.ExitCode == -1 && exit.Signal == "" && err != nil {
+		exit.Error = err.Error()
+	}
+
+	return exit
+}
+
+func outputs(writers ...io.Writer) []io.Writer {
+	var out []io.Writer
+	for _, w := range writers {
+		if w != nil {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// recordExit adds exit to the history and returns how long to wait before restarting the process,
+// or false if it shouldn't be restarted.
+func (s *Supervisor) recordExit(exit Exit) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exit.Requested = s.restartRequested
+	s.status.Exits = append(s.status.Exits, exit)
+	if len(s.status.Exits) > s.cfg.HistorySize {
+		s.status.Exits = s.status.Exits[len(s.status.Exits)-s.cfg.HistorySize:]
+	}
+
+	if s.restartRequested {
+		s.restartRequested = false
+		s.failures = 0
+		s.status.Restarts++
+		s.status.State = StateStarting
+		return 0, true
+	}
+
+	wasCrashLooping := s.status.CrashLooping
+	s.status.CrashLooping = s.crashLooping(exit.ExitedAt)
+	if s.status.CrashLooping && !wasCrashLooping {
+		log.Printf("Process is crash looping: %d failures within %s", s.cfg.CrashLoopRestarts, s.cfg.CrashLoopWindow)
+	}
+
+	restart := s.cfg.RestartPolicy == RestartAlways || (s.cfg.RestartPolicy == RestartOnFailure && exit.Failed())
+	if !restart {
+		s.status.State = StateExited
+		return 0, false
+	}
+
+	if exit.ExitedAt.Sub(exit.StartedAt) >= s.cfg.StableAfter {
+		s.failures = 0
+	}
+	delay := s.cfg.InitialBackoff << min(s.failures, 30)
+	if delay <= 0 || delay > s.cfg.MaxBackoff {
+		delay = s.cfg.MaxBackoff
+	}
+	s.failures++
+
+	s.status.Restarts++
+	s.status.State = StateBackoff
+	s.status.NextStart = exit.ExitedAt.Add(delay)
+
+	return delay, true
+}
+
+// crashLooping reports whether the process failed CrashLoopRestarts times within the window
+// before now.
+func (s *Supervisor) crashLooping(now time.Time) bool {
+	if s.cfg.CrashLoopRestarts <= 0 {
+		return false
+	}
+
+	failures := 0
+	for _, e := range s.status.Exits {
+		if e.Failed() && !e.Requested && now.Sub(e.ExitedAt) <= s.cfg.CrashLoopWindow {
+			failures++
+		}
+	}
+	return failures >= s.cfg.CrashLoopRestarts
+}
+
+func (s *Supervisor) setState(state State) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.State = state
+}
+
+// Status returns a snapshot of the process's state. A crash loop ends once the process has run for
+// StableAfter.
+func (s *Supervisor) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.status.CrashLooping && s.status.State == StateRunning && time.Since(s.status.StartedAt) >= s.cfg.StableAfter {
+		s.status.CrashLooping = false
+	}
+
+	status := s.status
+	status.Exits = append([]Exit(nil), s.status.Exits...)
+	return status
+}
+
+var (
+	ErrNotRunning = errors.New("process is not running")
+	ErrStopped    = errors.New("supervisor has stopped")
+)
+
+// Restart stops the process, giving it the grace period to exit, and starts it again straight away
+// whatever the restart policy. A process waiting to be restarted is started without waiting for
+// the rest of its backoff.
+func (s *Supervisor) Restart() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case s.status.State == StateExited:
+		return ErrStopped
+	case s.stop != nil:
+		s.restartRequested = true
+		s.stop()
+	default:
+		select {
+		case s.restart <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Signal sends sig to the process.
+func (s *Supervisor) Signal(sig os.Signal) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cmd == nil || s.cmd.Process == nil {
+		return ErrNotRunning
+	}
+	return s.cmd.Process.Signal(sig)
+}
+
+// ForwardSignals sends the given signals to the process when the agent receives them, until ctx
+// is done.
+func (s *Supervisor) ForwardSignals(ctx context.Context, sigs ...os.Signal) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sigs...)
+	defer signal.Stop(c)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-c:
+			if err := s.Signal(sig); err != nil {
+				log.Printf("Failed to forward %s: %v", sig, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package process
+
+import (
+	"context"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSupervisorRestartPolicy(t *testing.T) {
+	counter := filepath.Join(t.TempDir(), "runs")
+	// Fails on the first two runs, then succeeds.
+	script := `n=$(cat ` + counter + ` 2>/dev/null || echo 0); echo $((n+1)) > ` + counter + `; [ "$n" -ge 2 ] || exit 3`
+
+	tests := []struct {
+		name         string
+		policy       RestartPolicy
+		command      string
+		wantExits    int
+		wantRestarts int
+	}{
+		{"never", RestartNever, "exit 3", 1, 0},
+		{"on-failure", RestartOnFailure, script, 3, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSupervisor(SupervisorConfig{
+				Command:        "sh",
+				Args:           []string{"-c", tt.command},
+				RestartPolicy:  tt.policy,
+				InitialBackoff: time.Millisecond,
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if err := s.Run(ctx); err != nil {
+				t.Fatalf("Run() returned error: %v", err)
+			}
+
+			status := s.Status()
+			if status.State != StateExited {
+				t.Errorf("Expected state %s, got %s", StateExited, status.State)
+			}
+			if len(status.Exits) != tt.wantExits || status.Restarts != tt.wantRestarts {
+				t.Errorf("Expected %d exits and %d restarts, got %d and %d", tt.wantExits, tt.wantRestarts, len(status.Exits), status.Restarts)
+			}
+			if first := status.Exits[0]; first.ExitCode != 3 || !first.Failed() {
+				t.Errorf("Expected first run to fail with exit code 3, got %v", first)
+			}
+		})
+	}
+}
+
+func TestSupervisorCrashLoop(t *testing.T) {
+	s := NewSupervisor(SupervisorConfig{
+		Command:           "sh",
+		Args:              []string{"-c", "exit 1"},
+		InitialBackoff:    time.Millisecond,
+		MaxBackoff:        5 * time.Millisecond,
+		CrashLoopRestarts: 3,
+		CrashLoopWindow:   time.Minute,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !s.Status().CrashLooping {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected crash loop to be detected, got %+v", s.Status())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+
+	if status := s.Status(); len(status.Exits) < 3 || status.State != StateExited {
+		t.Errorf("Expected at least 3 exits and state %s, got %+v", StateExited, status)
+	}
+}
+
+func TestSupervisorCrashLoopIgnoresRequestedRestarts(t *testing.T) {
+	s := NewSupervisor(SupervisorConfig{
+		Command:           "true",
+		CrashLoopRestarts: 2,
+		CrashLoopWindow:   time.Minute,
+	})
+
+	start := time.Now()
+	terminated := Exit{StartedAt: start, ExitedAt: start.Add(time.Second), ExitCode: -1, Signal: "terminated"}
+
+	for range 3 {
+		s.restartRequested = true
+		s.recordExit(terminated)
+	}
+	if status := s.Status(); status.CrashLooping || !status.Exits[0].Requested {
+		t.Errorf("Expected requested restarts not to count as a crash loop, got %+v", status)
+	}
+
+	s.recordExit(terminated)
+	s.recordExit(terminated)
+	if !s.Status().CrashLooping {
+		t.Error("Expected failures after requested restarts to be detected as a crash loop")
+	}
+}
+
+func TestSupervisorBackoff(t *testing.T) {
+	s := NewSupervisor(SupervisorConfig{
+		Command:        "true",
+		InitialBackoff: time.Second,
+		MaxBackoff:     5 * time.Second,
+		StableAfter:    time.Minute,
+	})
+
+	start := time.Now()
+	short := Exit{StartedAt: start, ExitedAt: start.Add(time.Second), ExitCode: 1}
+	stable := Exit{StartedAt: start, ExitedAt: start.Add(time.Hour), ExitCode: 1}
+
+	var got []time.Duration
+	for _, exit := range []Exit{short, short, short, short, stable} {
+		delay, restart := s.recordExit(exit)
+		if !restart {
+			t.Fatalf("Expected the process to be restarted")
+		}
+		got = append(got, delay)
+	}
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, time.Second}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Expected delays %v, got %v", want, got)
+			break
+		}
+	}
+}
+
+func TestSupervisorStop(t *testing.T) {
+	s := NewSupervisor(SupervisorConfig{
+		Command:     "sh",
+		Args:        []string{"-c", `trap "" TERM; while true; do sleep 0.01; done`},
+		GracePeriod: 100 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	waitRunning(t, s)
+	cancel()
+
+	// The process ignores SIGTERM, so it is killed after the grace period.
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the process to be killed after the grace period")
+	}
+}
+
+func TestSupervisorSignal(t *testing.T) {
+	s := NewSupervisor(SupervisorConfig{
+		Command:       "sh",
+		Args:          []string{"-c", `trap "exit 7" USR1; while true; do sleep 0.01; done`},
+		RestartPolicy: RestartNever,
+	})
+
+	if err := s.Signal(syscall.SIGUSR1); err != ErrNotRunning {
+		t.Errorf("Expected ErrNotRunning before the process started, got %v", err)
+	}
+
+	done := make(chan error)
+	go func() { done <- s.Run(context.Background()) }()
+
+	waitRunning(t, s)
+	// Give the shell time to install its trap.
+	time.Sleep(100 * time.Millisecond)
+
+	if err := s.Signal(syscall.SIGUSR1); err != nil {
+		t.Fatalf("Signal() returned error: %v", err)
+	}
+	<-done
+
+	if exits := s.Status().Exits; len(exits) != 1 || exits[0].ExitCode != 7 {
+		t.Errorf("Expected the process to exit with code 7, got %v", exits)
+	}
+}
+
+func TestSupervisorRestart(t *testing.T) {
+	s := NewSupervisor(SupervisorConfig{
+		Command:       "sh",
+		Args:          []string{"-c", `while true; do sleep 0.01; done`},
+		RestartPolicy: RestartNever,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	waitRunning(t, s)
+	pid := s.Status().PID
+
+	// The process is restarted even though the restart policy is never.
+	if err := s.Restart(); err != nil {
+		t.Fatalf("Restart() returned error: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for status := s.Status(); status.State != StateRunning || status.PID == pid; status = s.Status() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the process to be restarted, got %+v", status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if status := s.Status(); status.Restarts != 1 || len(status.Exits) != 1 {
+		t.Errorf("Expected 1 restart and 1 exit, got %+v", status)
+	}
+
+	cancel()
+	<-done
+
+	if err := s.Restart(); err != ErrStopped {
+		t.Errorf("Expected ErrStopped once the supervisor has stopped, got %v", err)
+	}
+}
+
+func TestParseRestartPolicy(t *testing.T) {
+	for _, s := range []string{"always", "on-failure", "never"} {
+		if _, err := ParseRestartPolicy(s); err != nil {
+			t.Errorf("ParseRestartPolicy(%q) returned error: %v", s, err)
+		}
+	}
+	if _, err := ParseRestartPolicy("sometimes"); err == nil {
+		t.Error("Expected error for unknown restart policy")
+	}
+}
+
+func waitRunning(t *testing.T, s *Supervisor) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Status().State != StateRunning {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the process to start")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
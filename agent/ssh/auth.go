@@ -1,7 +1,29 @@
 package ssh
 
-import "github.com/gliderlabs/ssh"
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"time"
 
+	"github.com/gliderlabs/ssh"
+)
+
+// auth authorizes a key until it expires.
 type auth struct {
-	key ssh.PublicKey
+	key       ssh.PublicKey
+	owner     string
+	expiresAt time.Time
+}
+
+func (a auth) valid(now time.Time) bool {
+	return now.Before(a.expiresAt)
+}
+
+// authContextKey holds the auth a connection authenticated with.
+var authContextKey = &struct{ name string }{"auth"}
+
+// Fingerprint returns the SHA256 fingerprint of key, as printed by ssh-keygen -l.
+func Fingerprint(key ssh.PublicKey) string {
+	sum := sha256.Sum256(key.Marshal())
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
 }
@@ -0,0 +1,63 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func newKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestAuthorizedKeys(t *testing.T) {
+	s := &Server{}
+	alice, bob := newKey(t), newKey(t)
+
+	s.AddKey(alice, "alice", time.Now().Add(time.Hour))
+	s.AddKey(bob, "bob", time.Now().Add(-time.Second))
+
+	if a, ok := s.authorized(alice); !ok || a.owner != "alice" {
+		t.Errorf("Expected alice's key to be authorized, got %+v, %t", a, ok)
+	}
+	if _, ok := s.authorized(bob); ok {
+		t.Error("Expected an expired key not to be authorized")
+	}
+
+	// Authorizing a key again replaces its grant.
+	s.AddKey(alice, "alice@example.com", time.Now().Add(time.Hour))
+	if a, _ := s.authorized(alice); a.owner != "alice@example.com" || len(s.auths) != 1 {
+		t.Errorf("Expected the grant to be replaced, got %+v", s.auths)
+	}
+
+	s.RemoveKey(alice)
+	if _, ok := s.authorized(alice); ok {
+		t.Error("Expected a removed key not to be authorized")
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	key := newKey(t)
+
+	if got, want := Fingerprint(key), gossh.FingerprintSHA256(key); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if !strings.HasPrefix(Fingerprint(key), "SHA256:") {
+		t.Errorf("Expected a SHA256 fingerprint, got %s", Fingerprint(key))
+	}
+}
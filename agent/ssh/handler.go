@@ -1,53 +1,139 @@
 package ssh
 
 import (
-	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
-	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/creack/pty"
+	"github.com/google/uuid"
 
 	gssh "github.com/gliderlabs/ssh"
 )
 
-func handler(session gssh.Session) {
-	io.WriteString(session, "Welcome to the server\n")
+// authCheckInterval is how often a session checks that its key is still authorized.
+const authCheckInterval = time.Second
 
-	if err := configurePty(session); err != nil {
-		io.WriteString(session, fmt.Sprintf("Error: %s\n", err))
+var defaultWindow = gssh.Window{Width: 80, Height: 24}
+
+// handler runs a shell for the session until it exits, the client disconnects, or the session's
+// key expires or is removed. The session's output is recorded and handed to the recording callback.
+func (s *Server) handler(session gssh.Session) {
+	a, ok := session.Context().Value(authContextKey).(auth)
+	if !ok {
+		session.Exit(1)
 		return
 	}
+
+	rec := Recording{
+		SessionID:      uuid.New().String(),
+		Owner:          a.owner,
+		KeyFingerprint: Fingerprint(a.key),
+		RemoteAddr:     session.RemoteAddr().String(),
+		StartedAt:      time.Now(),
+	}
+	log.Printf("SSH session %s opened by %s (%s) from %s", rec.SessionID, rec.Owner, rec.KeyFingerprint, rec.RemoteAddr)
+
+	ptyReq, winCh, _ := session.Pty()
+	if ptyReq.Window.Width == 0 || ptyReq.Window.Height == 0 {
+		ptyReq.Window = defaultWindow
+	}
+
+	recorder := newRecorder(castHeader{
+		Width:  ptyReq.Window.Width,
+		Height: ptyReq.Window.Height,
+		Title:  rec.Owner,
+		Env:    map[string]string{"TERM": ptyReq.Term, "SHELL": "sh"},
+	}, rec.StartedAt)
+	out := io.MultiWriter(session, recorder)
+
+	io.WriteString(out, "Welcome to the server\n")
+
+	code := s.runShell(session, a, out, ptyReq, winCh, recorder)
+
+	rec.EndedAt = time.Now()
+	rec.Cast, rec.Truncated = recorder.cast()
+	log.Printf("SSH session %s closed after %s", rec.SessionID, rec.EndedAt.Sub(rec.StartedAt).Round(time.Second))
+
+	s.mu.RLock()
+	onRecording := s.recording
+	s.mu.RUnlock()
+	if onRecording != nil {
+		onRecording(rec)
+	}
+
+	session.Exit(code)
 }
 
-func configurePty(session gssh.Session) error {
+// runShell runs the shell in a pty and returns its exit code.
+func (s *Server) runShell(session gssh.Session, a auth, out io.Writer, ptyReq gssh.Pty, winCh <-chan gssh.Window, recorder *recorder) int {
 	cmd := exec.Command("sh") // TODO: Use embedded bash instead.
+	if ptyReq.Term != "" {
+		cmd.Env = append(os.Environ(), "TERM="+ptyReq.Term)
+	}
 
-	ptmx, err := pty.Start(cmd)
+	ptmx, err := pty.StartWithSize(cmd, winsize(ptyReq.Window))
 	if err != nil {
-		return err
+		io.WriteString(out, "Error: "+err.Error()+"\n")
+		return 1
 	}
 	defer ptmx.Close()
 
-	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, syscall.SIGWINCH)
 	go func() {
-		for range ch {
-			if err := pty.InheritSize(os.Stdin, ptmx); err != nil {
+		for w := range winCh {
+			if err := pty.Setsize(ptmx, winsize(w)); err != nil {
 				log.Printf("error resizing pty: %s", err)
 			}
+			recorder.resize(w.Width, w.Height)
+		}
+	}()
+
+	// Hang up the shell and everything it started once the session must end.
+	stop := func() {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		ptmx.Close()
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(authCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-session.Context().Done():
+				stop()
+				return
+			case <-ticker.C:
+				if _, ok := s.authorized(a.key); !ok {
+					io.WriteString(out, "\r\nAccess expired, closing the session.\r\n")
+					stop()
+					return
+				}
+			}
 		}
 	}()
-	ch <- syscall.SIGWINCH                        // Initial resize.
-	defer func() { signal.Stop(ch); close(ch) }() // Cleanup signals when done.
 
 	// Copy stdin to the pty and the pty to stdout.
 	// NOTE: The goroutine will keep reading until the next keystroke before returning.
 	go func() { _, _ = io.Copy(ptmx, session) }()
-	_, _ = io.Copy(session, ptmx)
+	_, _ = io.Copy(out, ptmx)
+
+	close(done)
+	ptmx.Close()
+	if err := cmd.Wait(); err != nil && cmd.ProcessState == nil {
+		return 1
+	}
+	if code := cmd.ProcessState.ExitCode(); code >= 0 {
+		return code
+	}
+	return 1
+}
 
-	return nil
+func winsize(w gssh.Window) *pty.Winsize {
+	return &pty.Winsize{Cols: uint16(w.Width), Rows: uint16(w.Height)}
 }
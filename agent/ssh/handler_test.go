@@ -0,0 +1,122 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func newSigner(t *testing.T) gossh.Signer {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := gossh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func TestSession(t *testing.T) {
+	s := NewServer("", "test")
+
+	recordings := make(chan Recording, 1)
+	s.OnRecording(func(r Recording) { recordings <- r })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := s.newSSHServer()
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+
+	authorized, unauthorized := newSigner(t), newSigner(t)
+	s.AddKey(authorized.PublicKey(), "alice@example.com", time.Now().Add(time.Hour))
+
+	dial := func(signer gossh.Signer) (*gossh.Client, error) {
+		return gossh.Dial("tcp", ln.Addr().String(), &gossh.ClientConfig{
+			User:            "root",
+			Auth:            []gossh.AuthMethod{gossh.PublicKeys(signer)},
+			HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+			Timeout:         5 * time.Second,
+		})
+	}
+
+	if _, err := dial(unauthorized); err == nil {
+		t.Fatal("Expected a key that isn't authorized to be rejected")
+	}
+
+	client, err := dial(authorized)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.RequestPty("xterm", 24, 80, gossh.TerminalModes{}); err != nil {
+		t.Fatal(err)
+	}
+	session.Stdin = strings.NewReader("echo recorded-output; exit 3\n")
+
+	var exitErr *gossh.ExitError
+	if err := session.Shell(); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Wait(); !errors.As(err, &exitErr) || exitErr.ExitStatus() != 3 {
+		t.Errorf("Expected the shell's exit status 3, got %v", err)
+	}
+
+	var r Recording
+	select {
+	case r = <-recordings:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the session to be recorded")
+	}
+	if r.Owner != "alice@example.com" || r.KeyFingerprint != Fingerprint(authorized.PublicKey()) {
+		t.Errorf("Expected the recording to be tagged with the key's owner, got %+v", r)
+	}
+	if !strings.Contains(string(r.Cast), "recorded-output") {
+		t.Errorf("Expected the session's output in the cast, got %s", r.Cast)
+	}
+
+	// The session is closed once its key is removed.
+	session, err = client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Stdin = strings.NewReader("sleep 30\n")
+	if err := session.Shell(); err != nil {
+		t.Fatal(err)
+	}
+	s.RemoveKey(authorized.PublicKey())
+
+	done := make(chan error)
+	go func() { done <- session.Wait() }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the session to be closed")
+	}
+
+	select {
+	case r := <-recordings:
+		if !strings.Contains(string(r.Cast), "Access expired") {
+			t.Errorf("Expected the cast to record why the session was closed, got %s", r.Cast)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the session to be recorded")
+	}
+}
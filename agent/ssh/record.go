@@ -0,0 +1,118 @@
+package ssh
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxRecordingBytes bounds a session's cast. Output after it is reached is not recorded.
+const maxRecordingBytes = 8 << 20
+
+// Recording is the audit record of a finished session.
+type Recording struct {
+	SessionID string
+
+	// Owner and KeyFingerprint identify the key the session was opened with.
+	Owner          string
+	KeyFingerprint string
+
+	RemoteAddr string
+	StartedAt  time.Time
+	EndedAt    time.Time
+
+	// Cast is the session's terminal output as an asciinema v2 cast. Truncated is set if it was cut
+	// short at maxRecordingBytes.
+	Cast      []byte
+	Truncated bool
+}
+
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// recorder writes what is written to it as the output events of an asciinema v2 cast.
+type recorder struct {
+	mu        sync.Mutex
+	start     time.Time
+	buf       bytes.Buffer
+	partial   []byte // an incomplete UTF-8 sequence ending the last write
+	truncated bool
+}
+
+func newRecorder(header castHeader, start time.Time) *recorder {
+	r := &recorder{start: start}
+
+	header.Version, header.Timestamp = 2, start.Unix()
+	line, _ := json.Marshal(header)
+	r.buf.Write(line)
+	r.buf.WriteByte('\n')
+
+	return r
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Events are JSON strings, so a UTF-8 sequence split across writes is held until it is complete.
+	data := append(r.partial, p...)
+	n := len(data) - incompleteSuffix(data)
+	r.partial = append([]byte(nil), data[n:]...)
+
+	r.event("o", string(data[:n]))
+	return len(p), nil
+}
+
+func (r *recorder) resize(width, height int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.event("r", fmt.Sprintf("%dx%d", width, height))
+}
+
+func (r *recorder) event(code, data string) {
+	if data == "" || r.truncated {
+		return
+	}
+
+	elapsed := math.Round(time.Since(r.start).Seconds()*1e6) / 1e6
+	line, _ := json.Marshal([]any{elapsed, code, data})
+	if r.buf.Len()+len(line)+1 > maxRecordingBytes {
+		r.truncated = true
+		return
+	}
+
+	r.buf.Write(line)
+	r.buf.WriteByte('\n')
+}
+
+// cast returns the cast recorded so far, and whether it was truncated.
+func (r *recorder) cast() ([]byte, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return bytes.Clone(r.buf.Bytes()), r.truncated
+}
+
+// incompleteSuffix returns how many bytes at the end of p begin a UTF-8 sequence that isn't complete.
+func incompleteSuffix(p []byte) int {
+	for i := 1; i < utf8.UTFMax && i <= len(p); i++ {
+		if utf8.RuneStart(p[len(p)-i]) {
+			if utf8.FullRune(p[len(p)-i:]) {
+				return 0
+			}
+			return i
+		}
+	}
+	return 0
+}
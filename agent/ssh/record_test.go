@@ -0,0 +1,61 @@
+package ssh
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	r := newRecorder(castHeader{Width: 80, Height: 24, Title: "alice@example.com"}, time.Now())
+
+	// "é" is split across two writes.
+	r.Write([]byte("caf\xc3"))
+	r.Write([]byte("\xa9\r\n"))
+	r.resize(120, 40)
+
+	cast, truncated := r.cast()
+	if truncated {
+		t.Error("Expected the cast not to be truncated")
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(cast)), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected a header and 3 events, got %q", lines)
+	}
+
+	var header castHeader
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil {
+		t.Fatalf("Failed to decode header: %v", err)
+	}
+	if header.Version != 2 || header.Width != 80 || header.Height != 24 || header.Title != "alice@example.com" {
+		t.Errorf("Unexpected header %+v", header)
+	}
+
+	want := [][2]string{{"o", "caf"}, {"o", "é\r\n"}, {"r", "120x40"}}
+	for i, line := range lines[1:] {
+		var event []any
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("Failed to decode event %q: %v", line, err)
+		}
+		if len(event) != 3 || event[1] != want[i][0] || event[2] != want[i][1] {
+			t.Errorf("Expected event %v, got %v", want[i], event)
+		}
+	}
+}
+
+func TestRecorderTruncates(t *testing.T) {
+	r := newRecorder(castHeader{Width: 80, Height: 24}, time.Now())
+
+	chunk := bytes.Repeat([]byte("x"), 1<<20)
+	for i := 0; i < 10; i++ {
+		r.Write(chunk)
+	}
+
+	cast, truncated := r.cast()
+	if !truncated || len(cast) > maxRecordingBytes {
+		t.Errorf("Expected the cast to be truncated to %d bytes, got %d bytes (truncated %t)", maxRecordingBytes, len(cast), truncated)
+	}
+}
@@ -2,11 +2,11 @@ package ssh
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net"
-	"os"
-	"os/signal"
 	"sync"
+	"time"
 
 	"github.com/gliderlabs/ssh"
 	gssh "github.com/gliderlabs/ssh"
@@ -15,40 +15,42 @@ import (
 )
 
 type Server struct {
-	sshSrv *gssh.Server
-	ln     net.Listener
-	ts     *tsnet.Server
+	authKey  string
+	hostname string
 
-	mu      sync.RWMutex
-	auths   []auth
-	tsState *ipnstate.Status
+	// lifecycle serialises Start and Close.
+	lifecycle sync.Mutex
+
+	mu        sync.RWMutex
+	sshSrv    *gssh.Server
+	ln        net.Listener
+	ts        *tsnet.Server
+	auths     []auth
+	tsState   *ipnstate.Status
+	recording func(Recording)
 
 	doneC chan struct{}
 }
 
 func NewServer(authKey, hostname string) *Server {
-	s := &Server{
-		ts: &tsnet.Server{
-			AuthKey:   authKey,
-			Hostname:  hostname,
-			Ephemeral: true,
-			UserLogf:  nullLogf,
-		},
-		sshSrv: &gssh.Server{
-			Handler: handler,
-		},
+	return &Server{
+		authKey:  authKey,
+		hostname: hostname,
 
 		auths:   []auth{},
 		tsState: nil,
 
 		doneC: make(chan struct{}, 1),
 	}
+}
 
-	// s.sshSrv.PublicKeyHandler = s.handlePublicKeyAuth
-
-	s.handleInterrupts()
-
-	return s
+// newSSHServer returns an SSH server that only accepts authorized keys. A new one is needed each
+// time the server starts, because a closed one can't serve again.
+func (s *Server) newSSHServer() *gssh.Server {
+	return &gssh.Server{
+		Handler:          s.handler,
+		PublicKeyHandler: s.handlePublicKeyAuth,
+	}
 }
 
 const runningState = "Running" // ipnstate.Status.BackendState
@@ -60,99 +62,145 @@ func (s *Server) Running() bool {
 	return s.tsState != nil && s.tsState.BackendState == runningState
 }
 
+// handlePublicKeyAuth accepts keys that are authorized and haven't expired. Only the first such key
+// a client offers is accepted, so that its session is attributed to the right owner.
 func (s *Server) handlePublicKeyAuth(ctx ssh.Context, key ssh.PublicKey) bool {
+	if a, ok := ctx.Value(authContextKey).(auth); ok {
+		return ssh.KeysEqual(a.key, key)
+	}
+
+	a, ok := s.authorized(key)
+	if ok {
+		ctx.SetValue(authContextKey, a)
+	}
+	return ok
+}
+
+// authorized returns the auth for key if it is authorized and hasn't expired.
+func (s *Server) authorized(key ssh.PublicKey) (auth, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	now := time.Now()
 	for _, a := range s.auths {
-		if ssh.KeysEqual(a.key, key) {
-			return true
+		if ssh.KeysEqual(a.key, key) && a.valid(now) {
+			return a, true
 		}
 	}
 
-	return false
+	return auth{}, false
 }
 
-func (s *Server) AddKey(key ssh.PublicKey) {
+// AddKey authorizes key until expiresAt, replacing its previous owner and expiry if it was already
+// authorized. Sessions are closed once their key expires or is removed.
+func (s *Server) AddKey(key ssh.PublicKey, owner string, expiresAt time.Time) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.auths = append(s.auths, auth{key: key})
+	now := time.Now()
+	auths := []auth{}
+	for _, a := range s.auths {
+		if !ssh.KeysEqual(a.key, key) && a.valid(now) {
+			auths = append(auths, a)
+		}
+	}
+	if expiresAt.After(now) {
+		auths = append(auths, auth{key: key, owner: owner, expiresAt: expiresAt})
+	}
+
+	s.auths = auths
 }
 
 func (s *Server) RemoveKey(key ssh.PublicKey) {
+	s.AddKey(key, "", time.Time{})
+}
+
+func (s *Server) ClearAuth() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	for i, a := range s.auths {
-		if ssh.KeysEqual(a.key, key) {
-			s.auths = append(s.auths[:i], s.auths[i+1:]...)
-		}
-	}
+	s.auths = []auth{}
 }
 
-func (s *Server) ClearAuth() {
+// OnRecording calls fn with the recording of each session once it has ended.
+func (s *Server) OnRecording(fn func(Recording)) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.auths = []auth{}
+	s.recording = fn
 }
 
-// Start starts the SSH server.
+// Start joins the tailnet and starts the SSH server on it. It may be started again after Close.
 //
 // It returns nil immediately if the server is already running.
 func (s *Server) Start(ctx context.Context) error {
+	s.lifecycle.Lock()
+	defer s.lifecycle.Unlock()
+
 	if s.Running() {
 		return nil
 	}
 
-	tsState, err := s.ts.Up(ctx)
+	// A closed tsnet server can't be started again either.
+	ts := &tsnet.Server{
+		AuthKey:   s.authKey,
+		Hostname:  s.hostname,
+		Ephemeral: true,
+		UserLogf:  nullLogf,
+	}
+
+	tsState, err := ts.Up(ctx)
 	if err != nil {
+		ts.Close()
 		return err
 	}
 
-	s.tsState = tsState
-
-	ln, err := s.ts.Listen("tcp", ":22")
+	ln, err := ts.Listen("tcp", ":22")
 	if err != nil {
+		ts.Close()
 		return err
 	}
 
+	sshSrv := s.newSSHServer()
 	go func() {
-		if err := s.sshSrv.Serve(ln); err != nil {
+		if err := sshSrv.Serve(ln); err != nil && !errors.Is(err, gssh.ErrServerClosed) {
 			log.Println(err)
 		}
 	}()
 
+	s.mu.Lock()
+	s.sshSrv, s.ln, s.ts, s.tsState = sshSrv, ln, ts, tsState
+	s.mu.Unlock()
+
 	return nil
 }
 
-func (s *Server) handleInterrupts() {
-	c := make(chan os.Signal, 1)
-	go func(s *Server) {
-		<-c
-		s.Close()
-
-		os.Exit(0)
-	}(s)
+// Close stops the SSH server, closing its sessions, and leaves the tailnet.
+func (s *Server) Close() error {
+	s.lifecycle.Lock()
+	defer s.lifecycle.Unlock()
 
-	signal.Notify(c, os.Interrupt)
-}
+	s.mu.Lock()
+	sshSrv, ln, ts := s.sshSrv, s.ln, s.ts
+	s.sshSrv, s.ln, s.ts, s.tsState = nil, nil, nil, nil
+	s.mu.Unlock()
 
-func (s *Server) Close() error {
-	if s.ln != nil {
-		s.ln.Close()
+	if sshSrv != nil {
+		sshSrv.Close()
 	}
 
-	if s.ts != nil {
-		s.ts.Close()
+	if ln != nil {
+		ln.Close()
 	}
 
-	if s.sshSrv != nil {
-		s.sshSrv.Close()
+	if ts != nil {
+		ts.Close()
 	}
 
-	s.doneC <- struct{}{}
+	select {
+	case s.doneC <- struct{}{}:
+	default:
+	}
 
 	return nil
 }
@@ -0,0 +1,29 @@
+// Package version reports the version and build commit of the agent binary.
+package version
+
+import "runtime/debug"
+
+// Version and Commit are set at build time with:
+//
+//	go build -ldflags "-X agent/version.Version=v1.2.3 -X agent/version.Commit=abc123"
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+// Get returns the agent's version and commit. The commit falls back to the VCS revision Go stamps
+// into binaries built from a checkout.
+func Get() (version, commit string) {
+	commit = Commit
+	if commit == "" {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			for _, s := range info.Settings {
+				if s.Key == "vcs.revision" {
+					commit = s.Value
+				}
+			}
+		}
+	}
+
+	return Version, commit
+}
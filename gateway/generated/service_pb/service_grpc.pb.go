@@ -19,8 +19,13 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	OnPrem_Heartbeat_FullMethodName = "/OnPrem/Heartbeat"
-	OnPrem_Apply_FullMethodName     = "/OnPrem/Apply"
+	OnPrem_Heartbeat_FullMethodName              = "/OnPrem/Heartbeat"
+	OnPrem_Apply_FullMethodName                  = "/OnPrem/Apply"
+	OnPrem_ReportActionResult_FullMethodName     = "/OnPrem/ReportActionResult"
+	OnPrem_ExchangeToken_FullMethodName          = "/OnPrem/ExchangeToken"
+	OnPrem_UploadLogs_FullMethodName             = "/OnPrem/UploadLogs"
+	OnPrem_UploadSessionRecording_FullMethodName = "/OnPrem/UploadSessionRecording"
+	OnPrem_WatchActions_FullMethodName           = "/OnPrem/WatchActions"
 )
 
 // OnPremClient is the client API for OnPrem service.
@@ -29,6 +34,17 @@ const (
 type OnPremClient interface {
 	Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error)
 	Apply(ctx context.Context, in *ApplyRequest, opts ...grpc.CallOption) (*ApplyResponse, error)
+	ReportActionResult(ctx context.Context, in *ReportActionResultRequest, opts ...grpc.CallOption) (*ReportActionResultResponse, error)
+	// Trades the bootstrap token the agent was installed with, sent as its bearer token, for a
+	// short-lived access token used for every other call.
+	ExchangeToken(ctx context.Context, in *ExchangeTokenRequest, opts ...grpc.CallOption) (*ExchangeTokenResponse, error)
+	// Uploads the output of the process the agent supervises, in batches.
+	UploadLogs(ctx context.Context, in *UploadLogsRequest, opts ...grpc.CallOption) (*UploadLogsResponse, error)
+	// Uploads the recording of an SSH session once it has ended.
+	UploadSessionRecording(ctx context.Context, in *UploadSessionRecordingRequest, opts ...grpc.CallOption) (*UploadSessionRecordingResponse, error)
+	// Delivers actions to the agent as soon as they are available, as an alternative to polling
+	// Apply. Over HTTP the stream is served as server-sent events.
+	WatchActions(ctx context.Context, in *WatchActionsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchActionsResponse], error)
 }
 
 type onPremClient struct {
@@ -59,12 +75,82 @@ func (c *onPremClient) Apply(ctx context.Context, in *ApplyRequest, opts ...grpc
 	return out, nil
 }
 
+func (c *onPremClient) ReportActionResult(ctx context.Context, in *ReportActionResultRequest, opts ...grpc.CallOption) (*ReportActionResultResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReportActionResultResponse)
+	err := c.cc.Invoke(ctx, OnPrem_ReportActionResult_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *onPremClient) ExchangeToken(ctx context.Context, in *ExchangeTokenRequest, opts ...grpc.CallOption) (*ExchangeTokenResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExchangeTokenResponse)
+	err := c.cc.Invoke(ctx, OnPrem_ExchangeToken_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *onPremClient) UploadLogs(ctx context.Context, in *UploadLogsRequest, opts ...grpc.CallOption) (*UploadLogsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UploadLogsResponse)
+	err := c.cc.Invoke(ctx, OnPrem_UploadLogs_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *onPremClient) UploadSessionRecording(ctx context.Context, in *UploadSessionRecordingRequest, opts ...grpc.CallOption) (*UploadSessionRecordingResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UploadSessionRecordingResponse)
+	err := c.cc.Invoke(ctx, OnPrem_UploadSessionRecording_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *onPremClient) WatchActions(ctx context.Context, in *WatchActionsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchActionsResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &OnPrem_ServiceDesc.Streams[0], OnPrem_WatchActions_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchActionsRequest, WatchActionsResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type OnPrem_WatchActionsClient = grpc.ServerStreamingClient[WatchActionsResponse]
+
 // OnPremServer is the server API for OnPrem service.
 // All implementations must embed UnimplementedOnPremServer
 // for forward compatibility.
 type OnPremServer interface {
 	Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error)
 	Apply(context.Context, *ApplyRequest) (*ApplyResponse, error)
+	ReportActionResult(context.Context, *ReportActionResultRequest) (*ReportActionResultResponse, error)
+	// Trades the bootstrap token the agent was installed with, sent as its bearer token, for a
+	// short-lived access token used for every other call.
+	ExchangeToken(context.Context, *ExchangeTokenRequest) (*ExchangeTokenResponse, error)
+	// Uploads the output of the process the agent supervises, in batches.
+	UploadLogs(context.Context, *UploadLogsRequest) (*UploadLogsResponse, error)
+	// Uploads the recording of an SSH session once it has ended.
+	UploadSessionRecording(context.Context, *UploadSessionRecordingRequest) (*UploadSessionRecordingResponse, error)
+	// Delivers actions to the agent as soon as they are available, as an alternative to polling
+	// Apply. Over HTTP the stream is served as server-sent events.
+	WatchActions(*WatchActionsRequest, grpc.ServerStreamingServer[WatchActionsResponse]) error
 	mustEmbedUnimplementedOnPremServer()
 }
 
@@ -81,6 +167,21 @@ func (UnimplementedOnPremServer) Heartbeat(context.Context, *HeartbeatRequest) (
 func (UnimplementedOnPremServer) Apply(context.Context, *ApplyRequest) (*ApplyResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Apply not implemented")
 }
+func (UnimplementedOnPremServer) ReportActionResult(context.Context, *ReportActionResultRequest) (*ReportActionResultResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReportActionResult not implemented")
+}
+func (UnimplementedOnPremServer) ExchangeToken(context.Context, *ExchangeTokenRequest) (*ExchangeTokenResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExchangeToken not implemented")
+}
+func (UnimplementedOnPremServer) UploadLogs(context.Context, *UploadLogsRequest) (*UploadLogsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UploadLogs not implemented")
+}
+func (UnimplementedOnPremServer) UploadSessionRecording(context.Context, *UploadSessionRecordingRequest) (*UploadSessionRecordingResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UploadSessionRecording not implemented")
+}
+func (UnimplementedOnPremServer) WatchActions(*WatchActionsRequest, grpc.ServerStreamingServer[WatchActionsResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchActions not implemented")
+}
 func (UnimplementedOnPremServer) mustEmbedUnimplementedOnPremServer() {}
 func (UnimplementedOnPremServer) testEmbeddedByValue()                {}
 
@@ -138,6 +239,89 @@ func _OnPrem_Apply_Handler(srv interface{}, ctx context.Context, dec func(interf
 	return interceptor(ctx, in, info, handler)
 }
 
+func _OnPrem_ReportActionResult_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReportActionResultRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OnPremServer).ReportActionResult(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OnPrem_ReportActionResult_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OnPremServer).ReportActionResult(ctx, req.(*ReportActionResultRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OnPrem_ExchangeToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExchangeTokenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OnPremServer).ExchangeToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OnPrem_ExchangeToken_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OnPremServer).ExchangeToken(ctx, req.(*ExchangeTokenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OnPrem_UploadLogs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UploadLogsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OnPremServer).UploadLogs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OnPrem_UploadLogs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OnPremServer).UploadLogs(ctx, req.(*UploadLogsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OnPrem_UploadSessionRecording_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UploadSessionRecordingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OnPremServer).UploadSessionRecording(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OnPrem_UploadSessionRecording_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OnPremServer).UploadSessionRecording(ctx, req.(*UploadSessionRecordingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OnPrem_WatchActions_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchActionsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(OnPremServer).WatchActions(m, &grpc.GenericServerStream[WatchActionsRequest, WatchActionsResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type OnPrem_WatchActionsServer = grpc.ServerStreamingServer[WatchActionsResponse]
+
 // OnPrem_ServiceDesc is the grpc.ServiceDesc for OnPrem service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -153,7 +337,29 @@ var OnPrem_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Apply",
 			Handler:    _OnPrem_Apply_Handler,
 		},
+		{
+			MethodName: "ReportActionResult",
+			Handler:    _OnPrem_ReportActionResult_Handler,
+		},
+		{
+			MethodName: "ExchangeToken",
+			Handler:    _OnPrem_ExchangeToken_Handler,
+		},
+		{
+			MethodName: "UploadLogs",
+			Handler:    _OnPrem_UploadLogs_Handler,
+		},
+		{
+			MethodName: "UploadSessionRecording",
+			Handler:    _OnPrem_UploadSessionRecording_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchActions",
+			Handler:       _OnPrem_WatchActions_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "service.proto",
 }
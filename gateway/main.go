@@ -60,6 +60,11 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap lets http.ResponseController flush streamed responses through the wrapper.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func withLogging(handler http.Handler, logger *log.Logger) http.Handler {
 	return &LoggingMiddleware{
 		handler: handler,
@@ -166,7 +171,9 @@ func run(healthCheck bool) error {
 	}
 
 	// Register gRPC server endpoint
-	gwmux := runtime.NewServeMux()
+	gwmux := runtime.NewServeMux(
+		runtime.WithMarshalerOption(eventStreamContentType, newEventStreamMarshaler()),
+	)
 
 	logger.Printf("Setting handler to gRPC server at %s", grpcServerEndpoint)
 	err := service_pb.RegisterOnPremHandlerFromEndpoint(ctx, gwmux, grpcServerEndpoint, opts)
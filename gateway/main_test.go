@@ -5,10 +5,12 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"log"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -33,6 +35,15 @@ func (s *mockOnPremServer) Heartbeat(ctx context.Context, req *service_pb.Heartb
 	return &service_pb.HeartbeatResponse{}, nil
 }
 
+func (s *mockOnPremServer) WatchActions(req *service_pb.WatchActionsRequest, stream service_pb.OnPrem_WatchActionsServer) error {
+	for _, id := range []string{"action-1", "action-2"} {
+		if err := stream.Send(&service_pb.WatchActionsResponse{Action: &service_pb.Action{Id: id}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Helper to create a test gRPC server
 func setupGRPCServer(t *testing.T) (*grpc.Server, *bufconn.Listener) {
 	listener := bufconn.Listen(1024 * 1024)
@@ -135,6 +146,66 @@ func TestHeartbeat(t *testing.T) {
 	}
 }
 
+func TestWatchActionsEventStream(t *testing.T) {
+	server, listener := setupGRPCServer(t)
+	defer server.Stop()
+
+	ctx := context.Background()
+	mux := runtime.NewServeMux(
+		runtime.WithMarshalerOption(eventStreamContentType, newEventStreamMarshaler()),
+	)
+	conn, err := grpc.DialContext(ctx, "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithInsecure(),
+	)
+	if err != nil {
+		t.Fatalf("Failed to dial bufnet: %v", err)
+	}
+	defer conn.Close()
+
+	if err := service_pb.RegisterOnPremHandlerClient(ctx, mux, service_pb.NewOnPremClient(conn)); err != nil {
+		t.Fatalf("Failed to register gateway: %v", err)
+	}
+
+	// Serve through the logging middleware to check streamed responses are flushed through it.
+	ts := httptest.NewServer(withLogging(mux, log.New(io.Discard, "", 0)))
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/watch_actions", strings.NewReader(`{"identity":{"name":"test-worker"}}`))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", eventStreamContentType)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != eventStreamContentType {
+		t.Errorf("Expected content type %s, got %s", eventStreamContentType, ct)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read response body: %v", err)
+	}
+
+	events := strings.Split(strings.TrimSpace(string(body)), "\n\n")
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d: %s", len(events), body)
+	}
+	for i, id := range []string{"action-1", "action-2"} {
+		if !strings.HasPrefix(events[i], "data: ") || !strings.Contains(events[i], `"id":"`+id+`"`) {
+			t.Errorf("Expected event for %s, got %q", id, events[i])
+		}
+	}
+}
+
 func TestRun(t *testing.T) {
 	// Save original env var and restore after test
 	origAddr := os.Getenv("BACKEND_ADDRESS")
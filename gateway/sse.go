@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const eventStreamContentType = "text/event-stream"
+
+// eventStreamMarshaler serves streaming RPCs as server-sent events to clients that accept them.
+// Each message is sent as a JSON "data:" event; the gateway's newline delimiter ends the event.
+type eventStreamMarshaler struct {
+	runtime.JSONPb
+}
+
+func newEventStreamMarshaler() *eventStreamMarshaler {
+	return &eventStreamMarshaler{
+		JSONPb: runtime.JSONPb{
+			MarshalOptions:   protojson.MarshalOptions{EmitUnpopulated: true},
+			UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+		},
+	}
+}
+
+func (m *eventStreamMarshaler) Marshal(v interface{}) ([]byte, error) {
+	data, err := m.JSONPb.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	b.WriteString("data: ")
+	b.Write(data)
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
+
+func (m *eventStreamMarshaler) NewEncoder(w io.Writer) runtime.Encoder {
+	return runtime.EncoderFunc(func(v interface{}) error {
+		data, err := m.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+}
+
+func (m *eventStreamMarshaler) ContentType(_ interface{}) string {
+	return eventStreamContentType
+}
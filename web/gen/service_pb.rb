@@ -5,17 +5,64 @@
 require 'google/protobuf'
 
 require 'google/api/annotations_pb'
+require 'google/protobuf/duration_pb'
+require 'google/protobuf/timestamp_pb'
 
 
-descriptor_data = "\n\rservice.proto\x1a\x1cgoogle/api/annotations.proto\"9\n\x10HeartbeatRequest\x12%\n\x08identity\x18\x01 \x01(\x0b\x32\t.IdentityR\x08identity\"\x13\n\x11HeartbeatResponse\"5\n\x0c\x41pplyRequest\x12%\n\x08identity\x18\x01 \x01(\x0b\x32\t.IdentityR\x08identity\"Y\n\x06\x41\x63tion\x12\x0e\n\x02id\x18\x01 \x01(\tR\x02id\x12\x35\n\x0b\x61pply_chart\x18\x02 \x01(\x0b\x32\x12.ApplyChartRequestH\x00R\napplyChartB\x08\n\x06\x61\x63tion\"0\n\rApplyResponse\x12\x1f\n\x06\x61\x63tion\x18\x01 \x01(\x0b\x32\x07.ActionR\x06\x61\x63tion\")\n\x11\x41pplyChartRequest\x12\x14\n\x05\x63hart\x18\x01 \x01(\x0cR\x05\x63hart\"\x85\x01\n\x08Identity\x12!\n\x0clifecycle_id\x18\x01 \x01(\tR\x0blifecycleId\x12\x1d\n\nsession_id\x18\x05 \x01(\tR\tsessionId\x12\x12\n\x04name\x18\x03 \x01(\tR\x04name\x12\x1d\n\nversion_id\x18\x04 \x01(\tR\tversionIdJ\x04\x08\x02\x10\x03\x32\x8e\x01\n\x06OnPrem\x12I\n\tHeartbeat\x12\x11.HeartbeatRequest\x1a\x12.HeartbeatResponse\"\x15\x82\xd3\xe4\x93\x02\x0f\"\n/heartbeat:\x01*\x12\x39\n\x05\x41pply\x12\r.ApplyRequest\x1a\x0e.ApplyResponse\"\x11\x82\xd3\xe4\x93\x02\x0b\"\x06/apply:\x01*B\x16Z\x14generated/service_pbb\x06proto3"
+descriptor_data = "\n\rservice.proto\x1a\x1cgoogle/api/annotations.proto\x1a\x1egoogle/protobuf/duration.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"=\n\x14\x45xchangeTokenRequest\x12%\n\x08identity\x18\x01 \x01(\x0b\x32\t.IdentityR\x08identity\"u\n\x15\x45xchangeTokenResponse\x12!\n\x0c\x61\x63\x63\x65ss_token\x18\x01 \x01(\tR\x0b\x61\x63\x63\x65ssToken\x12\x39\n\nexpires_at\x18\x02 \x01(\x0b\x32\x1a.google.protobuf.TimestampR\texpiresAt\"\xf7\x01\n\x10HeartbeatRequest\x12%\n\x08identity\x18\x01 \x01(\x0b\x32\t.IdentityR\x08identity\x12\'\n\x06health\x18\x02 \x01(\x0b\x32\x0f.HealthSnapshotR\x06health\x12=\n\x0c\x63ollected_at\x18\x03 \x01(\x0b\x32\x1a.google.protobuf.TimestampR\x0b\x63ollectedAt\x12(\n\x07process\x18\x04 \x01(\x0b\x32\x0e.ProcessStatusR\x07process\x12*\n\x08releases\x18\x05 \x03(\x0b\x32\x0e.ReleaseStatusR\x08releases\"\xcd\x02\n\rReleaseStatus\x12\x12\n\x04name\x18\x01 \x01(\tR\x04name\x12\x1c\n\tnamespace\x18\x02 \x01(\tR\tnamespace\x12\x1a\n\x08revision\x18\x03 \x01(\x05R\x08revision\x12\x16\n\x06status\x18\x04 \x01(\tR\x06status\x12\x1d\n\nchart_name\x18\x05 \x01(\tR\tchartName\x12#\n\rchart_version\x18\x06 \x01(\tR\x0c\x63hartVersion\x12\x1f\n\x0b\x61pp_version\x18\x07 \x01(\tR\nappVersion\x12\x39\n\nupdated_at\x18\x08 \x01(\x0b\x32\x1a.google.protobuf.TimestampR\tupdatedAt\x12\x14\n\x05\x61gent\x18\t \x01(\x08R\x05\x61gent\x12 \n\x0b\x64\x65scription\x18\n \x01(\tR\x0b\x64\x65scription\"\x7f\n\x11UploadLogsRequest\x12%\n\x08identity\x18\x01 \x01(\x0b\x32\t.IdentityR\x08identity\x12\x1e\n\x05lines\x18\x02 \x03(\x0b\x32\x08.LogLineR\x05lines\x12#\n\rdropped_lines\x18\x03 \x01(\x03R\x0c\x64roppedLines\"\x14\n\x12UploadLogsResponse\"q\n\x07LogLine\x12.\n\x04time\x18\x01 \x01(\x0b\x32\x1a.google.protobuf.TimestampR\x04time\x12\"\n\x06stream\x18\x02 \x01(\x0e\x32\n.LogStreamR\x06stream\x12\x12\n\x04text\x18\x03 \x01(\tR\x04text\"w\n\x1dUploadSessionRecordingRequest\x12%\n\x08identity\x18\x01 \x01(\x0b\x32\t.IdentityR\x08identity\x12/\n\trecording\x18\x02 \x01(\x0b\x32\x11.SessionRecordingR\trecording\" \n\x1eUploadSessionRecordingResponse\"\xb5\x02\n\x10SessionRecording\x12\x1d\n\nsession_id\x18\x01 \x01(\tR\tsessionId\x12\x14\n\x05owner\x18\x02 \x01(\tR\x05owner\x12\'\n\x0fkey_fingerprint\x18\x03 \x01(\tR\x0ekeyFingerprint\x12\x1f\n\x0bremote_addr\x18\x04 \x01(\tR\nremoteAddr\x12\x39\n\nstarted_at\x18\x05 \x01(\x0b\x32\x1a.google.protobuf.TimestampR\tstartedAt\x12\x35\n\x08\x65nded_at\x18\x06 \x01(\x0b\x32\x1a.google.protobuf.TimestampR\x07\x65ndedAt\x12\x12\n\x04\x63\x61st\x18\x07 \x01(\x0cR\x04\x63\x61st\x12\x1c\n\ttruncated\x18\x08 \x01(\x08R\ttruncated\"\xd4\x01\n\rProcessStatus\x12#\n\x05state\x18\x01 \x01(\x0e\x32\r.ProcessStateR\x05state\x12\x39\n\nstarted_at\x18\x02 \x01(\x0b\x32\x1a.google.protobuf.TimestampR\tstartedAt\x12\x1a\n\x08restarts\x18\x03 \x01(\x05R\x08restarts\x12#\n\rcrash_looping\x18\x04 \x01(\x08R\x0c\x63rashLooping\x12\"\n\x05\x65xits\x18\x05 \x03(\x0b\x32\x0c.ProcessExitR\x05\x65xits\"\xea\x01\n\x0bProcessExit\x12\x39\n\nstarted_at\x18\x01 \x01(\x0b\x32\x1a.google.protobuf.TimestampR\tstartedAt\x12\x37\n\texited_at\x18\x02 \x01(\x0b\x32\x1a.google.protobuf.TimestampR\x08\x65xitedAt\x12\x1b\n\texit_code\x18\x03 \x01(\x05R\x08\x65xitCode\x12\x16\n\x06signal\x18\x04 \x01(\tR\x06signal\x12\x14\n\x05\x65rror\x18\x05 \x01(\tR\x05\x65rror\x12\x1c\n\trequested\x18\x06 \x01(\x08R\trequested\"o\n\x0eHealthSnapshot\x12=\n\x0c\x63ollected_at\x18\x01 \x01(\x0b\x32\x1a.google.protobuf.TimestampR\x0b\x63ollectedAt\x12\x1e\n\x04pods\x18\x02 \x03(\x0b\x32\n.PodHealthR\x04pods\"g\n\tPodHealth\x12\x12\n\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n\x05phase\x18\x02 \x01(\tR\x05phase\x12\x30\n\ncontainers\x18\x03 \x03(\x0b\x32\x10.ContainerHealthR\ncontainers\"\xd5\x01\n\x0f\x43ontainerHealth\x12\x12\n\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n\x05image\x18\x02 \x01(\tR\x05image\x12\x14\n\x05ready\x18\x03 \x01(\x08R\x05ready\x12#\n\rrestart_count\x18\x04 \x01(\x05R\x0crestartCount\x12%\n\x0ewaiting_reason\x18\x05 \x01(\tR\rwaitingReason\x12\x36\n\x17last_termination_reason\x18\x06 \x01(\tR\x15lastTerminationReason\"\x13\n\x11HeartbeatResponse\"5\n\x0c\x41pplyRequest\x12%\n\x08identity\x18\x01 \x01(\x0b\x32\t.IdentityR\x08identity\"\xff\x04\n\x06\x41\x63tion\x12\x0e\n\x02id\x18\x01 \x01(\tR\x02id\x12\x35\n\x0b\x61pply_chart\x18\x02 \x01(\x0b\x32\x12.ApplyChartRequestH\x00R\napplyChart\x12\x32\n\nplan_chart\x18\x03 \x01(\x0b\x32\x11.PlanChartRequestH\x00R\tplanChart\x12\x45\n\x11\x61uthorize_ssh_key\x18\x04 \x01(\x0b\x32\x17.AuthorizeSshKeyRequestH\x00R\x0f\x61uthorizeSshKey\x12N\n\x14request_shell_access\x18\x05 \x01(\x0b\x32\x1a.RequestShellAccessRequestH\x00R\x12requestShellAccess\x12\x44\n\x10rollback_release\x18\x06 \x01(\x0b\x32\x17.RollbackReleaseRequestH\x00R\x0frollbackRelease\x12G\n\x11uninstall_release\x18\x07 \x01(\x0b\x32\x18.UninstallReleaseRequestH\x00R\x10uninstallRelease\x12G\n\x11restart_workloads\x18\x08 \x01(\x0b\x32\x18.RestartWorkloadsRequestH\x00R\x10restartWorkloads\x12>\n\x0escale_workload\x18\t \x01(\x0b\x32\x15.ScaleWorkloadRequestH\x00R\rscaleWorkload\x12\x41\n\x0frelease_history\x18\n \x01(\x0b\x32\x16.ReleaseHistoryRequestH\x00R\x0ereleaseHistoryB\x08\n\x06\x61\x63tion\"<\n\x13WatchActionsRequest\x12%\n\x08identity\x18\x01 \x01(\x0b\x32\t.IdentityR\x08identity\"7\n\x14WatchActionsResponse\x12\x1f\n\x06\x61\x63tion\x18\x01 \x01(\x0b\x32\x07.ActionR\x06\x61\x63tion\"0\n\rApplyResponse\x12\x1f\n\x06\x61\x63tion\x18\x01 \x01(\x0b\x32\x07.ActionR\x06\x61\x63tion\"\xd9\x02\n\x11\x41pplyChartRequest\x12\x14\n\x05\x63hart\x18\x01 \x01(\x0cR\x05\x63hart\x12\x1c\n\tsignature\x18\x02 \x01(\x0cR\tsignature\x12!\n\x0crelease_name\x18\x03 \x01(\tR\x0breleaseName\x12\x1c\n\tnamespace\x18\x04 \x01(\tR\tnamespace\x12\x38\n\x0fvalues_strategy\x18\x05 \x01(\x0e\x32\x0f.ValuesStrategyR\x0evaluesStrategy\x12%\n\x0evalues_overlay\x18\x06 \x01(\x0cR\rvaluesOverlay\x12\x38\n\x18values_overlay_signature\x18\x07 \x01(\x0cR\x16valuesOverlaySignature\x12\x34\n\x16refuse_value_conflicts\x18\x08 \x01(\x08R\x14refuseValueConflicts\"\xca\x01\n\x10PlanChartRequest\x12\x14\n\x05\x63hart\x18\x01 \x01(\x0cR\x05\x63hart\x12!\n\x0crelease_name\x18\x02 \x01(\tR\x0breleaseName\x12\x1c\n\tnamespace\x18\x03 \x01(\tR\tnamespace\x12\x38\n\x0fvalues_strategy\x18\x04 \x01(\x0e\x32\x0f.ValuesStrategyR\x0evaluesStrategy\x12%\n\x0evalues_overlay\x18\x05 \x01(\x0cR\rvaluesOverlay\"\x88\x01\n\x16\x41uthorizeSshKeyRequest\x12\x1d\n\npublic_key\x18\x01 \x01(\tR\tpublicKey\x12\x14\n\x05owner\x18\x02 \x01(\tR\x05owner\x12\x39\n\nexpires_at\x18\x03 \x01(\x0b\x32\x1a.google.protobuf.TimestampR\texpiresAt\"\xa7\x01\n\x19RequestShellAccessRequest\x12\x1c\n\trequester\x18\x01 \x01(\tR\trequester\x12\x16\n\x06reason\x18\x02 \x01(\tR\x06reason\x12\x35\n\x08\x64uration\x18\x03 \x01(\x0b\x32\x19.google.protobuf.DurationR\x08\x64uration\x12\x1d\n\npublic_key\x18\x04 \x01(\tR\tpublicKey\"u\n\x16RollbackReleaseRequest\x12!\n\x0crelease_name\x18\x01 \x01(\tR\x0breleaseName\x12\x1c\n\tnamespace\x18\x02 \x01(\tR\tnamespace\x12\x1a\n\x08revision\x18\x03 \x01(\x05R\x08revision\"\xa1\x01\n\x17UninstallReleaseRequest\x12!\n\x0crelease_name\x18\x01 \x01(\tR\x0breleaseName\x12\x1c\n\tnamespace\x18\x02 \x01(\tR\tnamespace\x12\"\n\x0c\x63onfirmation\x18\x03 \x01(\tR\x0c\x63onfirmation\x12!\n\x0ckeep_history\x18\x04 \x01(\x08R\x0bkeepHistory\"\x81\x01\n\x17RestartWorkloadsRequest\x12!\n\x0crelease_name\x18\x01 \x01(\tR\x0breleaseName\x12\x1c\n\tnamespace\x18\x02 \x01(\tR\tnamespace\x12%\n\x0elabel_selector\x18\x03 \x01(\tR\rlabelSelector\"\x9b\x01\n\x14ScaleWorkloadRequest\x12!\n\x0crelease_name\x18\x01 \x01(\tR\x0breleaseName\x12\x1c\n\tnamespace\x18\x02 \x01(\tR\tnamespace\x12\x12\n\x04kind\x18\x03 \x01(\tR\x04kind\x12\x12\n\x04name\x18\x04 \x01(\tR\x04name\x12\x1a\n\x08replicas\x18\x05 \x01(\x05R\x08replicas\"\x86\x01\n\x15ReleaseHistoryRequest\x12!\n\x0crelease_name\x18\x01 \x01(\tR\x0breleaseName\x12\x1c\n\tnamespace\x18\x02 \x01(\tR\tnamespace\x12\x10\n\x03max\x18\x03 \x01(\x05R\x03max\x12\x1a\n\x08revision\x18\x04 \x01(\x05R\x08revision\"\xa8\x01\n\x19ReportActionResultRequest\x12%\n\x08identity\x18\x01 \x01(\x0b\x32\t.IdentityR\x08identity\x12%\n\x06result\x18\x02 \x01(\x0b\x32\r.ActionResultR\x06result\x12=\n\x0c\x63ollected_at\x18\x03 \x01(\x0b\x32\x1a.google.protobuf.TimestampR\x0b\x63ollectedAt\"\x1c\n\x1aReportActionResultResponse\"\xd4\x04\n\x0c\x41\x63tionResult\x12\x1b\n\taction_id\x18\x01 \x01(\tR\x08\x61\x63tionId\x12\"\n\x05state\x18\x02 \x01(\x0e\x32\x0c.ActionStateR\x05state\x12\x14\n\x05\x65rror\x18\x03 \x01(\tR\x05\x65rror\x12\x39\n\nstarted_at\x18\x04 \x01(\x0b\x32\x1a.google.protobuf.TimestampR\tstartedAt\x12;\n\x0b\x66inished_at\x18\x05 \x01(\x0b\x32\x1a.google.protobuf.TimestampR\nfinishedAt\x12)\n\x10release_revision\x18\x06 \x01(\x05R\x0freleaseRevision\x12+\n\x08rollback\x18\x07 \x01(\x0b\x32\x0f.RollbackResultR\x08rollback\x12$\n\x04plan\x18\x08 \x01(\x0b\x32\x10.PlanChartResultR\x04plan\x12%\n\x08\x64\x65\x66\x65rral\x18\t \x01(\x0b\x32\t.DeferralR\x08\x64\x65\x66\x65rral\x12\x34\n\x0cshell_access\x18\n \x01(\x0b\x32\x11.ShellAccessGrantR\x0bshellAccess\x12\'\n\tworkloads\x18\x0b \x03(\x0b\x32\t.WorkloadR\tworkloads\x12\x38\n\x0frelease_history\x18\x0c \x01(\x0b\x32\x0f.ReleaseHistoryR\x0ereleaseHistory\x12\x37\n\x0fvalue_conflicts\x18\r \x03(\x0b\x32\x0e.ValueConflictR\x0evalueConflicts\"Y\n\rValueConflict\x12\x12\n\x04path\x18\x01 \x01(\tR\x04path\x12\x1a\n\x08\x63ustomer\x18\x02 \x01(\tR\x08\x63ustomer\x12\x18\n\x07overlay\x18\x03 \x01(\tR\x07overlay\"l\n\x08Workload\x12\x12\n\x04kind\x18\x01 \x01(\tR\x04kind\x12\x1c\n\tnamespace\x18\x02 \x01(\tR\tnamespace\x12\x12\n\x04name\x18\x03 \x01(\tR\x04name\x12\x1a\n\x08replicas\x18\x04 \x01(\x05R\x08replicas\"m\n\x0eReleaseHistory\x12,\n\trevisions\x18\x01 \x03(\x0b\x32\x0e.ReleaseStatusR\trevisions\x12-\n\x08manifest\x18\x02 \x01(\x0b\x32\x11.RevisionManifestR\x08manifest\"b\n\x10RevisionManifest\x12\x1a\n\x08revision\x18\x01 \x01(\x05R\x08revision\x12\x1a\n\x08manifest\x18\x02 \x01(\tR\x08manifest\x12\x16\n\x06values\x18\x03 \x01(\tR\x06values\"\xab\x01\n\x10ShellAccessGrant\x12\x1f\n\x0b\x61pproved_by\x18\x01 \x01(\tR\napprovedBy\x12;\n\x0b\x61pproved_at\x18\x02 \x01(\x0b\x32\x1a.google.protobuf.TimestampR\napprovedAt\x12\x39\n\nexpires_at\x18\x03 \x01(\x0b\x32\x1a.google.protobuf.TimestampR\texpiresAt\"_\n\x08\x44\x65\x66\x65rral\x12\x16\n\x06reason\x18\x01 \x01(\tR\x06reason\x12;\n\x0bnext_window\x18\x02 \x01(\x0b\x32\x1a.google.protobuf.TimestampR\nnextWindow\"\x98\x01\n\x0eRollbackResult\x12#\n\rfrom_revision\x18\x01 \x01(\x05R\x0c\x66romRevision\x12\x1f\n\x0bto_revision\x18\x02 \x01(\x05R\ntoRevision\x12\x14\n\x05\x65rror\x18\x03 \x01(\tR\x05\x65rror\x12*\n\x07\x62\x61\x63kups\x18\x04 \x03(\x0b\x32\x10.BackupReferenceR\x07\x62\x61\x63kups\"\xaa\x01\n\x0f\x42\x61\x63kupReference\x12\x16\n\x06\x62\x61\x63kup\x18\x01 \x01(\tR\x06\x62\x61\x63kup\x12\x12\n\x04kind\x18\x02 \x01(\tR\x04kind\x12\x1c\n\tnamespace\x18\x03 \x01(\tR\tnamespace\x12\x12\n\x04name\x18\x04 \x01(\tR\x04name\x12\x39\n\ncreated_at\x18\x05 \x01(\x0b\x32\x1a.google.protobuf.TimestampR\tcreatedAt\"i\n\x0fPlanChartResult\x12)\n\x10release_revision\x18\x01 \x01(\x05R\x0freleaseRevision\x12+\n\tresources\x18\x02 \x03(\x0b\x32\r.ResourceDiffR\tresources\"\xc4\x01\n\x0cResourceDiff\x12\'\n\x06\x63hange\x18\x01 \x01(\x0e\x32\x0f.ResourceChangeR\x06\x63hange\x12\x1f\n\x0b\x61pi_version\x18\x02 \x01(\tR\napiVersion\x12\x12\n\x04kind\x18\x03 \x01(\tR\x04kind\x12\x1c\n\tnamespace\x18\x04 \x01(\tR\tnamespace\x12\x12\n\x04name\x18\x05 \x01(\tR\x04name\x12$\n\x06\x66ields\x18\x06 \x03(\x0b\x32\x0c.FieldChangeR\x06\x66ields\"E\n\x0b\x46ieldChange\x12\x12\n\x04path\x18\x01 \x01(\tR\x04path\x12\x12\n\x04\x66rom\x18\x02 \x01(\tR\x04\x66rom\x12\x0e\n\x02to\x18\x03 \x01(\tR\x02to\"\xf5\x01\n\x08Identity\x12!\n\x0clifecycle_id\x18\x01 \x01(\tR\x0blifecycleId\x12\x1d\n\nsession_id\x18\x05 \x01(\tR\tsessionId\x12\x12\n\x04name\x18\x03 \x01(\tR\x04name\x12\x1d\n\nversion_id\x18\x04 \x01(\tR\tversionId\x12#\n\ragent_version\x18\x06 \x01(\tR\x0c\x61gentVersion\x12!\n\x0c\x61gent_commit\x18\x07 \x01(\tR\x0b\x61gentCommit\x12&\n\x07\x63luster\x18\x08 \x01(\x0b\x32\x0c.ClusterInfoR\x07\x63lusterJ\x04\x08\x02\x10\x03\"\xb1\x02\n\x0b\x43lusterInfo\x12\x10\n\x03uid\x18\x01 \x01(\tR\x03uid\x12-\n\x12kubernetes_version\x18\x02 \x01(\tR\x11kubernetesVersion\x12\x31\n\x0c\x64istribution\x18\x03 \x01(\x0e\x32\r.DistributionR\x0c\x64istribution\x12\x1d\n\nnode_count\x18\x04 \x01(\x05R\tnodeCount\x12\x36\n\x17\x63pu_capacity_millicores\x18\x05 \x01(\x03R\x15\x63puCapacityMillicores\x12\x32\n\x15memory_capacity_bytes\x18\x06 \x01(\x03R\x13memoryCapacityBytes\x12#\n\rchart_version\x18\x07 \x01(\tR\x0c\x63hartVersion*U\n\tLogStream\x12\x1a\n\x16LOG_STREAM_UNSPECIFIED\x10\x00\x12\x15\n\x11LOG_STREAM_STDOUT\x10\x01\x12\x15\n\x11LOG_STREAM_STDERR\x10\x02*\x99\x01\n\x0cProcessState\x12\x1d\n\x19PROCESS_STATE_UNSPECIFIED\x10\x00\x12\x1a\n\x16PROCESS_STATE_STARTING\x10\x01\x12\x19\n\x15PROCESS_STATE_RUNNING\x10\x02\x12\x19\n\x15PROCESS_STATE_BACKOFF\x10\x03\x12\x18\n\x14PROCESS_STATE_EXITED\x10\x04*\xaa\x01\n\x0eValuesStrategy\x12\x1f\n\x1bVALUES_STRATEGY_UNSPECIFIED\x10\x00\x12$\n VALUES_STRATEGY_RESET_THEN_REUSE\x10\x01\x12\x19\n\x15VALUES_STRATEGY_REUSE\x10\x02\x12\x19\n\x15VALUES_STRATEGY_RESET\x10\x03\x12\x1b\n\x17VALUES_STRATEGY_OVERLAY\x10\x04*{\n\x0b\x41\x63tionState\x12\x1c\n\x18\x41\x43TION_STATE_UNSPECIFIED\x10\x00\x12\x1a\n\x16\x41\x43TION_STATE_SUCCEEDED\x10\x01\x12\x17\n\x13\x41\x43TION_STATE_FAILED\x10\x02\x12\x19\n\x15\x41\x43TION_STATE_DEFERRED\x10\x03*\x86\x01\n\x0eResourceChange\x12\x1f\n\x1bRESOURCE_CHANGE_UNSPECIFIED\x10\x00\x12\x19\n\x15RESOURCE_CHANGE_ADDED\x10\x01\x12\x1b\n\x17RESOURCE_CHANGE_CHANGED\x10\x02\x12\x1b\n\x17RESOURCE_CHANGE_REMOVED\x10\x03*\xa0\x01\n\x0c\x44istribution\x12\x1c\n\x18\x44ISTRIBUTION_UNSPECIFIED\x10\x00\x12\x14\n\x10\x44ISTRIBUTION_EKS\x10\x01\x12\x14\n\x10\x44ISTRIBUTION_GKE\x10\x02\x12\x14\n\x10\x44ISTRIBUTION_AKS\x10\x03\x12\x14\n\x10\x44ISTRIBUTION_K3S\x10\x04\x12\x1a\n\x16\x44ISTRIBUTION_OPENSHIFT\x10\x05\x32\xec\x04\n\x06OnPrem\x12I\n\tHeartbeat\x12\x11.HeartbeatRequest\x1a\x12.HeartbeatResponse\"\x15\x82\xd3\xe4\x93\x02\x0f\"\n/heartbeat:\x01*\x12\x39\n\x05\x41pply\x12\r.ApplyRequest\x1a\x0e.ApplyResponse\"\x11\x82\xd3\xe4\x93\x02\x0b\"\x06/apply:\x01*\x12h\n\x12ReportActionResult\x12\x1a.ReportActionResultRequest\x1a\x1b.ReportActionResultResponse\"\x19\x82\xd3\xe4\x93\x02\x13\"\x0e/action_result:\x01*\x12Z\n\rExchangeToken\x12\x15.ExchangeTokenRequest\x1a\x16.ExchangeTokenResponse\"\x1a\x82\xd3\xe4\x93\x02\x14\"\x0f/exchange_token:\x01*\x12G\n\nUploadLogs\x12\x12.UploadLogsRequest\x1a\x13.UploadLogsResponse\"\x10\x82\xd3\xe4\x93\x02\n\"\x05/logs:\x01*\x12s\n\x16UploadSessionRecording\x12\x1e.UploadSessionRecordingRequest\x1a\x1f.UploadSessionRecordingResponse\"\x18\x82\xd3\xe4\x93\x02\x12\"\r/ssh_sessions:\x01*\x12X\n\x0cWatchActions\x12\x14.WatchActionsRequest\x1a\x15.WatchActionsResponse\"\x19\x82\xd3\xe4\x93\x02\x13\"\x0e/watch_actions:\x01*0\x01\x42\x16Z\x14generated/service_pbb\x06proto3"
 
 pool = Google::Protobuf::DescriptorPool.generated_pool
 pool.add_serialized_file(descriptor_data)
 
+ExchangeTokenRequest = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("ExchangeTokenRequest").msgclass
+ExchangeTokenResponse = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("ExchangeTokenResponse").msgclass
 HeartbeatRequest = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("HeartbeatRequest").msgclass
+ReleaseStatus = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("ReleaseStatus").msgclass
+UploadLogsRequest = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("UploadLogsRequest").msgclass
+UploadLogsResponse = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("UploadLogsResponse").msgclass
+LogLine = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("LogLine").msgclass
+UploadSessionRecordingRequest = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("UploadSessionRecordingRequest").msgclass
+UploadSessionRecordingResponse = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("UploadSessionRecordingResponse").msgclass
+SessionRecording = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("SessionRecording").msgclass
+ProcessStatus = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("ProcessStatus").msgclass
+ProcessExit = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("ProcessExit").msgclass
+HealthSnapshot = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("HealthSnapshot").msgclass
+PodHealth = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("PodHealth").msgclass
+ContainerHealth = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("ContainerHealth").msgclass
 HeartbeatResponse = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("HeartbeatResponse").msgclass
 ApplyRequest = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("ApplyRequest").msgclass
 Action = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("Action").msgclass
+WatchActionsRequest = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("WatchActionsRequest").msgclass
+WatchActionsResponse = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("WatchActionsResponse").msgclass
 ApplyResponse = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("ApplyResponse").msgclass
 ApplyChartRequest = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("ApplyChartRequest").msgclass
+PlanChartRequest = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("PlanChartRequest").msgclass
+AuthorizeSshKeyRequest = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("AuthorizeSshKeyRequest").msgclass
+RequestShellAccessRequest = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("RequestShellAccessRequest").msgclass
+RollbackReleaseRequest = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("RollbackReleaseRequest").msgclass
+UninstallReleaseRequest = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("UninstallReleaseRequest").msgclass
+RestartWorkloadsRequest = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("RestartWorkloadsRequest").msgclass
+ScaleWorkloadRequest = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("ScaleWorkloadRequest").msgclass
+ReleaseHistoryRequest = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("ReleaseHistoryRequest").msgclass
+ReportActionResultRequest = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("ReportActionResultRequest").msgclass
+ReportActionResultResponse = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("ReportActionResultResponse").msgclass
+ActionResult = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("ActionResult").msgclass
+ValueConflict = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("ValueConflict").msgclass
+Workload = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("Workload").msgclass
+ReleaseHistory = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("ReleaseHistory").msgclass
+RevisionManifest = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("RevisionManifest").msgclass
+ShellAccessGrant = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("ShellAccessGrant").msgclass
+Deferral = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("Deferral").msgclass
+RollbackResult = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("RollbackResult").msgclass
+BackupReference = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("BackupReference").msgclass
+PlanChartResult = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("PlanChartResult").msgclass
+ResourceDiff = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("ResourceDiff").msgclass
+FieldChange = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("FieldChange").msgclass
 Identity = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("Identity").msgclass
+ClusterInfo = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("ClusterInfo").msgclass
+LogStream = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("LogStream").enummodule
+ProcessState = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("ProcessState").enummodule
+ValuesStrategy = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("ValuesStrategy").enummodule
+ActionState = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("ActionState").enummodule
+ResourceChange = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("ResourceChange").enummodule
+Distribution = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("Distribution").enummodule
@@ -15,6 +15,11 @@ module OnPrem
 
     rpc :Heartbeat, ::HeartbeatRequest, ::HeartbeatResponse
     rpc :Apply, ::ApplyRequest, ::ApplyResponse
+    rpc :ReportActionResult, ::ReportActionResultRequest, ::ReportActionResultResponse
+    rpc :ExchangeToken, ::ExchangeTokenRequest, ::ExchangeTokenResponse
+    rpc :UploadLogs, ::UploadLogsRequest, ::UploadLogsResponse
+    rpc :UploadSessionRecording, ::UploadSessionRecordingRequest, ::UploadSessionRecordingResponse
+    rpc :WatchActions, ::WatchActionsRequest, stream(::WatchActionsResponse)
   end
 
   Stub = Service.rpc_stub_class
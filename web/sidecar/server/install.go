@@ -52,7 +52,7 @@ func (s *Server) Uninstall(ctx context.Context, req *sidecar_pb.UninstallRequest
 		return nil, err
 	}
 
-	if err := c.Uninstall(ctx, req.ReleaseName, namespace); err != nil {
+	if err := c.Uninstall(ctx, req.ReleaseName, namespace, false); err != nil {
 		return nil, err
 	}
 